@@ -2,367 +2,634 @@ package calculator
 
 import (
 	"Distributed-arithmetic-expression-evaluator-version-2.0/rest"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/tracing"
+	"context"
+	"log/slog"
+	"maps"
+	"math"
 	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-var (
-	alphabet           = []int32{40, 41, 42, 47, 43, 45}
-	canBe              = []int32{48, 49, 50, 51, 52, 43, 45, 42, 40, 41, 47, 53, 54, 55, 56, 57}
-	ArithmeticExecTime = map[int32]time.Duration{43: time.Millisecond * 500, 45: time.Millisecond * 750,
-		42: time.Millisecond * 1000, 47: time.Millisecond * 1500}
-	ComputingPower []int32
-)
+// defaultExecTimes Время выполнения арифметических операций по умолчанию
+var defaultExecTimes = map[string]time.Duration{"+": time.Millisecond * 500, "-": time.Millisecond * 750,
+	"*": time.Millisecond * 1000, "/": time.Millisecond * 1500, "^": time.Millisecond * 2000,
+	"%": time.Millisecond * 1500, "//": time.Millisecond * 1500}
+
+// OperationNames Названия операций, под которыми их время принимает и отдаёт /math
+var OperationNames = map[string]string{"addition": "+", "subtraction": "-", "multiplication": "*", "division": "/",
+	"exponentiation": "^", "modulo": "%", "integer_division": "//"}
+
+// MaxExecTime Максимально допустимое время выполнения одной операции
+const MaxExecTime = time.Minute
 
 type Operation struct {
-	operator int32
-	value    int64
+	operator string
+	value    time.Duration
 }
 
-func FormatOperation(opera int32, val string) (*Operation, error) {
-	var digit, err = strconv.ParseInt(strings.Replace(val, "-", "", -1), 10, 0)
+// FormatOperation Разбирает время операции: целое число трактуется как миллисекунды,
+// иначе ожидается строка длительности Go ("750ms", "2s")
+func FormatOperation(opera string, val string) (*Operation, error) {
+	var duration time.Duration
 
-	if err != nil {
-		return nil, err
+	if digit, err := strconv.ParseInt(val, 10, 64); err == nil {
+		duration = time.Duration(digit) * time.Millisecond
+	} else if duration, err = time.ParseDuration(val); err != nil {
+		return nil, rest.NewError("invalid duration %q", val)
+	}
+
+	if duration < 0 {
+		return nil, rest.NewError("must not be negative")
+	} else if duration > MaxExecTime {
+		return nil, rest.NewError("must not exceed %s", MaxExecTime)
 	}
 
 	return &Operation{
 		operator: opera,
-		value:    digit,
+		value:    duration,
 	}, nil
 }
 
-func MathOperation(operations ...*Operation) {
+// Operator Возвращает символ операции
+func (operation *Operation) Operator() string {
+	return operation.operator
+}
+
+// Duration Возвращает новое время выполнения операции
+func (operation *Operation) Duration() time.Duration {
+	return operation.value
+}
+
+// Timings Таблица времени выполнения операций и функций
+type Timings struct {
+	mu    sync.RWMutex
+	times map[string]time.Duration
+}
+
+// NewTimings Создаёт таблицу со временем выполнения по умолчанию
+func NewTimings() *Timings {
+	var times = maps.Clone(defaultExecTimes)
+	for name, function := range Functions {
+		times[name] = function.ExecTime
+	}
+
+	return &Timings{times: times}
+}
+
+// NewUniformTimings Создаёт таблицу, в которой каждая операция и функция выполняется за d.
+// С d = 0 все операции выполняются сразу, что удобно в тестах.
+func NewUniformTimings(d time.Duration) *Timings {
+	var timings = NewTimings()
+	for name := range timings.times {
+		timings.times[name] = d
+	}
+
+	return timings
+}
+
+// SetУстанавливает новое время операций и возвращает прежние значения
+func (timings *Timings) Set(operations ...*Operation) map[string]time.Duration {
+	timings.mu.Lock()
+	defer timings.mu.Unlock()
+
+	var previous = make(map[string]time.Duration, len(operations))
 	for _, val := range operations {
-		ArithmeticExecTime[val.operator] = time.UnixMilli(val.value).Sub(time.UnixMilli(0))
+		previous[val.operator] = timings.times[val.operator]
+		timings.times[val.operator] = val.value
 	}
+
+	return previous
 }
 
-func Waiter(value1, value2 int, operate int32) int {
-	time.Sleep(ArithmeticExecTime[operate])
+// Get Возвращает текущее время выполнения операции
+func (timings *Timings) Get(operate string) time.Duration {
+	timings.mu.RLock()
+	defer timings.mu.RUnlock()
 
-	switch operate {
-	case 42:
-		return value1 * value2
+	return timings.times[operate]
+}
 
-	case 43:
-		return value1 + value2
+// All Возвращает копию таблицы времени выполнения операций
+func (timings *Timings) All() map[string]time.Duration {
+	timings.mu.RLock()
+	defer timings.mu.RUnlock()
 
-	case 45:
-		return value1 - value2
+	return maps.Clone(timings.times)
+}
 
-	case 47:
-		return value1 / value2
+// Observer Получает события вычислителя, например для сбора метрик. Любая из функций может быть nil.
+type Observer struct {
+	Submitted func()              // Выражение поставлено в очередь на вычисление
+	Finished  func(status string) // Вычисление выражения завершилось с итоговым статусом
+	// Operation Операция или функция выполнена: configured - время по таблице, actual - фактическое
+	Operation func(operate string, configured, actual time.Duration)
+}
 
-	default:
-		return -1
+// Scheduler Вычисляет выражения, выдерживая время выполнения операций по своей таблице,
+// и отслеживает операции, которые выполняются в данный момент
+type Scheduler struct {
+	timings   *Timings
+	mu        sync.Mutex
+	running   []string
+	stopped   bool
+	observer  Observer
+	logger    *slog.Logger
+	tracer    *tracing.Tracer
+	clock     Clock
+	active    sync.WaitGroup // Вычисления, начатые через Acquire
+	queued    atomic.Int64   // Выражения, ожидающие свободного места в Acquire
+	computing atomic.Int64   // Выражения, занявшие место и ещё не освободившие его
+	slots     chan struct{}  // Занятые вычислителями места, nil без ограничения
+	stop      chan struct{}  // Закрывается при остановке
+}
+
+// NewScheduler Создаёт вычислитель с заданной таблицей времени выполнения, который вычисляет
+// одновременно не больше workers выражений. При workers <= 0 число выражений не ограничено.
+func NewScheduler(timings *Timings, workers int) *Scheduler {
+	var scheduler = &Scheduler{timings: timings, clock: RealClock{}, stop: make(chan struct{})}
+	if workers > 0 {
+		scheduler.slots = make(chan struct{}, workers)
 	}
+
+	return scheduler
 }
 
-// Delimiter Распределяет подсчёт на разные ярусы
-func Delimiter(expr string) ([]int32, []int, error) {
-	var queue = make([]int32, 0)
-	var values = make([]int, 0)
-	var value string
+// Timings Возвращает таблицу времени выполнения операций
+func (scheduler *Scheduler) Timings() *Timings {
+	return scheduler.timings
+}
 
-	for _, val := range expr {
-		if slices.Contains(alphabet, val) {
-			if value != "" {
-				num, err := strconv.Atoi(value)
+// Acquire Регистрирует начало вычисления выражения, ожидая свободного места, если все заняты.
+// После Stop новые вычисления не начинаются и Acquire возвращает false.
+// Каждому успешному Acquire должен соответствовать Release.
+func (scheduler *Scheduler) Acquire() bool {
+	scheduler.mu.Lock()
+	if scheduler.stopped {
+		scheduler.mu.Unlock()
+		return false
+	}
+	scheduler.active.Add(1)
+	scheduler.mu.Unlock()
 
-				if err != nil {
-					return nil, nil, rest.NewError("Extraneous characters found in expression: %s", value)
-				}
+	if scheduler.slots == nil {
+		scheduler.computing.Add(1)
+		return true
+	}
 
-				values = append(values, num)
-				value = ""
-			}
+	scheduler.queued.Add(1)
+	defer scheduler.queued.Add(-1)
 
-			queue = append(queue, val)
-		} else {
-			value += string(val)
-		}
+	select {
+	case scheduler.slots <- struct{}{}:
+		scheduler.computing.Add(1)
+		return true
+	case <-scheduler.stop:
+		scheduler.active.Done()
+		return false
 	}
+}
 
-	if value != "" {
-		num, err := strconv.Atoi(value)
+// Release Отмечает завершение вычисления, начатого Acquire
+func (scheduler *Scheduler) Release() {
+	scheduler.computing.Add(-1)
+	if scheduler.slots != nil {
+		<-scheduler.slots
+	}
+	scheduler.active.Done()
+}
 
-		if err != nil {
-			return nil, nil, rest.NewError("Extraneous characters found in expression: %s", value)
-		}
+// Workers Возвращает наибольшее число одновременно вычисляемых выражений, 0 без ограничения
+func (scheduler *Scheduler) Workers() int {
+	return cap(scheduler.slots)
+}
+
+// Queued Возвращает число выражений, ожидающих свободного места
+func (scheduler *Scheduler) Queued() int {
+	return int(scheduler.queued.Load())
+}
 
-		values = append(values, num)
+// Computing Возвращает число выражений, которые вычисляются в данный момент
+func (scheduler *Scheduler) Computing() int {
+	return int(scheduler.computing.Load())
+}
+
+// QueueWait Оценивает, сколько выражение будет ждать свободного места, если перед ним в очереди ahead выражений.
+// Места освобождаются волнами по Workers выражений, каждая волна считается длящейся wave.
+func (scheduler *Scheduler) QueueWait(ahead int, wave time.Duration) time.Duration {
+	var workers = scheduler.Workers()
+	if workers == 0 || scheduler.Computing()+ahead < workers {
+		return 0
 	}
 
-	return queue, values, nil
+	return time.Duration(ahead/workers+1) * wave
 }
 
-// Distributor Разделяет значения на множество действий
-func Distributor(queue []int32, values []int) ([][]int32, [][]int, error) {
-	var expresses = [][]int32{{}}
-	var sortValues = [][]int{{}}
+// Observe Задаёт получателя событий вычислителя
+func (scheduler *Scheduler) Observe(observer Observer) {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
 
-	var indexes = []int{0}
-	var indexLastExpression = -1
-	var indexValue = 0 // Индекс числа из Value
-	var index int
+	scheduler.observer = observer
+}
 
-	for i, val := range queue {
-		switch val {
-		case 40: // (
-			indexes = append(indexes, len(expresses))
-			sortValues = append(sortValues, make([]int, 0))
-			expresses = append(expresses, make([]int32, 0))
+// SetLogger Задаёт журнал вычислителя
+func (scheduler *Scheduler) SetLogger(logger *slog.Logger) {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
 
-		case 41: // )
-			index = rest.Last(indexes)
+	scheduler.logger = logger
+}
 
-			if indexLastExpression != -1 {
-				sortValues[index] = append(sortValues[index], -indexLastExpression)
-				indexLastExpression = -1
-			} else {
-				sortValues[index] = append(sortValues[index], values[indexValue])
-				indexValue++
-			}
+// Logger Возвращает журнал вычислителя, slog.Default(), если он не задан
+func (scheduler *Scheduler) Logger() *slog.Logger {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
 
-			indexLastExpression = index
+	if scheduler.logger == nil {
+		return slog.Default()
+	}
 
-			indexes = slices.Delete(indexes, len(indexes)-1, len(indexes))
+	return scheduler.logger
+}
 
-			if i == len(queue)-1 {
-				sortValues[rest.Last(indexes)] = append(sortValues[rest.Last(indexes)], -indexLastExpression)
-			}
+// SetTracer Задаёт трассировщик, записывающий вычисления и операции, nil отключает трассировку
+func (scheduler *Scheduler) SetTracer(tracer *tracing.Tracer) {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
 
-		default:
-			index = rest.Last(indexes)
+	scheduler.tracer = tracer
+}
 
-			if indexLastExpression != -1 {
-				sortValues[index] = append(sortValues[index], -indexLastExpression)
-				indexLastExpression = -1
-			} else {
-				sortValues[index] = append(sortValues[index], values[indexValue])
-				indexValue++
-			}
+// Tracer Возвращает трассировщик вычислителя, nil, если трассировка отключена
+func (scheduler *Scheduler) Tracer() *tracing.Tracer {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
 
-			expresses[index] = append(expresses[index], val)
-		}
-	}
+	return scheduler.tracer
+}
 
-	if index == 0 {
-		if indexLastExpression != -1 {
-			sortValues[index] = append(sortValues[index], -indexLastExpression)
-			indexLastExpression = -1
-		} else {
-			sortValues[index] = append(sortValues[index], values[indexValue])
-			indexValue++
-		}
+// SetClock Задаёт источник времени, по которому выдерживается время выполнения операций
+func (scheduler *Scheduler) SetClock(clock Clock) {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	scheduler.clock = clock
+}
+
+// Clock Возвращает источник времени вычислителя, по умолчанию RealClock
+func (scheduler *Scheduler) Clock() Clock {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	return scheduler.clock
+}
+
+// calculation Журнал, контекст трассировки и хронология одного вычисления, общие для всех его операций
+type calculation struct {
+	ctx     context.Context
+	logger  *slog.Logger
+	tracer  *tracing.Tracer
+	express *rest.Expression // Выражение, в которое записываются операции, может отсутствовать
+	worker  int              // Номер вычислителя, выполняющего операцию
+}
+
+// on Возвращает вычисление для операции, выполняемой вычислителем с номером worker
+func (calc *calculation) on(worker int) *calculation {
+	var child = *calc
+	child.worker = worker
+
+	return &child
+}
+
+// background Возвращает вычисление без выражения: операции пишутся в журнал вычислителя
+// и не трассируются, чтобы каждая не начинала отдельную трассу
+func (scheduler *Scheduler) background() *calculation {
+	return &calculation{ctx: context.Background(), logger: scheduler.Logger()}
+}
+
+// observed Возвращает текущего получателя событий
+func (scheduler *Scheduler) observed() Observer {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	return scheduler.observer
+}
+
+// Submitted Сообщает получателю событий, что выражение поставлено на вычисление
+func (scheduler *Scheduler) Submitted() {
+	if observer := scheduler.observed(); observer.Submitted != nil {
+		observer.Submitted()
 	}
+}
 
-	return expresses, sortValues, nil
+// Finished Сообщает получателю событий итоговый статус вычисленного выражения
+func (scheduler *Scheduler) Finished(status string) {
+	if observer := scheduler.observed(); observer.Finished != nil {
+		observer.Finished(status)
+	}
 }
 
-func Mathematician(expresses [][]int32, values [][]int) int {
-	var doneCh = make(chan []int)
-	wg := sync.WaitGroup{}
+// Stop Запрещает начинать новые вычисления. Уже начатые продолжаются.
+func (scheduler *Scheduler) Stop() {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
 
-	wg.Add(1)
-	go Proletarian(&wg, expresses, values, 0, &doneCh)
+	if !scheduler.stopped {
+		scheduler.stopped = true
+		close(scheduler.stop)
+	}
+}
+
+// Stopped Возвращает канал, который закрывается при остановке
+func (scheduler *Scheduler) Stopped() <-chan struct{} {
+	return scheduler.stop
+}
 
+// Wait Ждёт завершения начатых вычислений или отмены контекста
+func (scheduler *Scheduler) Wait(ctx context.Context) error {
+	var done = make(chan struct{})
 	go func() {
-		defer close(doneCh)
-		wg.Wait()
+		scheduler.active.Wait()
+		close(done)
 	}()
 
-	for i := range doneCh {
-		return i[0]
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
-	return -1
+// Processes Возвращает операции, которые выполняются в данный момент
+func (scheduler *Scheduler) Processes() []string {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	return slices.Clone(scheduler.running)
 }
 
-func Proletarian(wg *sync.WaitGroup, expresses [][]int32, values [][]int, index int, outCh *chan []int) {
-	defer wg.Done()
-	var valueWG = sync.WaitGroup{}
+// operation Выполненная операция, которую вызывающий завершает, записав результат
+type operation struct {
+	calc   *calculation
+	span   *tracing.Span
+	record rest.OperationRecord
+}
 
-	var expr = expresses[index]
-	var value = values[index]
-	var calculated = make([]int, len(value))
+// end Записывает результат операции в её span и хронологию выражения
+func (op *operation) end(value float64, err error) (float64, error) {
+	if err != nil {
+		op.span.SetError(err)
+	} else {
+		op.span.SetAttributes("result", value)
+	}
+	op.span.End()
 
-	var routine = ArithmeticSorter(expr)
+	if op.calc.express != nil {
+		op.record.Result, op.record.Err = value, err
+		op.calc.express.Record(op.record)
+	}
 
-	var value1, value2 int
+	return value, err
+}
 
-	for _, i := range routine {
-		ComputingPower = append(ComputingPower, expr[i])
+// occupy Отмечает операцию выполняющейся и ждёт её время выполнения
+func (scheduler *Scheduler) occupy(calc *calculation, operate string, operands ...float64) *operation {
+	var _, span = calc.tracer.Start(calc.ctx, "operation", "operator", operate, "operands", operands)
+
+	scheduler.mu.Lock()
+	scheduler.running = append(scheduler.running, operate)
+	var observer = scheduler.observer
+	scheduler.mu.Unlock()
+
+	var (
+		clock      = scheduler.Clock()
+		configured = scheduler.timings.Get(operate)
+		started    = clock.Now()
+	)
+	clock.Sleep(configured)
+	var actual = clock.Now().Sub(started)
+
+	scheduler.mu.Lock()
+	var index = slices.Index(scheduler.running, operate)
+	scheduler.running = slices.Delete(scheduler.running, index, index+1)
+	scheduler.mu.Unlock()
+
+	calc.logger.Debug("Operation executed", "operation", operate, "operands", operands, "configured", configured, "actual", actual)
+	span.SetAttributes("configured", configured, "actual", actual, "worker", calc.worker)
+	if observer.Operation != nil {
+		observer.Operation(operate, configured, actual)
+	}
 
-		if calculated[i] == 0 {
-			value1 = value[i]
-		} else {
-			value1 = calculated[i]
-		}
+	return &operation{calc: calc, span: span, record: rest.OperationRecord{
+		Operator: operate,
+		Operands: slices.Clone(operands),
+		Worker:   calc.worker,
+		Start:    started,
+		End:      started.Add(actual),
+	}}
+}
 
-		if calculated[i+1] == 0 {
-			value2 = value[i+1]
-		} else {
-			value2 = calculated[i+1]
-		}
+func (scheduler *Scheduler) Waiter(value1, value2 float64, operate string) (float64, error) {
+	return scheduler.waiter(scheduler.background(), value1, value2, operate)
+}
+
+// waiter Выполняет операцию, записывая её в журнал вычисления
+func (scheduler *Scheduler) waiter(calc *calculation, value1, value2 float64, operate string) (float64, error) {
+	var op = scheduler.occupy(calc, operate, value1, value2)
+
+	return op.end(apply(value1, value2, operate))
+}
+
+// apply Вычисляет бинарную операцию без задержки
+func apply(value1, value2 float64, operate string) (float64, error) {
+	switch operate {
+	case "*":
+		return value1 * value2, nil
+
+	case "+":
+		return value1 + value2, nil
 
-		var valueCh = make(chan []int)
+	case "-":
+		return value1 - value2, nil
 
-		if value1 <= 0 {
-			valueWG.Add(1)
-			go Proletarian(&valueWG, expresses, values, -value1, &valueCh)
+	case "/":
+		if value2 == 0 {
+			return 0, rest.NewError("Division by zero")
 		}
+		return value1 / value2, nil
 
-		if value2 <= 0 {
-			valueWG.Add(1)
-			go Proletarian(&valueWG, expresses, values, -value2, &valueCh)
+	case "//":
+		if value2 == 0 {
+			return 0, rest.NewError("Division by zero")
 		}
+		return math.Floor(value1 / value2), nil
 
-		go func() {
-			defer close(valueCh)
-			valueWG.Wait()
-		}()
-
-		for val := range valueCh {
-			if val[1] == -value1 {
-				value1 = val[0]
-			} else {
-				value2 = val[0]
-			}
+	case "%":
+		if value2 == 0 {
+			return 0, rest.NewError("Division by zero")
 		}
+		// Остаток берёт знак делителя, чтобы a == b*(a//b) + a%b
+		return value1 - value2*math.Floor(value1/value2), nil
 
-		ComputingPower = slices.Delete(ComputingPower, slices.Index(ComputingPower, expr[i]), slices.Index(ComputingPower, expr[i])+1)
-		calculated[i] = Waiter(value1, value2, expr[i])
-		calculated[i+1] = calculated[i]
+	case "^":
+		var result = math.Pow(value1, value2)
+		if math.IsNaN(result) || math.IsInf(result, 0) {
+			return 0, rest.NewError("Invalid exponentiation: %s ^ %s", rest.FormatValue(value1), rest.FormatValue(value2))
+		}
+		return result, nil
+
+	default:
+		return 0, rest.NewError("Unknown operation: %s", operate)
 	}
+}
 
-	*outCh <- []int{calculated[rest.Last(routine)], index}
+// Caller Вычисляет встроенную функцию за её время выполнения
+func (scheduler *Scheduler) Caller(name string, args ...float64) (float64, error) {
+	return scheduler.caller(scheduler.background(), name, args...)
 }
 
-// ArithmeticSorter Сортирует операции по важности по убыванию
-func ArithmeticSorter(expr []int32) []int {
-	var routine []int
-	var routineStrong []int
+// caller Вычисляет функцию, записывая её в журнал вычисления
+func (scheduler *Scheduler) caller(calc *calculation, name string, args ...float64) (float64, error) {
+	var function, ok = Functions[name]
+	if !ok {
+		return 0, rest.NewError("Unknown function: %s", name)
+	}
 
-	for i, val := range expr {
-		if val == 42 || val == 47 {
-			routineStrong = append(routineStrong, i)
-		} else if val == 43 || val == 45 {
-			routine = append(routine, i)
-		}
+	if err := function.CheckArity(name, len(args)); err != nil {
+		return 0, err
 	}
 
-	return append(routineStrong, routine...)
+	var op = scheduler.occupy(calc, name, args...)
+
+	return op.end(function.Apply(args...))
 }
 
-// CalculationTime Считает примерное время выполнения операции
-func CalculationTime(expr string) (time.Duration, error) {
-	expr, err := PreparingExpression(expr)
+func (scheduler *Scheduler) Mathematician(tree Node) (float64, error) {
+	return scheduler.evaluate(scheduler.background(), tree)
+}
+
+// CalculationTime Оценивает время вычисления выражения в лучшем случае, когда для него есть свободное место:
+// по самой длинной цепочке операций, которые нельзя выполнить параллельно
+func (timings *Timings) CalculationTime(expr string, variables map[string]float64) (time.Duration, error) {
+	expr, err := PreparingExpression(expr, variables)
 
 	if err != nil {
 		return 0, err
 	}
 
-	expresses, _, err := Delimiter(expr)
+	tree, err := ParseWith(expr, variables)
 
 	if err != nil {
 		return 0, err
 	}
 
-	var workingHours time.Duration
+	return timings.CriticalPath(tree), nil
+}
 
-	for _, expr := range expresses {
-		workingHours += ArithmeticExecTime[expr]
+// CriticalPath Оценивает время вычисления дерева так, как его выполняет evaluate: операция начинается,
+// как только вычислены её операнды, поэтому время равно самой долгой цепочке зависящих друг от друга операций
+func (timings *Timings) CriticalPath(tree Node) time.Duration {
+	switch node := tree.(type) {
+	case *Binary:
+		return max(timings.CriticalPath(node.Left), timings.CriticalPath(node.Right)) + timings.Get(node.Operator)
+	case *Unary:
+		return timings.CriticalPath(node.Operand)
+	case *Call:
+		var longest time.Duration
+		for _, arg := range node.Args {
+			longest = max(longest, timings.CriticalPath(arg))
+		}
+		return longest + timings.Get(node.Name)
+	case *Group:
+		return timings.CriticalPath(node.Inner)
+	default:
+		return 0
 	}
-
-	return workingHours, nil
 }
 
-// PreparingExpression Проверяет выражение на правильность формулировки и форматирует
-func PreparingExpression(expr string) (string, error) {
-	var parenthesis = 0
+// PreparingExpression Проверяет выражение на правильность формулировки и убирает пробелы.
+// Позиции в ошибках указываются относительно исходной строки
+func PreparingExpression(expr string, variables map[string]float64) (string, error) {
+	if _, err := ParseWith(expr, variables); err != nil {
+		return "", err
+	}
 
-	expr = strings.Replace(expr, " ", "", strings.Count(expr, " "))
+	return strings.Join(strings.Fields(expr), ""), nil
+}
 
-	var dataReplace = map[string]string{"+-": "-", "--": "+", "++": "+"}
+// Bindings Возвращает значения только тех переменных, которые встречаются в выражении
+func Bindings(expr string, variables map[string]float64) (map[string]float64, error) {
+	tree, err := ParseWith(expr, variables)
 
-	for i, val := range expr {
-		if val == 40 {
-			parenthesis++
-		} else if val == 41 {
-			parenthesis--
-		}
-
-		if parenthesis < 0 {
-			return "", rest.NewError("Extra closed parenthesis: %s", strconv.Itoa(i))
-		}
+	if err != nil {
+		return nil, err
 	}
 
-	if parenthesis != 0 {
-		return "", rest.NewError("Extra open parenthesis")
+	return Variables(tree), nil
+}
+
+// Calculator Решает арифметическое выражение и сохраняет в нём результат или ошибку.
+// Операции записываются в logger, журнал вычислителя, если он nil. Разбор и вычисление
+// записываются как дочерние span текущего span ctx.
+func (scheduler *Scheduler) Calculator(ctx context.Context, express *rest.Expression, logger *slog.Logger) {
+	if logger == nil {
+		logger = scheduler.Logger()
 	}
 
-	expr = strings.Trim(expr, "/*+-")
+	var calc = &calculation{ctx: ctx, logger: logger, tracer: scheduler.Tracer(), express: express}
 
-	for key, val := range dataReplace {
-		for strings.Count(expr, key) != 0 {
-			expr = strings.Replace(expr, key, val, strings.Count(expr, key))
-		}
-	}
+	tree, err := scheduler.parse(calc, express)
 
-	for i, elem := range expr {
-		if !slices.Contains(canBe, elem) {
-			return "", rest.NewError("Foreign character detected: %s", string(elem))
-		} else if slices.Contains(alphabet, elem) && elem > 41 && ((slices.Contains(alphabet, int32(expr[i-1])) && expr[i-1] > 41) || (slices.Contains(alphabet, int32(expr[i+1])) && expr[i+1] > 41)) {
-			return "", rest.NewError("Incorrect expression: %s", expr[i-1:i+2])
-		}
+	if err != nil {
+		express.Fail(err)
+		return
 	}
 
-	return expr, nil
-}
+	var computeCtx, span = calc.tracer.Start(ctx, "compute")
+	calc.ctx = computeCtx
 
-// Calculator Решает арифметическое выражение
-func Calculator(express *rest.Expression) {
-	defer express.Close()
+	answer, err := scheduler.evaluate(calc, tree)
 
-	expr, err := PreparingExpression(express.Express)
+	span.SetError(err)
+	span.End()
 
 	if err != nil {
-		express.ErrCh <- err
+		express.Fail(err)
 		return
 	}
 
-	queue, values, err := Delimiter(expr)
+	express.Finish(answer)
+}
+
+// parse Разбирает выражение в дерево и подставляет ссылки на другие выражения
+func (scheduler *Scheduler) parse(calc *calculation, express *rest.Expression) (tree Node, err error) {
+	var _, span = calc.tracer.Start(calc.ctx, "parse", "content", express.Express)
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
+	expr, err := PreparingExpression(express.Express, express.Bindings)
 
 	if err != nil {
-		express.ErrCh <- err
-		return
+		return nil, err
 	}
 
-	expresses, value, err := Distributor(queue, values)
+	tree, err = ParseWith(expr, express.Bindings)
 
 	if err != nil {
-		express.ErrCh <- err
-		return
+		return nil, err
 	}
 
-	for i, val := range expresses {
-		if len(val)+1 != len(value[i]) {
-			express.ErrCh <- rest.NewError("Incorrect expression")
-			return
-		} else if len(val) == 0 || len(value[i]) < 2 {
-			express.ErrCh <- rest.NewError("Too few arguments")
-			return
-		}
+	if err = Resolve(tree, express.References); err != nil {
+		return nil, err
 	}
 
-	answer := Mathematician(expresses, value)
-
-	express.Result <- answer
-
-	return
+	return tree, nil
 }
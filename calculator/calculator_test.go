@@ -0,0 +1,624 @@
+package calculator
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/rest"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// noDelay Создаёт вычислитель, у которого операции выполняются без задержки
+func noDelay() *Scheduler {
+	return NewScheduler(NewUniformTimings(0), 0)
+}
+
+func TestPrecedence(t *testing.T) {
+	var scheduler = noDelay()
+
+	var tests = []struct {
+		expr string
+		want float64
+	}{
+		{"2+3*4", 14},
+		{"2+3*4+5", 19},
+		{"2*3+4*5", 26},
+		{"10-4-3", 3},
+		{"100/10/5", 2},
+		{"2^3^2", 512},
+		{"(2^3)^2", 64},
+		{"2*3^2", 18},
+		{"2^3*2", 16},
+		{"7/2", 3.5},
+		{"7//2", 3},
+		{"7%3", 1},
+		{"2+7%3*4", 6},
+		{"2+7//2*3", 11},
+		{"20//3%4", 2},
+		{"20%7//2", 3},
+		{"(2+3)*(4+5)", 45},
+		{"2*(3+(4-1)^2)", 24},
+		{"5", 5},
+		{"1.5*4", 6},
+		{"0+0*5", 0},
+	}
+
+	for _, test := range tests {
+		tree, err := Parse(test.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", test.expr, err)
+		}
+
+		got, err := scheduler.Mathematician(tree)
+		if err != nil {
+			t.Fatalf("%s: %v", test.expr, err)
+		}
+
+		if got != test.want {
+			t.Errorf("%s = %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestWaiter(t *testing.T) {
+	var scheduler = noDelay()
+
+	var tests = []struct {
+		value1, value2 float64
+		operator       string
+		want           float64
+	}{
+		{-7, 2, "//", -4},
+		{-7, 2, "%", 1},
+		{7, -2, "%", -1},
+		{2, -1, "^", 0.5},
+	}
+
+	for _, test := range tests {
+		got, err := scheduler.Waiter(test.value1, test.value2, test.operator)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != test.want {
+			t.Errorf("%v %s %v = %v, want %v", test.value1, test.operator, test.value2, got, test.want)
+		}
+	}
+
+	for _, operator := range []string{"/", "//", "%"} {
+		if _, err := scheduler.Waiter(1, 0, operator); err == nil {
+			t.Errorf("1 %s 0 must fail with division by zero", operator)
+		}
+	}
+}
+
+func TestUnary(t *testing.T) {
+	var scheduler = noDelay()
+
+	var tests = []struct {
+		expr string
+		want float64
+	}{
+		{"-3*2", -6},
+		{"2*-3", -6},
+		{"-(2+3)", -5},
+		{"--4", 4},
+		{"+4", 4},
+		{"2--3", 5},
+		{"2+-3", -1},
+		{"-2^2", -4},
+		{"2^-1", 0.5},
+		{"(-2)^2", 4},
+		{"-2*-(3+-1)", 4},
+		{" - 3 * ( - 2 ) ", 6},
+	}
+
+	for _, test := range tests {
+		tree, err := Parse(test.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", test.expr, err)
+		}
+
+		got, err := scheduler.Mathematician(tree)
+		if err != nil {
+			t.Fatalf("%s: %v", test.expr, err)
+		}
+
+		if got != test.want {
+			t.Errorf("%s = %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	var scheduler = noDelay()
+
+	var tests = []struct {
+		expr string
+		want float64
+	}{
+		{"max(3, 4*2) + abs(-5) + sqrt(16)", 17},
+		{"min(7, 2, 9) * 2", 4},
+		{"max(1)", 1},
+		{"pow(2, 10) - 2^10", 0},
+		{"floor(7/2) + ceil(7/2) + round(2.5)", 10},
+		{"log(8, 2)", 3},
+		{"log(1)", 0},
+		{"sin(0) + cos(0)", 1},
+		{"-abs(-(2+3))", -5},
+		{"max(min(1, 2), (3+4)*2)", 14},
+	}
+
+	for _, test := range tests {
+		tree, err := Parse(test.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", test.expr, err)
+		}
+
+		got, err := scheduler.Mathematician(tree)
+		if err != nil {
+			t.Fatalf("%s: %v", test.expr, err)
+		}
+
+		if got != test.want {
+			t.Errorf("%s = %v, want %v", test.expr, got, test.want)
+		}
+	}
+
+	for _, expr := range []string{"sqrt(-1)", "log(0)", "log(8, 1)"} {
+		tree, err := Parse(expr)
+		if err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+
+		if _, err = scheduler.Mathematician(tree); err == nil {
+			t.Errorf("%s must fail", expr)
+		}
+	}
+}
+
+func TestCalculationTimeFunctions(t *testing.T) {
+	var timings = NewTimings()
+	var want = max(timings.Get("*")+timings.Get("max"), timings.Get("sqrt")) + timings.Get("+")
+
+	got, err := timings.CalculationTime("max(3, 4*2) + sqrt(16)", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestCriticalPath(t *testing.T) {
+	var (
+		timings     = NewTimings()
+		add, mul    = timings.Get("+"), timings.Get("*")
+		sqrt, power = timings.Get("sqrt"), timings.Get("^")
+	)
+
+	var tests = []struct {
+		expr string
+		want time.Duration
+	}{
+		{"5", 0},
+		{"2+3*4", add + mul},
+		{"(2*3)+(4*5)", mul + add},         // Скобки считаются параллельно
+		{"2*3+4*5+6*7", mul + 2*add},       // Как и независимые операции без скобок
+		{"(2*3)+(4*5)+(6^2)", power + add}, // Первое сложение выполняется, пока считается степень
+		{"((1+2)*3)+(4*5)", add + mul + add},
+		{"sqrt((1+2)*3)", add + mul + sqrt},
+	}
+
+	for _, test := range tests {
+		tree, err := Parse(test.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", test.expr, err)
+		}
+
+		if got := timings.CriticalPath(tree); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestCalculationTimeParallel(t *testing.T) {
+	var timings = NewTimings()
+
+	got, err := timings.CalculationTime("(x*2) + (3^2)", map[string]float64{"x": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := timings.Get("^") + timings.Get("+"); got != want {
+		t.Errorf("got %s, want %s: the groups are computed in parallel", got, want)
+	}
+}
+
+func TestNewUniformTimings(t *testing.T) {
+	var timings = NewUniformTimings(time.Second)
+	for operator, duration := range timings.All() {
+		if duration != time.Second {
+			t.Errorf("%s: got %s, want 1s", operator, duration)
+		}
+	}
+
+	got, err := timings.CalculationTime("sqrt(2*3) + 4", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 3*time.Second {
+		t.Errorf("got %s, want 3s", got)
+	}
+}
+
+func TestQueueWait(t *testing.T) {
+	const wave = time.Second
+
+	if got := noDelay().QueueWait(10, wave); got != 0 {
+		t.Errorf("got %s without a limit of workers, want 0", got)
+	}
+
+	var scheduler = NewScheduler(NewTimings(), 2)
+	if got := scheduler.QueueWait(1, wave); got != 0 {
+		t.Errorf("got %s with free workers, want 0", got)
+	}
+
+	scheduler.Acquire()
+	scheduler.Acquire()
+
+	var tests = []struct {
+		ahead int
+		want  time.Duration
+	}{
+		{0, wave},     // Ждёт, пока освободится любое место
+		{1, wave},     // Первое освободившееся место займёт выражение впереди, второе - это
+		{2, 2 * wave}, // Впереди целая волна
+		{5, 3 * wave},
+	}
+	for _, test := range tests {
+		if got := scheduler.QueueWait(test.ahead, wave); got != test.want {
+			t.Errorf("%d ahead: got %s, want %s", test.ahead, got, test.want)
+		}
+	}
+
+	scheduler.Release()
+	if got := scheduler.QueueWait(0, wave); got != 0 {
+		t.Errorf("got %s with a free worker, want 0", got)
+	}
+}
+
+// epoch Начало виртуального времени тестов
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// fakeScheduler Создаёт вычислитель со временем операций по умолчанию, которое идёт по FakeClock
+func fakeScheduler() (*Scheduler, *FakeClock) {
+	var (
+		scheduler = NewScheduler(NewTimings(), 0)
+		clock     = NewFakeClock(epoch)
+	)
+	scheduler.SetClock(clock)
+
+	return scheduler, clock
+}
+
+// stepThrough Продвигает время от одного окончания операций к следующему, проверяя,
+// сколько операций выполняется одновременно перед каждым шагом
+func stepThrough(t *testing.T, clock *FakeClock, name string, sleepers []int) {
+	t.Helper()
+
+	for step, n := range sleepers {
+		clock.BlockUntil(n)
+		if got := clock.Sleepers(); got != n {
+			t.Fatalf("%s: step %d: %d operations are running at once, want %d", name, step, got, n)
+		}
+		clock.AdvanceNext()
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	var clock = NewFakeClock(epoch)
+	clock.Sleep(0) // Не ждёт
+
+	var woken = make(chan time.Duration, 2)
+	for _, d := range []time.Duration{time.Second, 2 * time.Second} {
+		go func() {
+			clock.Sleep(d)
+			woken <- d
+		}()
+	}
+	clock.BlockUntil(2)
+
+	clock.Advance(500 * time.Millisecond)
+	if step := clock.AdvanceNext(); step != 500*time.Millisecond {
+		t.Errorf("advanced by %s to the next deadline, want 500ms", step)
+	}
+	if d := <-woken; d != time.Second || clock.Sleepers() != 1 {
+		t.Errorf("woke %s with %d sleepers left, want 1s and 1", d, clock.Sleepers())
+	}
+
+	clock.Advance(time.Hour)
+	if d := <-woken; d != 2*time.Second || clock.Sleepers() != 0 {
+		t.Errorf("woke %s with %d sleepers left", d, clock.Sleepers())
+	}
+	if now := clock.Now(); !now.Equal(epoch.Add(time.Hour + time.Second)) {
+		t.Errorf("now is %s", now)
+	}
+	if step := clock.AdvanceNext(); step != 0 {
+		t.Errorf("advanced by %s without sleepers", step)
+	}
+}
+
+func TestCalculator(t *testing.T) {
+	var tests = []struct {
+		expr       string
+		bindings   map[string]float64
+		references map[string]float64
+		sleepers   []int // Число одновременно выполняющихся операций перед каждым шагом времени
+		want       float64
+		err        string        // Начало сообщения об ошибке, если вычисление завершается ею
+		elapsed    time.Duration // Виртуальное время от начала до завершения, для вычисленных совпадает с оценкой
+	}{
+		{expr: "7", want: 7},
+		{expr: "2+3", sleepers: []int{1}, want: 5, elapsed: 500 * time.Millisecond},
+		{expr: "2+3*4", sleepers: []int{1, 1}, want: 14, elapsed: 1500 * time.Millisecond},
+		{expr: "2+3+4+5", sleepers: []int{1, 1, 1}, want: 14, elapsed: 1500 * time.Millisecond},
+		{expr: "2^3^2", sleepers: []int{1, 1}, want: 512, elapsed: 4 * time.Second},
+		// Независимые операции выполняются одновременно со скобками и без них
+		{expr: "2*3+4*5", sleepers: []int{2, 1}, want: 26, elapsed: 1500 * time.Millisecond},
+		{expr: "2*3+4*5+6*7", sleepers: []int{3, 1, 1}, want: 68, elapsed: 2 * time.Second},
+		{expr: "(1+2)*(3+4)-(5+6)*(7+8)", sleepers: []int{4, 2, 1}, want: -144, elapsed: 2250 * time.Millisecond},
+		{expr: "10 % 4 + 10 // 4", sleepers: []int{2, 1}, want: 4, elapsed: 2 * time.Second},
+		// Первое сложение выполняется, пока считается степень
+		{expr: "(2*3)+(4*5)+(6^2)", sleepers: []int{3, 2, 1, 1}, want: 62, elapsed: 2500 * time.Millisecond},
+		// Смена знака выполняется без задержки
+		{expr: "-(2+3)*-4", sleepers: []int{1, 1}, want: 20, elapsed: 1500 * time.Millisecond},
+		{expr: "max(1+2, 3*4, sqrt(16)) - -(2*3)", sleepers: []int{4, 3, 1, 1}, want: 18, elapsed: 2250 * time.Millisecond},
+		{expr: "floor(7/2) + pow(2, 3)", sleepers: []int{2, 2, 1}, want: 11, elapsed: 2500 * time.Millisecond},
+		{expr: "price * qty + tax", bindings: map[string]float64{"price": 2.5, "qty": 4, "tax": 1},
+			sleepers: []int{1, 1}, want: 11, elapsed: 1500 * time.Millisecond},
+		{expr: "$a * 2 + $b", references: map[string]float64{"a": 3, "b": 1},
+			sleepers: []int{1, 1}, want: 7, elapsed: 1500 * time.Millisecond},
+		// Вычисление с ошибкой дожидается операций, которые уже выполняются
+		{expr: "1/0 + 2^3", sleepers: []int{2, 1}, err: "Division by zero", elapsed: 2 * time.Second},
+		{expr: "sqrt(-1) * 2", sleepers: []int{1}, err: "Square root of a negative number", elapsed: time.Second},
+		{expr: "(0-1)^0.5", sleepers: []int{1, 1}, err: "Invalid exponentiation", elapsed: 2750 * time.Millisecond},
+		{expr: "2 +", err: "Too few arguments"},
+		{expr: "$a + 1", err: "Expression $a"},
+	}
+
+	for _, test := range tests {
+		var (
+			scheduler, clock = fakeScheduler()
+			express          = &rest.Expression{Express: test.expr, Bindings: test.bindings, Value: -1}
+			done             = make(chan struct{})
+		)
+		express.Expiration, _ = scheduler.Timings().CalculationTime(test.expr, test.bindings)
+		express.SetClock(clock.Now)
+		express.Start(test.references)
+
+		go func() {
+			scheduler.Calculator(context.Background(), express, nil)
+			close(done)
+		}()
+		stepThrough(t, clock, test.expr, test.sleepers)
+		<-done
+
+		var status, value, err = express.State()
+		switch {
+		case test.err != "":
+			if status != rest.StatusFailed || err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("%s: got %s with %v, want error %q", test.expr, status, err, test.err)
+			}
+		case err != nil || status != rest.StatusDone:
+			t.Errorf("%s: got %s with %v", test.expr, status, err)
+		case value != test.want:
+			t.Errorf("%s = %v, want %v", test.expr, value, test.want)
+		case test.elapsed != express.Expiration:
+			t.Errorf("%s: estimated %s, want %s", test.expr, express.Expiration, test.elapsed)
+		}
+
+		if elapsed := express.FinishedAt().Sub(express.StartedAt()); elapsed != test.elapsed {
+			t.Errorf("%s: took %s, want %s", test.expr, elapsed, test.elapsed)
+		}
+		if processes := scheduler.Processes(); len(processes) != 0 {
+			t.Errorf("%s: operations %v are still running", test.expr, processes)
+		}
+	}
+}
+
+func TestCalculatorTimeline(t *testing.T) {
+	var (
+		scheduler, clock = fakeScheduler()
+		express          = &rest.Expression{Express: "(1+2)*(3+4)-5", Value: -1}
+		done             = make(chan struct{})
+	)
+	scheduler.Observe(Observer{Operation: func(operate string, want, actual time.Duration) {
+		if want != actual {
+			t.Errorf("%s took %s, configured %s", operate, actual, want)
+		}
+	}})
+	express.SetClock(clock.Now)
+	express.Start(nil)
+
+	go func() {
+		scheduler.Calculator(context.Background(), express, nil)
+		close(done)
+	}()
+	stepThrough(t, clock, express.Express, []int{2, 1, 1})
+	<-done
+
+	if _, value, err := express.State(); err != nil || value != 16 {
+		t.Fatalf("got %v, %v, want 16", value, err)
+	}
+
+	var (
+		operations = express.Operations()
+		workers    = map[int][]string{}
+	)
+	for _, operation := range operations {
+		workers[operation.Worker] = append(workers[operation.Worker], operation.Operator)
+	}
+	slices.SortStableFunc(operations, func(a, b rest.OperationRecord) int { return a.Start.Compare(b.Start) })
+
+	// Сложения выполняются одновременно разными вычислителями, остальные операции
+	// занимают освободившийся вычислитель с наименьшим номером
+	if len(operations) != 4 || !slices.Equal(workers[0], []string{"+", "*", "-"}) || !slices.Equal(workers[1], []string{"+"}) {
+		t.Fatalf("got operations by worker %v", workers)
+	}
+
+	var starts = []time.Duration{0, 0, 500 * time.Millisecond, 1500 * time.Millisecond}
+	for i, operation := range operations {
+		if start := operation.Start.Sub(epoch); start != starts[i] {
+			t.Errorf("%s starts at %s, want %s", operation.Operator, start, starts[i])
+		}
+		if duration := operation.End.Sub(operation.Start); duration != scheduler.Timings().Get(operation.Operator) {
+			t.Errorf("%s takes %s", operation.Operator, duration)
+		}
+	}
+}
+
+func TestVariables(t *testing.T) {
+	var scheduler = noDelay()
+
+	var variables = map[string]float64{"price": 2.5, "qty": 4, "tax": 1, "unused": 7}
+
+	tree, err := ParseWith("price * qty + tax", variables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := scheduler.Mathematician(tree)
+	if err != nil {
+		t.Fatal(err)
+	} else if got != 11 {
+		t.Errorf("price * qty + tax = %v, want 11", got)
+	}
+
+	bindings, err := Bindings("max(price, qty) - tax", variables)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(bindings) != 3 || bindings["price"] != 2.5 || bindings["qty"] != 4 || bindings["tax"] != 1 {
+		t.Errorf("unexpected bindings %v", bindings)
+	}
+
+	if _, err = ParseWith("price * count", variables); err == nil {
+		t.Error("unknown variable count must not be resolved")
+	}
+
+	for _, name := range []string{"", "1a", "a b", "max", "a+b"} {
+		if CheckVariableName(name) == nil {
+			t.Errorf("%q must not be a valid variable name", name)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	var scheduler = noDelay()
+
+	tree, err := Parse("$a * 2 + $b_2 - $a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refs := References(tree); !slices.Equal(refs, []string{"a", "b_2"}) {
+		t.Errorf("got references %v, want [a b_2]", refs)
+	}
+
+	if err = Resolve(tree, map[string]float64{"a": 3}); err == nil {
+		t.Error("unresolved reference $b_2 must be reported")
+	}
+
+	if err = Resolve(tree, map[string]float64{"a": 3, "b_2": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := scheduler.Mathematician(tree)
+	if err != nil {
+		t.Fatal(err)
+	} else if got != 4 {
+		t.Errorf("$a * 2 + $b_2 - $a = %v, want 4", got)
+	}
+
+	if _, err = Parse("2 + $"); err == nil {
+		t.Error("$ without an expression ID must be rejected")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	var tests = []struct {
+		expr     string
+		position int
+	}{
+		{"2+", 2},
+		{"2**3", 2},
+		{"*3", 0},
+		{"()", 1},
+		{"2(3)", 1},
+		{"2 3", 2},
+		{"2^", 2},
+		{"2a", 1},
+		{"(2+3", 0},
+		{"2+3)", 3},
+		{"2+(3*)", 5},
+		{"1.2.3", 0},
+		{"2 + ы", 4},
+		{"foo(1)", 0},
+		{"2 + sqrt(1, 2)", 4},
+		{"max()", 0},
+		{"pow(2)", 0},
+		{"abs 2", 0},
+		{"max(1,)", 6},
+		{"max(1, 2", 3},
+		{"(1, 2)", 2},
+		{"2 * price", 4},
+	}
+
+	for _, test := range tests {
+		var _, err = Parse(test.expr)
+
+		syntaxErr, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("%s: expected a syntax error, got %v", test.expr, err)
+			continue
+		}
+
+		if syntaxErr.Position != test.position {
+			t.Errorf("%s: %v, want position %d", test.expr, err, test.position)
+		}
+	}
+}
+
+func TestSchedulerWorkers(t *testing.T) {
+	var scheduler = NewScheduler(NewTimings(), 1)
+	if !scheduler.Acquire() {
+		t.Fatal("the first calculation must start")
+	}
+
+	var acquired = make(chan bool)
+	go func() { acquired <- scheduler.Acquire() }()
+
+	select {
+	case <-acquired:
+		t.Fatal("the second calculation must wait for a free worker")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	scheduler.Release()
+	if !<-acquired {
+		t.Fatal("the second calculation must start after the first one")
+	}
+
+	go func() { acquired <- scheduler.Acquire() }()
+	scheduler.Stop()
+	if <-acquired {
+		t.Error("a waiting calculation must not start after Stop")
+	}
+
+	scheduler.Release()
+	if err := scheduler.Wait(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
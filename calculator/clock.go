@@ -0,0 +1,124 @@
+package calculator
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Clock Источник времени вычислителя: по нему выдерживается и измеряется время выполнения операций
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// RealClock Системное время
+type RealClock struct{}
+
+// Now Возвращает текущее время
+func (RealClock) Now() time.Time { return time.Now() }
+
+// Sleep Ждёт d
+func (RealClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// FakeClock Время, которое идёт только при вызове Advance или AdvanceNext. Sleep ждёт,
+// пока время не передвинут до окончания сна, поэтому тесты не ждут реальное время операций.
+type FakeClock struct {
+	mu       sync.Mutex
+	changed  *sync.Cond // Оповещает о новых спящих
+	now      time.Time
+	sleepers []sleeper
+}
+
+// sleeper Ожидание окончания сна
+type sleeper struct {
+	deadline time.Time
+	wake     chan struct{}
+}
+
+// NewFakeClock Создаёт время, остановленное на now
+func NewFakeClock(now time.Time) *FakeClock {
+	var clock = &FakeClock{now: now}
+	clock.changed = sync.NewCond(&clock.mu)
+
+	return clock
+}
+
+// Now Возвращает текущее время
+func (clock *FakeClock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	return clock.now
+}
+
+// Sleep Ждёт, пока время не передвинут на d. При d <= 0 возвращается сразу.
+func (clock *FakeClock) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	clock.mu.Lock()
+	var s = sleeper{deadline: clock.now.Add(d), wake: make(chan struct{})}
+	clock.sleepers = append(clock.sleepers, s)
+	clock.changed.Broadcast()
+	clock.mu.Unlock()
+
+	<-s.wake
+}
+
+// Sleepers Возвращает число вызовов Sleep, которые ждут в данный момент
+func (clock *FakeClock) Sleepers() int {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	return len(clock.sleepers)
+}
+
+// BlockUntil Ждёт, пока не уснут хотя бы n вызовов Sleep
+func (clock *FakeClock) BlockUntil(n int) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	for len(clock.sleepers) < n {
+		clock.changed.Wait()
+	}
+}
+
+// Advance Передвигает время на d и будит вызовы Sleep, сон которых закончился
+func (clock *FakeClock) Advance(d time.Duration) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	clock.now = clock.now.Add(d)
+	clock.wake()
+}
+
+// AdvanceNext Передвигает время к ближайшему окончанию сна и возвращает, на сколько оно передвинуто.
+// Если никто не спит, время не меняется.
+func (clock *FakeClock) AdvanceNext() time.Duration {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	if len(clock.sleepers) == 0 {
+		return 0
+	}
+
+	var next = slices.MinFunc(clock.sleepers, func(a, b sleeper) int { return a.deadline.Compare(b.deadline) })
+	var step = next.deadline.Sub(clock.now)
+	clock.now = next.deadline
+	clock.wake()
+
+	return step
+}
+
+// wake Будит вызовы Sleep, сон которых закончился. Вызывается под mu.
+func (clock *FakeClock) wake() {
+	clock.sleepers = slices.DeleteFunc(clock.sleepers, func(s sleeper) bool {
+		if s.deadline.After(clock.now) {
+			return false
+		}
+		close(s.wake)
+		return true
+	})
+}
@@ -0,0 +1,94 @@
+package calculator
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/rest"
+	"math"
+	"time"
+)
+
+// Function Встроенная функция, доступная в выражениях
+type Function struct {
+	MinArgs  int                                    // Минимальное число аргументов
+	MaxArgs  int                                    // Максимальное число аргументов, -1 - без ограничения
+	ExecTime time.Duration                          // Время выполнения по умолчанию
+	Apply    func(args ...float64) (float64, error) // Вычисление значения функции
+}
+
+// Functions Реестр встроенных функций по их названию
+var Functions = map[string]*Function{
+	"abs":   unary(500*time.Millisecond, math.Abs),
+	"floor": unary(500*time.Millisecond, math.Floor),
+	"ceil":  unary(500*time.Millisecond, math.Ceil),
+	"round": unary(500*time.Millisecond, math.Round),
+	"sin":   unary(1000*time.Millisecond, math.Sin),
+	"cos":   unary(1000*time.Millisecond, math.Cos),
+	"sqrt": {MinArgs: 1, MaxArgs: 1, ExecTime: 1000 * time.Millisecond, Apply: func(args ...float64) (float64, error) {
+		if args[0] < 0 {
+			return 0, rest.NewError("Square root of a negative number: %s", rest.FormatValue(args[0]))
+		}
+		return math.Sqrt(args[0]), nil
+	}},
+	"log": {MinArgs: 1, MaxArgs: 2, ExecTime: 1000 * time.Millisecond, Apply: func(args ...float64) (float64, error) {
+		if args[0] <= 0 {
+			return 0, rest.NewError("Logarithm of a non-positive number: %s", rest.FormatValue(args[0]))
+		}
+		if len(args) == 1 {
+			return math.Log(args[0]), nil
+		}
+		if args[1] <= 0 || args[1] == 1 {
+			return 0, rest.NewError("Invalid logarithm base: %s", rest.FormatValue(args[1]))
+		}
+		return math.Log(args[0]) / math.Log(args[1]), nil
+	}},
+	"pow": {MinArgs: 2, MaxArgs: 2, ExecTime: 2000 * time.Millisecond, Apply: func(args ...float64) (float64, error) {
+		var result = math.Pow(args[0], args[1])
+		if math.IsNaN(result) || math.IsInf(result, 0) {
+			return 0, rest.NewError("Invalid exponentiation: %s ^ %s", rest.FormatValue(args[0]), rest.FormatValue(args[1]))
+		}
+		return result, nil
+	}},
+	"min": {MinArgs: 1, MaxArgs: -1, ExecTime: 500 * time.Millisecond, Apply: func(args ...float64) (float64, error) {
+		var result = args[0]
+		for _, arg := range args[1:] {
+			result = math.Min(result, arg)
+		}
+		return result, nil
+	}},
+	"max": {MinArgs: 1, MaxArgs: -1, ExecTime: 500 * time.Millisecond, Apply: func(args ...float64) (float64, error) {
+		var result = args[0]
+		for _, arg := range args[1:] {
+			result = math.Max(result, arg)
+		}
+		return result, nil
+	}},
+}
+
+// Функции доступны в /math под своими названиями, их время добавляет NewTimings
+func init() {
+	for name := range Functions {
+		OperationNames[name] = name
+	}
+}
+
+// unary Создаёт функцию одного аргумента, которая не может завершиться ошибкой
+func unary(execTime time.Duration, apply func(float64) float64) *Function {
+	return &Function{MinArgs: 1, MaxArgs: 1, ExecTime: execTime, Apply: func(args ...float64) (float64, error) {
+		return apply(args[0]), nil
+	}}
+}
+
+// CheckArity Проверяет, что функции передано допустимое число аргументов
+func (function *Function) CheckArity(name string, count int) error {
+	switch {
+	case count < function.MinArgs && function.MinArgs == function.MaxArgs:
+		return rest.NewError("Function %s expects %d argument(s), got %d", name, function.MinArgs, count)
+	case count < function.MinArgs:
+		return rest.NewError("Function %s expects at least %d argument(s), got %d", name, function.MinArgs, count)
+	case function.MaxArgs != -1 && count > function.MaxArgs && function.MinArgs == function.MaxArgs:
+		return rest.NewError("Function %s expects %d argument(s), got %d", name, function.MaxArgs, count)
+	case function.MaxArgs != -1 && count > function.MaxArgs:
+		return rest.NewError("Function %s expects at most %d argument(s), got %d", name, function.MaxArgs, count)
+	}
+
+	return nil
+}
@@ -0,0 +1,198 @@
+package calculator
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/rest"
+	"slices"
+)
+
+// operand Операнд операции графа: число или результат другой операции
+type operand struct {
+	value  float64
+	source *task // Операция, результат которой подставляется, nil для числа
+	negate bool  // Смена знака результата, выполняется без задержки
+}
+
+// get Возвращает значение операнда. Результат source должен быть уже вычислен.
+func (op operand) get() float64 {
+	var value = op.value
+	if op.source != nil {
+		value = op.source.result
+	}
+	if op.negate {
+		return -value
+	}
+
+	return value
+}
+
+// task Операция графа: бинарная операция или вызов функции
+type task struct {
+	operator   string // Символ операции или имя функции
+	call       bool   // Вызов функции, иначе бинарная операция
+	operands   []operand
+	dependents []*task // Операции, которые ждут результат этой
+	waiting    int     // Число операндов, результаты которых ещё не вычислены
+	result     float64
+}
+
+// graph Граф операций выражения. Операция готова к выполнению, когда вычислены все её операнды.
+type graph struct {
+	tasks []*task // В порядке обхода дерева слева направо
+	root  operand // Результат выражения
+}
+
+// newGraph Строит граф операций из дерева выражения. Скобки задают только порядок операций
+// и в граф не попадают.
+func newGraph(tree Node) (*graph, error) {
+	var g = &graph{}
+	root, err := g.add(tree)
+	if err != nil {
+		return nil, err
+	}
+	g.root = root
+
+	return g, nil
+}
+
+// add Добавляет в граф операции поддерева и возвращает его результат как операнд
+func (g *graph) add(tree Node) (operand, error) {
+	switch node := tree.(type) {
+	case *Number:
+		return operand{value: node.Value}, nil
+
+	case *Variable:
+		return operand{value: node.Value}, nil
+
+	case *Reference:
+		return operand{value: node.Value}, nil
+
+	case *Group:
+		return g.add(node.Inner)
+
+	case *Unary:
+		var op, err = g.add(node.Operand)
+		if err != nil || node.Operator == "+" {
+			return op, err
+		}
+		if op.source == nil {
+			op.value = -op.value
+		} else {
+			op.negate = !op.negate
+		}
+		return op, nil
+
+	case *Binary:
+		return g.task(node.Operator, false, node.Left, node.Right)
+
+	case *Call:
+		return g.task(node.Name, true, node.Args...)
+
+	default:
+		return operand{}, rest.NewError("Incorrect expression")
+	}
+}
+
+// task Добавляет операцию над поддеревьями args и возвращает её результат как операнд
+func (g *graph) task(operator string, call bool, args ...Node) (operand, error) {
+	var t = &task{operator: operator, call: call, operands: make([]operand, len(args))}
+	for i, arg := range args {
+		var op, err = g.add(arg)
+		if err != nil {
+			return operand{}, err
+		}
+
+		if op.source != nil {
+			op.source.dependents = append(op.source.dependents, t)
+			t.waiting++
+		}
+		t.operands[i] = op
+	}
+	g.tasks = append(g.tasks, t)
+
+	return operand{source: t}, nil
+}
+
+// finished Выполненная операция графа
+type finished struct {
+	task   *task
+	worker int
+	err    error
+}
+
+// evaluate Вычисляет граф операций дерева: каждая операция запускается отдельно, как только вычислены
+// её операнды, поэтому независимые операции выполняются одновременно. Операция занимает вычислитель
+// с наименьшим свободным номером. После первой ошибки новые операции не запускаются, а выполняющиеся дожидаются.
+func (scheduler *Scheduler) evaluate(calc *calculation, tree Node) (float64, error) {
+	var g, err = newGraph(tree)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		done    = make(chan finished)
+		running int
+		free    []int // Освободившиеся номера вычислителей
+		workers int   // Число использованных номеров
+	)
+	var start = func(t *task) {
+		var worker = workers
+		if len(free) != 0 {
+			worker, free = free[0], free[1:]
+		} else {
+			workers++
+		}
+
+		running++
+		go func() {
+			var value, err = scheduler.run(calc.on(worker), t)
+			t.result = value
+			done <- finished{task: t, worker: worker, err: err}
+		}()
+	}
+
+	for _, t := range g.tasks {
+		if t.waiting == 0 {
+			start(t)
+		}
+	}
+
+	for running != 0 {
+		var result = <-done
+		running--
+		free = append(free, result.worker)
+		slices.Sort(free)
+
+		if result.err != nil && err == nil {
+			err = result.err
+		}
+		if err != nil {
+			continue
+		}
+
+		for _, dependent := range result.task.dependents {
+			if dependent.waiting--; dependent.waiting == 0 {
+				start(dependent)
+			}
+		}
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return g.root.get(), nil
+}
+
+// run Выполняет операцию графа над вычисленными операндами
+func (scheduler *Scheduler) run(calc *calculation, t *task) (float64, error) {
+	var values = make([]float64, len(t.operands))
+	for i, op := range t.operands {
+		values[i] = op.get()
+	}
+
+	if t.call {
+		return scheduler.caller(calc, t.operator, values...)
+	}
+
+	return scheduler.waiter(calc, values[0], values[1], t.operator)
+}
@@ -0,0 +1,112 @@
+package calculator
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenNumber tokenKind = iota
+	tokenOperator
+	tokenIdent
+	tokenReference
+	tokenOpen
+	tokenClose
+	tokenComma
+	tokenEnd
+)
+
+// token Лексема выражения и её позиция в строке
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// operatorSymbols Символы операций, самые длинные проверяются первыми
+var operatorSymbols = []string{"//", "+", "-", "*", "/", "%", "^"}
+
+// tokenize Разбивает выражение на числа, операции и скобки
+func tokenize(expr string) ([]token, error) {
+	var tokens = make([]token, 0, len(expr))
+
+	for i := 0; i < len(expr); {
+		var char = expr[i]
+
+		switch {
+		case char == ' ' || char == '\t' || char == '\n' || char == '\r':
+			i++
+
+		case char == '(':
+			tokens = append(tokens, token{kind: tokenOpen, text: "(", pos: i})
+			i++
+
+		case char == ')':
+			tokens = append(tokens, token{kind: tokenClose, text: ")", pos: i})
+			i++
+
+		case char == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: i})
+			i++
+
+		case char == '$':
+			var start = i
+			for i++; i < len(expr) && (isLetter(expr[i]) || isDigit(expr[i])); i++ {
+			}
+
+			if i == start+1 {
+				return nil, newSyntaxError(expr, start, "Expression ID expected after $")
+			}
+
+			tokens = append(tokens, token{kind: tokenReference, text: expr[start:i], pos: start})
+
+		case isLetter(char):
+			var start = i
+			for i < len(expr) && (isLetter(expr[i]) || isDigit(expr[i])) {
+				i++
+			}
+
+			tokens = append(tokens, token{kind: tokenIdent, text: expr[start:i], pos: start})
+
+		case isDigit(char) || char == '.':
+			var start = i
+			for i < len(expr) && (isDigit(expr[i]) || expr[i] == '.') {
+				i++
+			}
+
+			tokens = append(tokens, token{kind: tokenNumber, text: expr[start:i], pos: start})
+
+		default:
+			var symbol = matchOperator(expr[i:])
+			if symbol == "" {
+				var foreign, _ = utf8.DecodeRuneInString(expr[i:])
+				return nil, newSyntaxError(expr, i, "Foreign character detected: %s", string(foreign))
+			}
+
+			tokens = append(tokens, token{kind: tokenOperator, text: symbol, pos: i})
+			i += len(symbol)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEnd, pos: len(expr)}), nil
+}
+
+func isDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
+
+func isLetter(char byte) bool {
+	return char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char == '_'
+}
+
+func matchOperator(expr string) string {
+	for _, symbol := range operatorSymbols {
+		if strings.HasPrefix(expr, symbol) {
+			return symbol
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,392 @@
+package calculator
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/rest"
+	"fmt"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Node Узел дерева разбора выражения
+type Node interface {
+	node()
+}
+
+// Number Число
+type Number struct {
+	Value float64
+}
+
+// Binary Бинарная операция над двумя операндами
+type Binary struct {
+	Operator    string
+	Left, Right Node
+}
+
+// Unary Унарный плюс или минус перед операндом
+type Unary struct {
+	Operator string
+	Operand  Node
+}
+
+// Variable Именованная переменная, значение подставляется при разборе
+type Variable struct {
+	Name  string
+	Value float64
+}
+
+// Reference Ссылка на результат другого выражения пользователя по его ID
+type Reference struct {
+	ID    string
+	Value float64
+}
+
+// Call Вызов встроенной функции
+type Call struct {
+	Name string
+	Args []Node
+}
+
+// Group Выражение в скобках. Скобки задают только порядок операций: при построении графа
+// операций в graph.go группа не даёт своего узла, её операции становятся узлами общего графа.
+type Group struct {
+	Inner Node
+}
+
+func (*Number) node()    {}
+func (*Binary) node()    {}
+func (*Unary) node()     {}
+func (*Call) node()      {}
+func (*Variable) node()  {}
+func (*Reference) node() {}
+func (*Group) node()     {}
+
+// SyntaxError Ошибка разбора выражения с позицией символа (с нуля), на котором она обнаружена
+type SyntaxError struct {
+	Message  string
+	Position int
+}
+
+func (err *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at position %d", err.Message, err.Position)
+}
+
+// newSyntaxError Создаёт ошибку, переводя смещение в байтах в номер символа
+func newSyntaxError(expr string, offset int, format string, values ...interface{}) *SyntaxError {
+	return &SyntaxError{
+		Message:  fmt.Sprintf(format, values...),
+		Position: utf8.RuneCountInString(expr[:offset]),
+	}
+}
+
+// precedence Приоритет операции и её ассоциативность
+type precedence struct {
+	level      int
+	rightAssoc bool
+}
+
+// operators Приоритеты всех поддерживаемых бинарных операций
+var operators = map[string]precedence{
+	"+":  {level: 1},
+	"-":  {level: 1},
+	"*":  {level: 2},
+	"/":  {level: 2},
+	"//": {level: 2},
+	"%":  {level: 2},
+	"^":  {level: 3, rightAssoc: true},
+}
+
+// unaryLevel Унарные операции связывают слабее возведения в степень: -2^2 = -(2^2)
+const unaryLevel = 3
+
+type parser struct {
+	expr      string
+	tokens    []token
+	index     int
+	variables map[string]float64
+}
+
+// Parse Разбирает выражение в дерево с учётом приоритета и ассоциативности операций
+func Parse(expr string) (Node, error) {
+	return ParseWith(expr, nil)
+}
+
+// ParseWith Разбирает выражение, подставляя значения переменных
+func ParseWith(expr string, variables map[string]float64) (Node, error) {
+	var tokens, err = tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	var p = &parser{expr: expr, tokens: tokens, variables: variables}
+
+	tree, err := p.parseExpression(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokenEnd {
+		return nil, p.unexpected(tok)
+	}
+
+	return tree, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.index]
+}
+
+func (p *parser) next() token {
+	var tok = p.tokens[p.index]
+	if tok.kind != tokenEnd {
+		p.index++
+	}
+
+	return tok
+}
+
+// parseExpression Разбирает операции с приоритетом не ниже minLevel
+func (p *parser) parseExpression(minLevel int) (Node, error) {
+	var left, err = p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var tok = p.peek()
+		if tok.kind != tokenOperator || operators[tok.text].level < minLevel {
+			return left, nil
+		}
+		p.next()
+
+		var operator = operators[tok.text]
+		var nextLevel = operator.level + 1
+		if operator.rightAssoc {
+			nextLevel = operator.level
+		}
+
+		right, err := p.parseExpression(nextLevel)
+		if err != nil {
+			return nil, err
+		}
+
+		left = &Binary{Operator: tok.text, Left: left, Right: right}
+	}
+}
+
+// parseOperand Разбирает число, выражение в скобках или операнд с унарным знаком
+func (p *parser) parseOperand() (Node, error) {
+	var tok = p.next()
+
+	switch tok.kind {
+	case tokenNumber:
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, newSyntaxError(p.expr, tok.pos, "Invalid number %s", tok.text)
+		}
+
+		return &Number{Value: value}, nil
+
+	case tokenOpen:
+		inner, err := p.parseExpression(1)
+		if err != nil {
+			return nil, err
+		}
+
+		if closing := p.next(); closing.kind == tokenEnd {
+			return nil, newSyntaxError(p.expr, tok.pos, "Extra open parenthesis")
+		} else if closing.kind != tokenClose {
+			return nil, p.unexpected(closing)
+		}
+
+		return &Group{Inner: inner}, nil
+
+	case tokenReference:
+		return &Reference{ID: tok.text[1:]}, nil
+
+	case tokenIdent:
+		if p.peek().kind == tokenOpen {
+			return p.parseCall(tok)
+		}
+
+		return p.parseVariable(tok)
+
+	case tokenOperator:
+		if tok.text != "+" && tok.text != "-" {
+			return nil, newSyntaxError(p.expr, tok.pos, "Operand expected, found %s", tok.text)
+		}
+
+		operand, err := p.parseExpression(unaryLevel)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Unary{Operator: tok.text, Operand: operand}, nil
+
+	case tokenEnd:
+		return nil, newSyntaxError(p.expr, tok.pos, "Too few arguments")
+
+	default:
+		return nil, newSyntaxError(p.expr, tok.pos, "Operand expected, found %s", tok.text)
+	}
+}
+
+// parseVariable Подставляет значение переменной
+func (p *parser) parseVariable(name token) (Node, error) {
+	if value, ok := p.variables[name.text]; ok {
+		return &Variable{Name: name.text, Value: value}, nil
+	}
+
+	if _, ok := Functions[name.text]; ok {
+		return nil, newSyntaxError(p.expr, name.pos, "Function %s must be followed by (", name.text)
+	}
+
+	return nil, newSyntaxError(p.expr, name.pos, "Unknown variable %s", name.text)
+}
+
+// parseCall Разбирает вызов функции с аргументами через запятую и проверяет их число
+func (p *parser) parseCall(name token) (Node, error) {
+	var function, ok = Functions[name.text]
+	if !ok {
+		return nil, newSyntaxError(p.expr, name.pos, "Unknown function %s", name.text)
+	}
+
+	var open = p.next()
+
+	var args = make([]Node, 0, max(function.MinArgs, 1))
+	if p.peek().kind == tokenClose {
+		p.next()
+	} else {
+		for {
+			arg, err := p.parseExpression(1)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+
+			var tok = p.next()
+			if tok.kind == tokenClose {
+				break
+			} else if tok.kind == tokenEnd {
+				return nil, newSyntaxError(p.expr, open.pos, "Extra open parenthesis")
+			} else if tok.kind != tokenComma {
+				return nil, p.unexpected(tok)
+			}
+		}
+	}
+
+	if err := function.CheckArity(name.text, len(args)); err != nil {
+		return nil, newSyntaxError(p.expr, name.pos, "%s", err)
+	}
+
+	return &Call{Name: name.text, Args: args}, nil
+}
+
+// unexpected Возвращает ошибку для лексемы, которая не может следовать за операндом
+func (p *parser) unexpected(tok token) error {
+	switch tok.kind {
+	case tokenClose:
+		return newSyntaxError(p.expr, tok.pos, "Extra closed parenthesis")
+	case tokenComma:
+		return newSyntaxError(p.expr, tok.pos, "Unexpected comma")
+	default:
+		return newSyntaxError(p.expr, tok.pos, "Missing operator before %s", tok.text)
+	}
+}
+
+// Operations Возвращает операции дерева в порядке их выполнения
+func Operations(tree Node) []string {
+	switch node := tree.(type) {
+	case *Binary:
+		return append(append(Operations(node.Left), Operations(node.Right)...), node.Operator)
+	case *Unary:
+		return Operations(node.Operand)
+	case *Call:
+		var operations []string
+		for _, arg := range node.Args {
+			operations = append(operations, Operations(arg)...)
+		}
+		return append(operations, node.Name)
+	case *Group:
+		return Operations(node.Inner)
+	default:
+		return nil
+	}
+}
+
+// Variables Возвращает значения переменных, использованных в дереве
+func Variables(tree Node) map[string]float64 {
+	var variables = map[string]float64{}
+
+	walk(tree, func(node Node) {
+		if variable, ok := node.(*Variable); ok {
+			variables[variable.Name] = variable.Value
+		}
+	})
+
+	return variables
+}
+
+// References Возвращает ID выражений, на которые ссылается дерево, в порядке появления
+func References(tree Node) []string {
+	var ids []string
+
+	walk(tree, func(node Node) {
+		if reference, ok := node.(*Reference); ok && !slices.Contains(ids, reference.ID) {
+			ids = append(ids, reference.ID)
+		}
+	})
+
+	return ids
+}
+
+// Resolve Подставляет в дерево результаты выражений, на которые оно ссылается
+func Resolve(tree Node, results map[string]float64) error {
+	var err error
+
+	walk(tree, func(node Node) {
+		if reference, ok := node.(*Reference); ok {
+			if value, found := results[reference.ID]; found {
+				reference.Value = value
+			} else if err == nil {
+				err = rest.NewError("Expression $%s has no result", reference.ID)
+			}
+		}
+	})
+
+	return err
+}
+
+// walk Обходит все узлы дерева
+func walk(tree Node, visit func(Node)) {
+	visit(tree)
+
+	switch node := tree.(type) {
+	case *Binary:
+		walk(node.Left, visit)
+		walk(node.Right, visit)
+	case *Unary:
+		walk(node.Operand, visit)
+	case *Call:
+		for _, arg := range node.Args {
+			walk(arg, visit)
+		}
+	case *Group:
+		walk(node.Inner, visit)
+	}
+}
+
+// CheckVariableName Проверяет, что имя подходит для переменной
+func CheckVariableName(name string) error {
+	var tokens, err = tokenize(name)
+	if err != nil || len(tokens) != 2 || tokens[0].kind != tokenIdent {
+		return rest.NewError("Invalid variable name %q: letters, digits and _ are allowed, starting with a letter or _", name)
+	}
+
+	if _, ok := Functions[name]; ok {
+		return rest.NewError("Invalid variable name %q: it is a function name", name)
+	}
+
+	return nil
+}
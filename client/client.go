@@ -1,12 +1,16 @@
 package client
 
 import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/calculator"
 	"Distributed-arithmetic-expression-evaluator-version-2.0/database"
 	"Distributed-arithmetic-expression-evaluator-version-2.0/expressions"
+	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"sync"
+	"time"
 )
 
 // Client структура представляет клиента системы с его личными данными и выражениями.
@@ -18,73 +22,75 @@ type Client struct {
 }
 
 // NewClient создает новый экземпляр клиента, проверяя, что обязательные поля не пустые.
-func NewClient(db *database.DB, name, password string) (*Client, error) {
+// Выражения клиента вычисляет scheduler.
+func NewClient(store database.Store, scheduler *calculator.Scheduler, name, password string) (*Client, error) {
 	if name == "" || password == "" {
 		return nil, errors.New("name, password and secret cannot be empty") // валидация входных данных
 	}
 
-	dBUser, err := db.CreateUser(name, password) // создание пользователя
+	dBUser, err := store.CreateUser(name, password) // создание пользователя
 	if err != nil {
 		return nil, err
 	}
 
+	var collection = expressions.NewExpressions(scheduler) // инициализация новой коллекции выражений
+	collection.SetStore(name, store)
+
 	return &Client{
 		name:        name,
 		password:    password,
-		Expressions: expressions.NewExpressions(), // инициализация новой коллекции выражений
+		Expressions: collection,
 		secret:      dBUser.Secret,
 	}, nil
 }
 
-func GetClient(db *database.DB, name string) (*Client, error) {
-	if db == nil {
-		return nil, errors.New("database connection is nil")
+// GetClient загружает клиента для проверки и выдачи токенов. Выражения клиента не загружаются:
+// они загружаются и вычисляются один раз в NewClients.
+func GetClient(store database.UserStore, name string) (*Client, error) {
+	if store == nil {
+		return nil, errors.New("store is nil")
 	}
 
-	var (
-		expression *expressions.Expressions // выражение, которое будет использовано для генерации токена
-		user, err  = db.GetUser(name)
-	)
+	var user, err = store.GetUser(name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %v", err)
 	}
 
-	expression, err = db.GetExpressions(user.Name)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get expressions: %v", err)
-	}
-
 	client := &Client{
-		name:        user.Name,
-		password:    user.Password,
-		secret:      user.Secret,
-		Expressions: expression,
+		name:     user.Name,
+		password: user.Password,
+		secret:   user.Secret,
 	}
 
 	// Дальнейшая логика
 	return client, nil
 }
 
-// AddExpression добавляет новое выражение в коллекцию клиента и записывает в базу данных.
-func (c *Client) AddExpression(db *database.DB, ID, expr string) error {
-	objExpr, err := c.Expressions.AddExpression(ID, expr) // добавление выражения в коллекцию
-	if err != nil {
-		return err // обработка возможной ошибки
-	}
+// AddExpression добавляет новое выражение в коллекцию клиента, которая сама записывает его в базу данных.
+func (c *Client) AddExpression(ctx context.Context, ID, expr string, bindings map[string]float64) error {
+	_, err := c.Expressions.AddExpression(ctx, ID, expr, bindings) // добавление выражения в коллекцию
+	return err
+}
 
-	if err = db.AddExpression(objExpr, ID, c.name); err != nil {
-		return err // запись выражения в базу данных и обработка возможной ошибки
-	}
+// Name возвращает имя клиента.
+func (c *Client) Name() string {
+	return c.name
+}
 
-	return nil
+// CheckPassword сообщает, совпадает ли пароль с паролем клиента. Сравнение занимает одно и то же
+// время при любом несовпадении, чтобы по нему нельзя было подобрать пароль.
+func (c *Client) CheckPassword(password string) bool {
+	return subtle.ConstantTimeCompare([]byte(c.password), []byte(password)) == 1
 }
 
-// GenerateToken генерирует JWT токен для клиента.
-func (c *Client) GenerateToken() (string, error) {
-	var token = jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"name":     c.name, // использование имени и пароля в claims токена
-		"password": c.password,
-	})
+// GenerateToken генерирует JWT токен для клиента, действующий lifetime. При lifetime <= 0 токен бессрочный.
+func (c *Client) GenerateToken(lifetime time.Duration) (string, error) {
+	// Токен читается без секрета, поэтому в нём только имя клиента, но не пароль
+	var claims = jwt.MapClaims{"name": c.name}
+	if lifetime > 0 {
+		claims["exp"] = jwt.NewNumericDate(time.Now().Add(lifetime)) // срок действия проверяет VerifyToken
+	}
+	var token = jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	var tokenString, err = token.SignedString([]byte(c.secret)) // подпись токена секретом клиента
 	if err != nil {
@@ -94,6 +100,22 @@ func (c *Client) GenerateToken() (string, error) {
 	return tokenString, nil
 }
 
+// TokenName возвращает имя клиента, которому выдан токен, не проверяя подпись.
+// Подпись проверяется VerifyToken секретом этого клиента.
+func TokenName(tokenString string) (string, error) {
+	var token, _, err = jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return "", err
+	}
+
+	var name, ok = token.Claims.(jwt.MapClaims)["name"].(string)
+	if !ok || name == "" {
+		return "", fmt.Errorf("token has no name")
+	}
+
+	return name, nil
+}
+
 // VerifyToken проверяет валидность переданного токена.
 func (c *Client) VerifyToken(tokenString string) error {
 	var token, err = jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
@@ -123,8 +145,9 @@ type Clients struct {
 	Mu    sync.Mutex
 }
 
-func NewClients(db *database.DB) (*Clients, error) {
-	userNames, err := db.GetUsers()
+// NewClients загружает всех клиентов и их выражения из хранилища и запускает их вычисление в scheduler.
+func NewClients(store database.Store, scheduler *calculator.Scheduler) (*Clients, error) {
+	userNames, err := store.GetUsers()
 	if err != nil {
 		return nil, err
 	}
@@ -136,7 +159,7 @@ func NewClients(db *database.DB) (*Clients, error) {
 	)
 
 	for _, el := range userNames {
-		expression, err = db.GetExpressions(el.Name)
+		expression, err = expressions.Load(store, scheduler, el.Name)
 		if err != nil {
 			return nil, err
 		}
@@ -149,10 +172,29 @@ func NewClients(db *database.DB) (*Clients, error) {
 		}
 
 		names[el.Name] = webUser // добавление пользователя в коллекцию
+		scheduler.Logger().Debug("User loaded", "user", el.Name, "expressions", len(expression.GetExpressions()))
 	}
 
+	scheduler.Logger().Info("Users loaded", "users", len(names))
+
 	return &Clients{
 		Names: names,
 		Mu:    sync.Mutex{},
 	}, nil
 }
+
+// Get возвращает клиента по имени без обращения к базе данных.
+func (clients *Clients) Get(name string) (*Client, bool) {
+	clients.Mu.Lock()
+	defer clients.Mu.Unlock()
+
+	var client, ok = clients.Names[name]
+	return client, ok
+}
+
+// Add добавляет в коллекцию только что зарегистрированного клиента.
+func (clients *Clients) Add(client *Client) {
+	clients.Mu.Lock()
+	clients.Names[client.name] = client
+	clients.Mu.Unlock()
+}
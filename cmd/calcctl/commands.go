@@ -0,0 +1,483 @@
+package main
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/sdk"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// newFlagSet returns the flag set of a command
+func newFlagSet(name, usage string) *flag.FlagSet {
+	var flags = flag.NewFlagSet("calcctl "+name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: calcctl %s %s\n", name, usage)
+		flags.PrintDefaults()
+	}
+
+	return flags
+}
+
+// readPassword returns the password of the flag or the first line of stdin
+func readPassword(password string) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	var line, err = bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// credentials parses the flags of register and login
+func credentials(name string, args []string) (string, string, error) {
+	var (
+		flags    = newFlagSet(name, "-u USER [-p PASSWORD]")
+		username = flags.String("u", "", "username")
+		password = flags.String("p", "", "password, read from stdin if empty")
+	)
+	if err := flags.Parse(args); err != nil {
+		return "", "", err
+	}
+
+	if *username == "" {
+		flags.Usage()
+		return "", "", errors.New("the username is required")
+	}
+
+	var pass, err = readPassword(*password)
+	return *username, pass, err
+}
+
+func (app *app) register(ctx context.Context, args []string) error {
+	var username, password, err = credentials("register", args)
+	if err != nil {
+		return err
+	}
+
+	if err = app.client.Register(ctx, username, password); err != nil {
+		return err
+	}
+
+	fmt.Println("Registered", username)
+	return nil
+}
+
+func (app *app) login(ctx context.Context, args []string) error {
+	var username, password, err = credentials("login", args)
+	if err != nil {
+		return err
+	}
+
+	token, err := app.client.Login(ctx, username, password)
+	if err != nil {
+		return err
+	}
+
+	app.settings.Username, app.settings.Token = username, token
+	if err = app.settings.Save(app.path); err != nil {
+		return err
+	}
+
+	fmt.Println("Logged in as", username)
+	return nil
+}
+
+// bindings is a repeated name=value flag
+type bindings map[string]float64
+
+func (b bindings) String() string { return fmt.Sprint(map[string]float64(b)) }
+
+func (b bindings) Set(value string) error {
+	var name, number, ok = strings.Cut(value, "=")
+	if !ok {
+		return errors.New("must be name=value")
+	}
+
+	var parsed, err = strconv.ParseFloat(number, 64)
+	if err != nil {
+		return err
+	}
+
+	b[name] = parsed
+	return nil
+}
+
+// newID returns an ID for an expression submitted without one
+func newID(i int) string {
+	return "e" + strconv.FormatInt(time.Now().UnixMilli(), 36) + "-" + strconv.Itoa(i+1)
+}
+
+// readItems reads expressions one per line, either "id: expression" or a bare expression.
+// Empty lines and lines starting with # are skipped.
+func readItems(r io.Reader) ([]sdk.Item, error) {
+	var (
+		items   []sdk.Item
+		scanner = bufio.NewScanner(r)
+	)
+	for scanner.Scan() {
+		var line = strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var item = sdk.Item{Content: line}
+		if ID, content, ok := strings.Cut(line, ":"); ok && !strings.ContainsAny(ID, " \t") {
+			item = sdk.Item{ID: ID, Content: strings.TrimSpace(content)}
+		}
+		if item.ID == "" {
+			item.ID = newID(len(items))
+		}
+
+		items = append(items, item)
+	}
+
+	return items, scanner.Err()
+}
+
+func (app *app) submit(ctx context.Context, args []string) error {
+	var (
+		flags = newFlagSet("submit", "[-id ID] [-var name=value] [-wait] EXPRESSION | -f FILE | -")
+		ID    = flags.String("id", "", "ID of the expression, generated if empty")
+		file  = flags.String("f", "", `file of "id: expression" lines, - for stdin`)
+		wait  = flags.Bool("wait", false, "wait for the expressions to finish")
+		vars  = bindings{}
+	)
+	flags.Var(vars, "var", "variable of the expression as name=value, may be repeated")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 1 && flags.Arg(0) == "-" {
+		*file = "-"
+	}
+
+	var items []sdk.Item
+	switch {
+	case *file == "-":
+		var err error
+		if items, err = readItems(os.Stdin); err != nil {
+			return err
+		}
+	case *file != "":
+		var f, err = os.Open(*file)
+		if err != nil {
+			return err
+		}
+		items, err = readItems(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	case flags.NArg() != 0:
+		var item = sdk.Item{ID: *ID, Content: strings.Join(flags.Args(), " "), Bindings: vars}
+		if item.ID == "" {
+			item.ID = newID(0)
+		}
+		items = []sdk.Item{item}
+	default:
+		flags.Usage()
+		return errors.New("no expression given")
+	}
+
+	if len(items) == 0 {
+		return errors.New("no expressions to submit")
+	}
+
+	var response, err = app.client.SubmitBatch(ctx, items)
+	if err != nil {
+		return err
+	}
+
+	var accepted []string
+	for _, result := range response.Results {
+		if result.Error != nil {
+			fmt.Fprintf(os.Stderr, "%s: rejected: %v\n", result.ID, result.Error)
+			continue
+		}
+
+		fmt.Println(result.ID, result.Status)
+		accepted = append(accepted, result.ID)
+	}
+
+	if *wait && len(accepted) != 0 {
+		if err = app.waitAll(ctx, accepted); err != nil {
+			return err
+		}
+	}
+
+	if response.Rejected != 0 {
+		return fmt.Errorf("%d of %d expressions rejected", response.Rejected, len(items))
+	}
+
+	return nil
+}
+
+func (app *app) wait(ctx context.Context, args []string) error {
+	var flags = newFlagSet("wait", "ID...")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("no expression given")
+	}
+
+	return app.waitAll(ctx, flags.Args())
+}
+
+// waitAll waits for the expressions one by one and prints their results
+func (app *app) waitAll(ctx context.Context, IDs []string) error {
+	var failed int
+	for _, ID := range IDs {
+		var expression, err = app.waitProgress(ctx, ID)
+		if err != nil {
+			return err
+		}
+
+		printResult(expression)
+		if expression.Status == sdk.StatusFailed {
+			failed++
+		}
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("%d of %d expressions failed", failed, len(IDs))
+	}
+
+	return nil
+}
+
+// printResult prints the outcome of a finished expression
+func printResult(expression *sdk.Expression) {
+	switch {
+	case expression.Result != nil:
+		fmt.Printf("%s = %v\n", expression.ID, *expression.Result)
+	case expression.Error != "":
+		fmt.Printf("%s %s: %s\n", expression.ID, expression.Status, expression.Error)
+	default:
+		fmt.Println(expression.ID, expression.Status)
+	}
+}
+
+func (app *app) get(ctx context.Context, args []string) error {
+	var (
+		flags  = newFlagSet("get", "[-json] ID")
+		asJSON = flags.Bool("json", false, "print the expression as JSON")
+	)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("one expression must be given")
+	}
+
+	var expression, err = app.client.Get(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(expression)
+	}
+
+	var w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID:\t%s\n", expression.ID)
+	fmt.Fprintf(w, "Expression:\t%s\n", expression.Expression)
+	fmt.Fprintf(w, "Status:\t%s\n", expression.Status)
+	if expression.Result != nil {
+		fmt.Fprintf(w, "Result:\t%v\n", *expression.Result)
+	}
+	if expression.Error != "" {
+		fmt.Fprintf(w, "Error:\t%s\n", expression.Error)
+	}
+	fmt.Fprintf(w, "Created:\t%s\n", expression.Created.Local().Format(time.DateTime))
+	if expression.Finished != nil {
+		fmt.Fprintf(w, "Finished:\t%s\n", expression.Finished.Local().Format(time.DateTime))
+	}
+	fmt.Fprintf(w, "Best case:\t%s\n", expression.BestCase)
+	if expression.ETA != "" && !expression.IsFinished() {
+		fmt.Fprintf(w, "ETA:\t%s\n", expression.ETA)
+	}
+	if expression.Timeline != nil {
+		fmt.Fprintf(w, "Actual:\t%s\n", expression.Timeline.Actual)
+		for _, operation := range expression.Timeline.Operations {
+			var offset = operation.Start.Sub(expression.Timeline.Started).Round(time.Millisecond)
+			fmt.Fprintf(w, "  %s %v\t%s from +%s on worker %d\n",
+				operation.Operator, operation.Operands, operation.Duration, offset, operation.Worker)
+		}
+	}
+	if len(expression.Dependencies) != 0 {
+		fmt.Fprintf(w, "Dependencies:\t%s\n", strings.Join(expression.Dependencies, ", "))
+	}
+	if len(expression.Dependents) != 0 {
+		fmt.Fprintf(w, "Dependents:\t%s\n", strings.Join(expression.Dependents, ", "))
+	}
+
+	return w.Flush()
+}
+
+func (app *app) list(ctx context.Context, args []string) error {
+	var (
+		flags   = newFlagSet("list", "[flags]")
+		options sdk.ListOptions
+		status  = flags.String("status", "", "comma-separated statuses: waiting, computing, done, failed")
+		after   = flags.String("after", "", "only expressions created after the RFC 3339 date")
+		before  = flags.String("before", "", "only expressions created before the RFC 3339 date")
+		all     = flags.Bool("all", false, "fetch every page")
+		asJSON  = flags.Bool("json", false, "print the expressions as JSON")
+	)
+	flags.StringVar(&options.Contains, "q", "", "only expressions containing the text")
+	flags.StringVar(&options.Sort, "sort", "", "sort by created, finished or estimated")
+	flags.BoolVar(&options.Descending, "desc", false, "sort in descending order")
+	flags.IntVar(&options.Limit, "limit", 0, "expressions per page")
+	flags.StringVar(&options.Cursor, "cursor", "", "cursor of the page to fetch")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *status != "" {
+		options.Statuses = strings.Split(*status, ",")
+	}
+	for value, date := range map[string]*time.Time{*after: &options.CreatedAfter, *before: &options.CreatedBefore} {
+		if value == "" {
+			continue
+		}
+
+		var err error
+		if *date, err = time.Parse(time.RFC3339, value); err != nil {
+			return err
+		}
+	}
+
+	var (
+		items []sdk.Expression
+		next  string
+	)
+	for {
+		var page, err = app.client.List(ctx, options)
+		if err != nil {
+			return err
+		}
+
+		items, next = append(items, page.Items...), page.NextCursor
+		if !*all || next == "" {
+			break
+		}
+		options.Cursor = next
+	}
+
+	if *asJSON {
+		return printJSON(sdk.Page{Items: items, NextCursor: next})
+	}
+
+	var w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tRESULT\tCREATED\tEXPRESSION")
+	for _, expression := range items {
+		var result = expression.Error
+		if expression.Result != nil {
+			result = strconv.FormatFloat(*expression.Result, 'g', -1, 64)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", expression.ID, expression.Status, result,
+			expression.Created.Local().Format(time.DateTime), expression.Expression)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if next != "" {
+		fmt.Fprintln(os.Stderr, "More expressions: -cursor", next)
+	}
+
+	return nil
+}
+
+func (app *app) cancel(ctx context.Context, args []string) error {
+	var flags = newFlagSet("cancel", "ID...")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("no expression given")
+	}
+
+	var errs []error
+	for _, ID := range flags.Args() {
+		var expression, err = app.client.Cancel(ctx, ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ID, err))
+			continue
+		}
+
+		fmt.Println(expression.ID, expression.Status)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (app *app) timings(ctx context.Context, args []string) error {
+	var (
+		table map[string]string
+		err   error
+	)
+
+	switch {
+	case len(args) == 0:
+		table, err = app.client.Timings(ctx)
+	case args[0] == "set" && len(args) > 1:
+		var changes = make(map[string]string, len(args)-1)
+		for _, arg := range args[1:] {
+			var name, duration, ok = strings.Cut(arg, "=")
+			if !ok {
+				return fmt.Errorf("%q must be name=duration", arg)
+			}
+			changes[name] = duration
+		}
+		table, err = app.client.SetTimings(ctx, changes)
+	default:
+		return errors.New("usage: calcctl timings [set NAME=DURATION...]")
+	}
+	if err != nil {
+		return err
+	}
+
+	var names = make([]string, 0, len(table))
+	for name := range table {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t%s\n", name, table[name])
+	}
+
+	return w.Flush()
+}
+
+// printJSON prints the value as indented JSON
+func printJSON(value interface{}) error {
+	var encoder = json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,109 @@
+// Command calcctl manages expressions of the evaluator from the terminal
+package main
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/sdk"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const usage = `Usage: calcctl [-server URL] [-config FILE] <command> [arguments]
+
+Commands:
+  register -u USER [-p PASSWORD]      create a user
+  login -u USER [-p PASSWORD]         log in and remember the token
+  submit [-id ID] [-var a=1] [-wait] EXPRESSION
+  submit [-wait] -f FILE | -          submit "id: expression" lines of a file or stdin
+  wait ID...                          wait for expressions showing the progress
+  get ID                              show an expression
+  list [-status S] [-q TEXT] [-sort F] [-desc] [-limit N] [-all] [-json]
+  cancel ID...                        cancel unfinished expressions
+  timings                             show operation execution times
+  timings set NAME=DURATION...        change operation execution times
+
+The password is read from stdin when -p is not given.
+`
+
+// app holds the global options and the state shared by the commands
+type app struct {
+	path     string // Path of the config file
+	settings *Settings
+	client   *sdk.Client
+}
+
+func main() {
+	var ctx, stop = signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, "calcctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	var flags = flag.NewFlagSet("calcctl", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), usage) }
+
+	var (
+		server = flags.String("server", "", "URL of the server (default from the config file or http://localhost:8080)")
+		path   = flags.String("config", "", "config file (default $CALCCTL_CONFIG or the user config directory)")
+	)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+
+	var app = &app{path: *path}
+	if app.path == "" {
+		var err error
+		if app.path, err = DefaultSettingsPath(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if app.settings, err = LoadSettings(app.path); err != nil {
+		return err
+	}
+	if *server != "" {
+		app.settings.Server = *server
+	}
+
+	app.client = sdk.New(app.settings.Server)
+	app.client.SetToken(app.settings.Username, app.settings.Token)
+
+	var command, rest = flags.Arg(0), flags.Args()[1:]
+	switch command {
+	case "register":
+		return app.register(ctx, rest)
+	case "login":
+		return app.login(ctx, rest)
+	case "submit":
+		return app.submit(ctx, rest)
+	case "wait":
+		return app.wait(ctx, rest)
+	case "get":
+		return app.get(ctx, rest)
+	case "list":
+		return app.list(ctx, rest)
+	case "cancel":
+		return app.cancel(ctx, rest)
+	case "timings":
+		return app.timings(ctx, rest)
+	case "help":
+		flags.Usage()
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q, run calcctl help", command)
+	}
+}
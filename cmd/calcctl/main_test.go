@@ -0,0 +1,104 @@
+package main
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/calculator"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/database"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/sdk"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/server"
+	"context"
+	"errors"
+	"flag"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestServer starts a server computing every operation at once
+func newTestServer(t *testing.T) *httptest.Server {
+	s, err := server.New(server.Options{Store: database.NewMemory(), Timings: calculator.NewUniformTimings(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ts = httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func TestRun(t *testing.T) {
+	var (
+		ts     = newTestServer(t)
+		config = filepath.Join(t.TempDir(), "config.json")
+		ctx    = context.Background()
+	)
+
+	// The server given by -server is used by every command, the token is remembered by login
+	var commands = [][]string{
+		{"register", "-u", "name", "-p", "password"},
+		{"login", "-u", "name", "-p", "password"},
+		{"submit", "-id", "a", "-var", "x=2", "-wait", "2", "+", "x"},
+		{"get", "a"},
+		{"list", "-status", "done", "-json"},
+		{"timings"},
+	}
+	for _, args := range commands {
+		if err := run(ctx, append([]string{"-server", ts.URL, "-config", config}, args...)); err != nil {
+			t.Fatalf("%s: %v", strings.Join(args, " "), err)
+		}
+	}
+
+	settings, err := LoadSettings(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Username != "name" || settings.Token == "" {
+		t.Errorf("got settings %+v, want the token of name", settings)
+	}
+
+	var tests = []struct {
+		args []string
+		err  string
+	}{
+		{[]string{}, ""},
+		{[]string{"unknown"}, `unknown command "unknown"`},
+		{[]string{"login", "-p", "password"}, "the username is required"},
+		{[]string{"submit"}, "no expression given"},
+		{[]string{"submit", "-var", "x", "1"}, "must be name=value"},
+		{[]string{"get"}, "one expression must be given"},
+		{[]string{"get", "a", "b"}, "one expression must be given"},
+		{[]string{"wait"}, "no expression given"},
+		{[]string{"cancel"}, "no expression given"},
+		{[]string{"list", "-after", "yesterday"}, "cannot parse"},
+		{[]string{"timings", "set"}, "usage: calcctl timings"},
+		{[]string{"timings", "set", "addition"}, "must be name=duration"},
+	}
+	for _, test := range tests {
+		var err = run(ctx, append([]string{"-server", ts.URL, "-config", config}, test.args...))
+		switch {
+		case test.err == "" && !errors.Is(err, flag.ErrHelp):
+			t.Errorf("%q: got %v, want the usage", test.args, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%q: got %v, want %q", test.args, err, test.err)
+		}
+	}
+}
+
+func TestReadItems(t *testing.T) {
+	var items, err = readItems(strings.NewReader("a: 2 + 2\n\n# comment\nb:$a*2\n3 * 3\nx y: 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want = []sdk.Item{{ID: "a", Content: "2 + 2"}, {ID: "b", Content: "$a*2"}, {Content: "3 * 3"}, {Content: "x y: 1"}}
+	if len(items) != len(want) {
+		t.Fatalf("got %+v, want %+v", items, want)
+	}
+	for i, item := range items {
+		// Expressions without an ID get a generated one
+		if item.Content != want[i].Content || want[i].ID != "" && item.ID != want[i].ID || item.ID == "" {
+			t.Errorf("item %d: got %+v, want %+v", i, item, want[i])
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/sdk"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// barWidth is the number of cells of the progress bar
+const barWidth = 30
+
+// isTerminal tells whether the file is a terminal, so the progress bar can be redrawn in place
+func isTerminal(file *os.File) bool {
+	var info, err = file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// progressBar draws the elapsed time against the estimated calculation time.
+// The bar stops short of full until the expression is actually finished.
+func progressBar(ID, status string, elapsed, estimated time.Duration) string {
+	var filled = barWidth - 1
+	if estimated > 0 && elapsed < estimated {
+		filled = int(float64(barWidth) * float64(elapsed) / float64(estimated))
+	}
+
+	return fmt.Sprintf("%s [%s%s] %s / %s %s", ID, strings.Repeat("#", filled), strings.Repeat(".", barWidth-filled),
+		elapsed.Truncate(100*time.Millisecond), estimated, status)
+}
+
+// waitProgress waits for the expression. A progress bar is drawn on stderr if it is a terminal,
+// otherwise every change of the status is printed.
+func (app *app) waitProgress(ctx context.Context, ID string) (*sdk.Expression, error) {
+	var expression, err = app.client.Get(ctx, ID)
+	if err != nil || expression.IsFinished() {
+		return expression, err
+	}
+
+	type outcome struct {
+		expression *sdk.Expression
+		err        error
+	}
+	var done = make(chan outcome, 1)
+	go func() {
+		var expression, err = app.client.Wait(ctx, ID)
+		done <- outcome{expression, err}
+	}()
+
+	var (
+		terminal  = isTerminal(os.Stderr)
+		estimated = expression.EstimatedDuration()
+		ticker    = time.NewTicker(100 * time.Millisecond)
+	)
+	defer ticker.Stop()
+
+	if !terminal {
+		fmt.Fprintf(os.Stderr, "%s %s, estimated %s\n", ID, expression.Status, estimated)
+	}
+
+	for {
+		select {
+		case result := <-done:
+			if terminal {
+				fmt.Fprint(os.Stderr, "\r\033[K")
+			}
+			return result.expression, result.err
+		case <-ticker.C:
+			if terminal {
+				fmt.Fprint(os.Stderr, "\r\033[K"+progressBar(ID, expression.Status, time.Since(expression.Created), estimated))
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// DefaultServer is used until a server is given by -server or the config file
+const DefaultServer = "http://localhost:8080"
+
+// Settings are remembered between the runs of calcctl
+type Settings struct {
+	Server   string `json:"server"`
+	Username string `json:"username,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+// DefaultSettingsPath returns $CALCCTL_CONFIG or calcctl/config.json in the user config directory
+func DefaultSettingsPath() (string, error) {
+	if path := os.Getenv("CALCCTL_CONFIG"); path != "" {
+		return path, nil
+	}
+
+	var dir, err = os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "calcctl", "config.json"), nil
+}
+
+// LoadSettings reads the settings. A missing file gives the defaults.
+func LoadSettings(path string) (*Settings, error) {
+	var settings = &Settings{Server: DefaultServer}
+
+	var content, err = os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return settings, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(content, settings); err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+
+	return settings, nil
+}
+
+// Save writes the settings readable only by the user, since they hold the token.
+// They are written to a new file that replaces the old one, so an existing file with wider
+// permissions is not kept and a failed write leaves the old settings intact.
+func (settings *Settings) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	var content, err = json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// CreateTemp makes the file with 0600 permissions
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // Nothing is left to remove after the rename
+
+	if _, err = file.Write(append(content, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
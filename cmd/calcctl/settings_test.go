@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSettings_RoundTrip(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "calcctl", "config.json")
+
+	// A missing file gives the defaults
+	settings, err := LoadSettings(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *settings != (Settings{Server: DefaultServer}) {
+		t.Errorf("got %+v, want the defaults", settings)
+	}
+
+	var saved = Settings{Server: "http://example.com", Username: "name", Token: "token"}
+	if err = saved.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadSettings(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *loaded != saved {
+		t.Errorf("got %+v, want %+v", loaded, saved)
+	}
+
+	if entries, err := os.ReadDir(filepath.Dir(path)); err != nil || len(entries) != 1 {
+		t.Errorf("got %v and %v, want only the settings file", entries, err)
+	}
+}
+
+func TestSettings_SaveTightensPermissions(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"server": "http://localhost:8080"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The umask may have narrowed the mode of the new file
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var settings = Settings{Server: DefaultServer, Username: "name", Token: "token"}
+	if err := settings.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("the settings holding the token have mode %o, want 600", mode)
+	}
+}
+
+func TestLoadSettings_Invalid(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"server": `), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadSettings(path); err == nil {
+		t.Error("a malformed file must be rejected")
+	}
+}
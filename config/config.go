@@ -0,0 +1,518 @@
+package config
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/calculator"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/data"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/logging"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/tracing"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix starts the names of the environment variables read by Load
+const EnvPrefix = "CALC_"
+
+// Formats of configuration files
+const (
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+	FormatJSON = "json"
+)
+
+// Duration is a time.Duration written as a Go duration string ("750ms", "2s")
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	var duration, err = time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", text)
+	}
+
+	*d = Duration(duration)
+	return nil
+}
+
+type Server struct {
+	Addr          string   `json:"addr" yaml:"addr" toml:"addr"`
+	ShutdownDelay Duration `json:"shutdown_delay" yaml:"shutdown_delay" toml:"shutdown_delay"` // Serving with /readyz failing before closing the listener
+	DrainTimeout  Duration `json:"drain_timeout" yaml:"drain_timeout" toml:"drain_timeout"`
+}
+
+type Database struct {
+	Path        string `json:"path" yaml:"path" toml:"path"`
+	TimingsFile string `json:"timings_file" yaml:"timings_file" toml:"timings_file"` // Read by Load, not used if empty
+}
+
+type Scheduler struct {
+	Workers int `json:"workers" yaml:"workers" toml:"workers"` // Expressions computed at once, 0 for no limit
+}
+
+type Auth struct {
+	TokenLifetime Duration `json:"token_lifetime" yaml:"token_lifetime" toml:"token_lifetime"` // 0 for tokens that never expire
+}
+
+type Limits struct {
+	BatchSize int `json:"batch_size" yaml:"batch_size" toml:"batch_size"`
+	PageSize  int `json:"page_size" yaml:"page_size" toml:"page_size"`
+}
+
+type Log struct {
+	Level  string `json:"level" yaml:"level" toml:"level"`    // debug, info, warn or error
+	Format string `json:"format" yaml:"format" toml:"format"` // text or json
+}
+
+type Tracing struct {
+	Exporter     string `json:"exporter" yaml:"exporter" toml:"exporter"`                // none, stdout, file or otlp
+	File         string `json:"file" yaml:"file" toml:"file"`                            // Spans are appended to it by the file exporter
+	OTLPEndpoint string `json:"otlp_endpoint" yaml:"otlp_endpoint" toml:"otlp_endpoint"` // Collector URL, /v1/traces is added
+}
+
+// Config is everything the server can be configured with
+type Config struct {
+	Server    Server              `json:"server" yaml:"server" toml:"server"`
+	Database  Database            `json:"database" yaml:"database" toml:"database"`
+	Scheduler Scheduler           `json:"scheduler" yaml:"scheduler" toml:"scheduler"`
+	Auth      Auth                `json:"auth" yaml:"auth" toml:"auth"`
+	Limits    Limits              `json:"limits" yaml:"limits" toml:"limits"`
+	Log       Log                 `json:"log" yaml:"log" toml:"log"`
+	Tracing   Tracing             `json:"tracing" yaml:"tracing" toml:"tracing"`
+	Timings   map[string]Duration `json:"timings" yaml:"timings" toml:"timings"` // Keyed by the operation names of /math
+}
+
+// Default returns the configuration used when no source sets a value
+func Default() *Config {
+	var (
+		times   = calculator.NewTimings().All()
+		timings = make(map[string]Duration, len(calculator.OperationNames))
+	)
+	for name, operator := range calculator.OperationNames {
+		timings[name] = Duration(times[operator])
+	}
+
+	return &Config{
+		Server:    Server{Addr: ":8080", ShutdownDelay: Duration(5 * time.Second), DrainTimeout: Duration(30 * time.Second)},
+		Database:  Database{Path: "database/data.db", TimingsFile: "data/arithmetic.csv"},
+		Scheduler: Scheduler{Workers: 0},
+		Auth:      Auth{TokenLifetime: 0},
+		Limits:    Limits{BatchSize: 1000, PageSize: 500},
+		Log:       Log{Level: "info", Format: logging.FormatText},
+		Tracing:   Tracing{Exporter: tracing.ExporterNone, File: "data/traces.jsonl", OTLPEndpoint: "http://localhost:4318"},
+		Timings:   timings,
+	}
+}
+
+// setting is a value that can be set by an environment variable and a flag
+type setting struct {
+	key   string // Dotted path in the file, also gives the name of the environment variable
+	flag  string
+	usage string
+	set   func(config *Config, value string) error
+}
+
+// env returns the name of the environment variable of the setting
+func (s setting) env() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(s.key, ".", "_"))
+}
+
+func setString(field func(*Config) *string) func(*Config, string) error {
+	return func(config *Config, value string) error {
+		*field(config) = value
+		return nil
+	}
+}
+
+func setInt(field func(*Config) *int) func(*Config, string) error {
+	return func(config *Config, value string) error {
+		var number, err = strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+
+		*field(config) = number
+		return nil
+	}
+}
+
+func setDuration(field func(*Config) *Duration) func(*Config, string) error {
+	return func(config *Config, value string) error {
+		return field(config).UnmarshalText([]byte(value))
+	}
+}
+
+var settings = []setting{
+	{"server.addr", "addr", "address to listen on", setString(func(c *Config) *string { return &c.Server.Addr })},
+	{"server.shutdown_delay", "shutdown-delay", "how long to keep serving with /readyz failing before closing the listener on shutdown",
+		setDuration(func(c *Config) *Duration { return &c.Server.ShutdownDelay })},
+	{"server.drain_timeout", "drain-timeout", "how long to finish requests and calculations on shutdown",
+		setDuration(func(c *Config) *Duration { return &c.Server.DrainTimeout })},
+	{"database.path", "db", "path to the SQLite database", setString(func(c *Config) *string { return &c.Database.Path })},
+	{"database.timings_file", "timings-file", "CSV file operation times changed through /math are saved to and loaded from at start, not used if empty",
+		setString(func(c *Config) *string { return &c.Database.TimingsFile })},
+	{"scheduler.workers", "workers", "expressions computed at once, 0 for no limit", setInt(func(c *Config) *int { return &c.Scheduler.Workers })},
+	{"auth.token_lifetime", "token-lifetime", "lifetime of issued tokens, 0 for tokens that never expire",
+		setDuration(func(c *Config) *Duration { return &c.Auth.TokenLifetime })},
+	{"limits.batch_size", "batch-size", "largest number of expressions in a batch", setInt(func(c *Config) *int { return &c.Limits.BatchSize })},
+	{"limits.page_size", "page-size", "largest page of the expression listing", setInt(func(c *Config) *int { return &c.Limits.PageSize })},
+	{"log.level", "log-level", "lowest level of logged records: debug, info, warn or error",
+		setString(func(c *Config) *string { return &c.Log.Level })},
+	{"log.format", "log-format", "format of log records: text or json", setString(func(c *Config) *string { return &c.Log.Format })},
+	{"tracing.exporter", "trace-exporter", "where finished spans are exported: none, stdout, file or otlp",
+		setString(func(c *Config) *string { return &c.Tracing.Exporter })},
+	{"tracing.file", "trace-file", "file the spans are appended to by the file exporter",
+		setString(func(c *Config) *string { return &c.Tracing.File })},
+	{"tracing.otlp_endpoint", "otlp-endpoint", "URL of the OpenTelemetry collector receiving OTLP/HTTP",
+		setString(func(c *Config) *string { return &c.Tracing.OTLPEndpoint })},
+}
+
+// setTiming sets the time of an operation from a "name=duration" value
+func setTiming(config *Config, value string) error {
+	var name, duration, ok = strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("invalid timing %q, want name=duration", value)
+	}
+
+	var d Duration
+	if err := d.UnmarshalText([]byte(duration)); err != nil {
+		return err
+	}
+
+	config.Timings[name] = d
+	return nil
+}
+
+// FormatOf returns the format of a configuration file by its extension
+func FormatOf(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".toml":
+		return FormatTOML, nil
+	case ".json":
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("unknown format of the config file %s, want .yaml, .yml, .toml or .json", path)
+	}
+}
+
+// Read sets the values present in the file. Operation times missing from it keep their values.
+func (config *Config) Read(r io.Reader, format string) error {
+	var timings = config.Timings
+	config.Timings = nil
+
+	var err error
+	switch format {
+	case FormatYAML:
+		var decoder = yaml.NewDecoder(r)
+		decoder.KnownFields(true)
+		if err = decoder.Decode(config); errors.Is(err, io.EOF) {
+			err = nil // An empty file
+		}
+	case FormatTOML:
+		var meta toml.MetaData
+		if meta, err = toml.NewDecoder(r).Decode(config); err == nil && len(meta.Undecoded()) != 0 {
+			err = fmt.Errorf("unknown key %s", meta.Undecoded()[0])
+		}
+	case FormatJSON:
+		var decoder = json.NewDecoder(r)
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(config)
+	default:
+		err = fmt.Errorf("unknown format %s", format)
+	}
+
+	for name, duration := range timings {
+		if _, ok := config.Timings[name]; !ok {
+			if config.Timings == nil {
+				config.Timings = map[string]Duration{}
+			}
+			config.Timings[name] = duration
+		}
+	}
+
+	return err
+}
+
+// ReadFile sets the values present in the file, which format is given by its extension
+func (config *Config) ReadFile(path string) error {
+	var format, err = FormatOf(path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err = config.Read(file, format); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// ReadTimingsFile sets the operation times saved to the timings file after changes through /math.
+// A missing file changes nothing.
+func (config *Config) ReadTimingsFile(path string) error {
+	var times = map[string]time.Duration{}
+	if err := data.DownloadArithmetic(times, path); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("timings file %s: %w", path, err)
+	}
+
+	for name, operator := range calculator.OperationNames {
+		if duration, ok := times[operator]; ok {
+			if config.Timings == nil {
+				config.Timings = map[string]Duration{}
+			}
+			config.Timings[name] = Duration(duration)
+		}
+	}
+
+	return nil
+}
+
+// ReadEnv sets the values of the environment variables that are set. CALC_TIMINGS_<NAME> sets
+// the time of an operation, for example CALC_TIMINGS_ADDITION=1s.
+func (config *Config) ReadEnv(lookupEnv func(string) (string, bool)) error {
+	for _, s := range settings {
+		if value, ok := lookupEnv(s.env()); ok {
+			if err := s.set(config, value); err != nil {
+				return fmt.Errorf("%s: %w", s.env(), err)
+			}
+		}
+	}
+
+	for name := range calculator.OperationNames {
+		var env = EnvPrefix + "TIMINGS_" + strings.ToUpper(name)
+		if value, ok := lookupEnv(env); ok {
+			if err := setTiming(config, name+"="+value); err != nil {
+				return fmt.Errorf("%s: %w", env, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// FlagSet holds the flags of all settings. Only the flags given on the command line are applied.
+type FlagSet struct {
+	*flag.FlagSet
+	Path    *string // The config file
+	values  map[string]*string
+	timings []string
+}
+
+// NewFlagSet defines the flags of all settings and -config on a new flag set
+func NewFlagSet(name string) *FlagSet {
+	var flags = &FlagSet{
+		FlagSet: flag.NewFlagSet(name, flag.ContinueOnError),
+		values:  make(map[string]*string, len(settings)),
+	}
+
+	flags.Path = flags.String("config", "", "configuration file (.yaml, .toml or .json), also "+EnvPrefix+"CONFIG")
+	for _, s := range settings {
+		flags.values[s.flag] = flags.String(s.flag, "", s.usage+", also "+s.env())
+	}
+	flags.Func("timing", "operation time as name=duration, may be repeated, also "+EnvPrefix+"TIMINGS_<NAME>", func(value string) error {
+		flags.timings = append(flags.timings, value)
+		return nil
+	})
+
+	return flags
+}
+
+// apply sets the values of the flags given on the command line
+func (flags *FlagSet) apply(config *Config) error {
+	var visited = map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { visited[f.Name] = true })
+
+	for _, s := range settings {
+		if visited[s.flag] {
+			if err := s.set(config, *flags.values[s.flag]); err != nil {
+				return fmt.Errorf("-%s: %w", s.flag, err)
+			}
+		}
+	}
+
+	for _, timing := range flags.timings {
+		if err := setTiming(config, timing); err != nil {
+			return fmt.Errorf("-timing: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Load returns the effective configuration of parsed flags. Values of the config file override
+// the defaults, the operation times saved to the timings file override the config file,
+// environment variables override them, and flags override everything.
+func (flags *FlagSet) Load(lookupEnv func(string) (string, bool)) (*Config, error) {
+	// The timings file may itself be set by any source, so it is known only after reading all of them
+	var config, err = flags.load(lookupEnv, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Database.TimingsFile != "" {
+		if config, err = flags.load(lookupEnv, config.Database.TimingsFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// load reads the sources in order of precedence, including the timings file if it is not empty
+func (flags *FlagSet) load(lookupEnv func(string) (string, bool), timingsFile string) (*Config, error) {
+	var config = Default()
+
+	var path = *flags.Path
+	if path == "" {
+		path, _ = lookupEnv(EnvPrefix + "CONFIG")
+	}
+	if path != "" {
+		if err := config.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if timingsFile != "" {
+		if err := config.ReadTimingsFile(timingsFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.ReadEnv(lookupEnv); err != nil {
+		return nil, err
+	}
+
+	if err := flags.apply(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Load parses the command line arguments and returns the effective configuration
+// together with the arguments left after the flags
+func Load(name string, args []string) (*Config, []string, error) {
+	var flags = NewFlagSet(name)
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	var config, err = flags.Load(os.LookupEnv)
+	return config, flags.Args(), err
+}
+
+// Validate reports every invalid value
+func (config *Config) Validate() error {
+	var errs []error
+	var check = func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	_, _, err := net.SplitHostPort(config.Server.Addr)
+	check(err == nil, "server.addr: invalid address %q", config.Server.Addr)
+	check(config.Server.ShutdownDelay >= 0, "server.shutdown_delay: must not be negative")
+	check(config.Server.DrainTimeout > 0, "server.drain_timeout: must be positive")
+	check(config.Database.Path != "", "database.path: must not be empty")
+	check(config.Scheduler.Workers >= 0, "scheduler.workers: must not be negative")
+	check(config.Auth.TokenLifetime >= 0, "auth.token_lifetime: must not be negative")
+	check(config.Limits.BatchSize > 0, "limits.batch_size: must be positive")
+	check(config.Limits.PageSize > 0, "limits.page_size: must be positive")
+	_, err = logging.ParseLevel(config.Log.Level)
+	check(err == nil, "log.level: unknown level %q, want debug, info, warn or error", config.Log.Level)
+	check(config.Log.Format == logging.FormatText || config.Log.Format == logging.FormatJSON,
+		"log.format: unknown format %q, want %s or %s", config.Log.Format, logging.FormatText, logging.FormatJSON)
+	switch config.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout:
+	case tracing.ExporterFile:
+		check(config.Tracing.File != "", "tracing.file: must not be empty with the file exporter")
+	case tracing.ExporterOTLP:
+		var endpoint, err = url.Parse(config.Tracing.OTLPEndpoint)
+		check(err == nil && (endpoint.Scheme == "http" || endpoint.Scheme == "https") && endpoint.Host != "",
+			"tracing.otlp_endpoint: invalid URL %q", config.Tracing.OTLPEndpoint)
+	default:
+		check(false, "tracing.exporter: unknown exporter %q, want %s, %s, %s or %s", config.Tracing.Exporter,
+			tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterFile, tracing.ExporterOTLP)
+	}
+
+	var names = make([]string, 0, len(config.Timings))
+	for name := range config.Timings {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		var duration = time.Duration(config.Timings[name])
+		if _, ok := calculator.OperationNames[name]; !ok {
+			check(false, "timings.%s: unknown operation", name)
+		} else {
+			check(duration >= 0 && duration <= calculator.MaxExecTime, "timings.%s: must be from 0 to %s", name, calculator.MaxExecTime)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Operations returns the operation times to set with calculator.Timings.Set
+func (config *Config) Operations() []*calculator.Operation {
+	var operations = make([]*calculator.Operation, 0, len(config.Timings))
+	for name, duration := range config.Timings {
+		var operation, err = calculator.FormatOperation(calculator.OperationNames[name], time.Duration(duration).String())
+		if err == nil {
+			operations = append(operations, operation)
+		}
+	}
+
+	return operations
+}
+
+// Write writes the configuration in the format
+func (config *Config) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatYAML:
+		var encoder = yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(config); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case FormatTOML:
+		return toml.NewEncoder(w).Encode(config)
+	case FormatJSON:
+		var encoder = json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(config)
+	default:
+		return fmt.Errorf("unknown format %s", format)
+	}
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/data"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// env returns a lookup of the given environment variables
+func env(variables map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		var value, ok = variables[name]
+		return value, ok
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	var files = map[string]string{
+		"config.yaml": "server:\n  addr: \":9000\"\nscheduler:\n  workers: 2\ntimings:\n  addition: 1s\n",
+		"config.toml": "[server]\naddr = \":9000\"\n[scheduler]\nworkers = 2\n[timings]\naddition = \"1s\"\n",
+		"config.json": `{"server": {"addr": ":9000"}, "scheduler": {"workers": 2}, "timings": {"addition": "1s"}}`,
+	}
+
+	for name, content := range files {
+		var path = filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		var flags = NewFlagSet("test")
+		if err := flags.Parse([]string{"-config", path, "-workers", "8", "-timing", "division=3s"}); err != nil {
+			t.Fatal(err)
+		}
+
+		config, err := flags.Load(env(map[string]string{
+			"CALC_SCHEDULER_WORKERS": "4",
+			"CALC_DATABASE_PATH":     "env.db",
+			"CALC_TIMINGS_ADDITION":  "2s",
+		}))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		var want = Default()
+		want.Server.Addr = ":9000"                           // file
+		want.Database.Path = "env.db"                        // environment
+		want.Scheduler.Workers = 8                           // flag over environment over file
+		want.Timings["addition"] = Duration(2 * time.Second) // environment over file
+		want.Timings["division"] = Duration(3 * time.Second) // flag
+
+		var got, expected bytes.Buffer
+		if err = config.Write(&got, FormatJSON); err != nil {
+			t.Fatal(err)
+		}
+		if err = want.Write(&expected, FormatJSON); err != nil {
+			t.Fatal(err)
+		}
+
+		if got.String() != expected.String() {
+			t.Errorf("%s: got\n%s\nwant\n%s", name, got.String(), expected.String())
+		}
+	}
+}
+
+func TestLoad_ConfigFromEnv(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte("limits:\n  page_size: 20\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var flags = NewFlagSet("test")
+	if err := flags.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := flags.Load(env(map[string]string{"CALC_CONFIG": path}))
+	if err != nil {
+		t.Fatal(err)
+	} else if config.Limits.PageSize != 20 {
+		t.Errorf("got page size %d, want 20", config.Limits.PageSize)
+	}
+}
+
+func TestLoad_TimingsFile(t *testing.T) {
+	var (
+		dir     = t.TempDir()
+		config  = filepath.Join(dir, "config.yaml")
+		timings = filepath.Join(dir, "timings.csv")
+	)
+	if err := os.WriteFile(config, []byte("timings:\n  addition: 1s\n  subtraction: 1s\n  division: 1s\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(timings, []byte("element;value\n+;2000\n-;2000\nsqrt;2000\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var flags = NewFlagSet("test")
+	if err := flags.Parse([]string{"-config", config}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The timings file is set by the environment, after the config file is read
+	loaded, err := flags.Load(env(map[string]string{
+		"CALC_DATABASE_TIMINGS_FILE": timings,
+		"CALC_TIMINGS_SUBTRACTION":   "3s",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want = map[string]time.Duration{
+		"addition":    2 * time.Second, // timings file over config file
+		"subtraction": 3 * time.Second, // environment over timings file
+		"division":    time.Second,     // config file
+		"sqrt":        2 * time.Second, // timings file
+	}
+	for name, duration := range want {
+		if got := time.Duration(loaded.Timings[name]); got != duration {
+			t.Errorf("%s: got %s, want %s", name, got, duration)
+		}
+	}
+
+	// A missing timings file is not an error
+	if _, err = flags.Load(env(map[string]string{"CALC_DATABASE_TIMINGS_FILE": filepath.Join(dir, "missing.csv")})); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReadTimingsFile_RoundTrip(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "timings.csv")
+
+	// Time under a millisecond is kept
+	var saved = map[string]time.Duration{"+": 250 * time.Microsecond, "-": 1500 * time.Microsecond}
+	if err := data.UploadArithmetic(saved, path); err != nil {
+		t.Fatal(err)
+	}
+
+	var config Config
+	if err := config.ReadTimingsFile(path); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]time.Duration{"addition": saved["+"], "subtraction": saved["-"]} {
+		if got := time.Duration(config.Timings[name]); got != want {
+			t.Errorf("%s: got %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	var tests = []struct {
+		args []string
+		env  map[string]string
+		file string
+		want string
+	}{
+		{args: []string{"-workers", "-1"}, want: "scheduler.workers"},
+		{args: []string{"-addr", "8080"}, want: "server.addr"},
+		{args: []string{"-page-size", "0"}, want: "limits.page_size"},
+		{args: []string{"-timing", "foo=1s"}, want: "timings.foo"},
+		{args: []string{"-timing", "addition=2h"}, want: "timings.addition"},
+		{args: []string{"-timing", "addition"}, want: "name=duration"},
+		{args: []string{"-log-level", "verbose"}, want: "log.level"},
+		{env: map[string]string{"CALC_LOG_FORMAT": "xml"}, want: "log.format"},
+		{args: []string{"-trace-exporter", "jaeger"}, want: "tracing.exporter"},
+		{args: []string{"-trace-exporter", "otlp", "-otlp-endpoint", "localhost:4318"}, want: "tracing.otlp_endpoint"},
+		{env: map[string]string{"CALC_TRACING_EXPORTER": "file", "CALC_TRACING_FILE": ""}, want: "tracing.file"},
+		{env: map[string]string{"CALC_AUTH_TOKEN_LIFETIME": "soon"}, want: "CALC_AUTH_TOKEN_LIFETIME"},
+		{file: "server:\n  port: 8080\n", want: "port"},
+	}
+
+	for _, test := range tests {
+		var args = test.args
+		if test.file != "" {
+			var path = filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(test.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			args = append(args, "-config", path)
+		}
+
+		var flags = NewFlagSet("test")
+		if err := flags.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := flags.Load(env(test.env)); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v %v: got %v, want an error about %s", test.args, test.env, err, test.want)
+		}
+	}
+}
+
+func TestConfig_WriteRead(t *testing.T) {
+	var config = Default()
+	config.Auth.TokenLifetime = Duration(time.Hour)
+	config.Timings["modulo"] = Duration(250 * time.Millisecond)
+
+	for _, format := range []string{FormatYAML, FormatTOML, FormatJSON} {
+		var buffer bytes.Buffer
+		if err := config.Write(&buffer, format); err != nil {
+			t.Fatal(err)
+		}
+
+		var read = &Config{}
+		if err := read.Read(&buffer, format); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		if read.Auth.TokenLifetime != config.Auth.TokenLifetime || read.Timings["modulo"] != config.Timings["modulo"] ||
+			read.Server != config.Server || read.Limits != config.Limits || len(read.Timings) != len(config.Timings) {
+			t.Errorf("%s: got %+v, want %+v", format, read, config)
+		}
+	}
+}
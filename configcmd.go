@@ -0,0 +1,31 @@
+package main
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/config"
+	"fmt"
+	"os"
+)
+
+// configCommand runs the "config" subcommand:
+//
+//	config print [-format yaml | toml | json] [flags]
+//
+// print shows the effective configuration of the file, the environment and the flags.
+func configCommand(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return fmt.Errorf("usage: config print [-format yaml | toml | json] [flags]")
+	}
+
+	var flags = config.NewFlagSet("config print")
+	var format = flags.String("format", config.FormatYAML, "output format: yaml, toml or json")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	cfg, err := flags.Load(os.LookupEnv)
+	if err != nil {
+		return err
+	}
+
+	return cfg.Write(os.Stdout, *format)
+}
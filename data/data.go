@@ -47,7 +47,10 @@ func WriteCSV(data [][]string, name string, comma rune) error {
 	return nil
 }
 
-func DownloadArithmetic(arithmetic map[int32]time.Duration, name string) error {
+// DownloadArithmetic загружает время операций; элемент - символ операции
+// или его код, как в прежнем формате файла. Время записано как time.Duration
+// или, в прежнем формате, целым числом миллисекунд.
+func DownloadArithmetic(arithmetic map[string]time.Duration, name string) error {
 	var info, err = OpenCSV(name, ';')
 
 	if err != nil {
@@ -59,27 +62,44 @@ func DownloadArithmetic(arithmetic map[int32]time.Duration, name string) error {
 			continue
 		}
 
-		var digit, err = strconv.ParseInt(strings.Replace(val[1], "-", "", -1), 10, 0)
+		var duration, err = parseArithmetic(val[1])
 
 		if err != nil {
 			return err
 		}
 
-		var symbol, _ = strconv.Atoi(val[0])
-		arithmetic[int32(symbol)] = time.UnixMilli(digit).Sub(time.UnixMilli(0))
+		var symbol = val[0]
+		if code, err := strconv.Atoi(symbol); err == nil {
+			symbol = string(rune(code))
+		}
+		arithmetic[symbol] = duration
 	}
 
 	return nil
 }
 
-func UploadArithmetic(arithmetic map[int32]time.Duration, name string) error {
+// parseArithmetic разбирает время операции из файла
+func parseArithmetic(value string) (time.Duration, error) {
+	if duration, err := time.ParseDuration(value); err == nil {
+		return duration, nil
+	}
+
+	var digit, err = strconv.ParseInt(strings.Replace(value, "-", "", -1), 10, 0)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(digit) * time.Millisecond, nil
+}
+
+// UploadArithmetic сохраняет время операций как time.Duration, чтобы не терять доли миллисекунды
+func UploadArithmetic(arithmetic map[string]time.Duration, name string) error {
 	var info = make([][]string, 0)
 	info = append(info, []string{"element", "value"})
 
 	for key, val := range arithmetic {
-		var mills = strconv.Itoa(int(val.Milliseconds()))
-
-		info = append(info, []string{strconv.Itoa(int(key)), mills})
+		info = append(info, []string{key, val.String()})
 	}
 
 	var err = WriteCSV(info, name, ';')
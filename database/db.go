@@ -1,13 +1,13 @@
 package database
 
 import (
-	"Distributed-arithmetic-expression-evaluator-version-2.0/expressions"
-	"Distributed-arithmetic-expression-evaluator-version-2.0/rest"
+	"context"
 	"crypto/rand"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	_ "github.com/mattn/go-sqlite3" // sqlite3 driver
-	"log"
+	"log/slog"
 	"math/big"
 	"time"
 )
@@ -16,80 +16,37 @@ type DB struct {
 	Connection *sql.DB
 }
 
-type DBUser struct {
-	Name     string
-	Password string
-	Secret   string
-}
-
-// CreateDataBase creates a database either by the first arg or by default
-func CreateDataBase(db *sql.DB, args ...interface{}) error {
-	var createStmt string
-
-	// Begin a transaction.
-	tx, err := db.Begin()
-
+// NewDB opens the database and migrates its schema to the latest version
+func NewDB(name string) (*DB, error) {
+	var db, err = OpenDB(name)
 	if err != nil {
-		return err
-	}
-
-	if args != nil {
-		createStmt = args[0].(string)
-	} else {
-		createStmt = `
-    	CREATE TABLE IF NOT EXISTS users (
-        name TEXT PRIMARY KEY,
-        password TEXT NOT NULL,
-        secret TEXT NOT NULL
-    );`
+		return nil, err
 	}
 
-	// Execute the SQL statement.
-	_, err = tx.Exec(createStmt)
-	if err != nil {
-		err = tx.Rollback() // Roll back the transaction on error.
-
-		if err != nil {
-			return err
-		}
-
-		return err
+	if err = db.MigrateUp(); err != nil {
+		_ = db.Close()
+		return nil, err
 	}
 
-	// Commit the transaction to finalize changes.
-	return tx.Commit()
+	return db, nil
 }
 
-// NewDB creates a new DB object with connection to the database
-func NewDB(name string, args ...interface{}) (*DB, error) {
+// OpenDB opens the database without changing its schema
+func OpenDB(name string) (*DB, error) {
 	db, err := sql.Open("sqlite3", name)
 
 	if err != nil {
 		return nil, err
 	}
 
-	err = CreateDataBase(db, args...)
-
-	if err != nil {
-		return nil, err
-	}
-
 	return &DB{
 		Connection: db,
 	}, nil
 }
 
-// NewExpressionsDB is a copy of NewDB, but with the table installed
-func NewExpressionsDB(name string) (*DB, error) {
-	var arg = `CREATE TABLE IF NOT EXISTS expressions (id TEXT, expression TEXT, value INT, user TEXT, date INT, PRIMARY KEY (id, user));`
-
-	var db, err = NewDB(name, arg)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return db, nil
+// Ping checks that the database file can be queried
+func (db *DB) Ping(ctx context.Context) error {
+	return db.Connection.PingContext(ctx)
 }
 
 // Close closes the database connection
@@ -97,9 +54,10 @@ func (db *DB) Close() error {
 	return db.Connection.Close()
 }
 
+// Close commits a read-only transaction. A failure is only logged, since nothing was changed.
 func Close(tx *sql.Tx) {
 	if err := tx.Commit(); err != nil {
-		log.Fatal(err)
+		slog.Error("Failed to finish a read transaction", "error", err)
 	}
 }
 
@@ -173,7 +131,9 @@ func (db *DB) GetUser(name string) (*DBUser, error) {
 	var user DBUser
 	err = tx.QueryRow(getStmt, name).Scan(&user.Name, &user.Password, &user.Secret)
 
-	if err != nil {
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	} else if err != nil {
 		return nil, err
 	}
 
@@ -195,11 +155,9 @@ func (db *DB) GetUsers() ([]*DBUser, error) {
 		return nil, err
 	}
 
-	var (
-		users = []*DBUser{}
-		user  DBUser
-	)
+	var users = []*DBUser{}
 	for rows.Next() {
+		var user DBUser
 		err = rows.Scan(&user.Name, &user.Password, &user.Secret)
 		if err != nil {
 			return nil, err
@@ -210,121 +168,302 @@ func (db *DB) GetUsers() ([]*DBUser, error) {
 	return users, nil
 }
 
-func (db *DB) ContainsUser(name string) (bool, error) {
-	var getStmt = `SELECT name FROM users WHERE name = $1;`
-	tx, err := db.Connection.Begin()
+// encodeBindings stores the variables used by an expression as a JSON object
+func encodeBindings(bindings map[string]float64) (sql.NullString, error) {
+	if len(bindings) == 0 {
+		return sql.NullString{}, nil
+	}
+
+	var encoded, err = json.Marshal(bindings)
 	if err != nil {
-		return false, err
+		return sql.NullString{}, err
 	}
 
-	defer Close(tx)
+	return sql.NullString{String: string(encoded), Valid: true}, nil
+}
 
-	row := tx.QueryRow(getStmt, name)
-	var Name string
-	row.Scan(&Name)
-	if Name == "" {
-		return false, errors.New("user not found")
+// decodeBindings restores the variables used by an expression
+func decodeBindings(encoded sql.NullString) (map[string]float64, error) {
+	if !encoded.Valid || encoded.String == "" {
+		return nil, nil
 	}
 
-	return true, nil
+	var bindings map[string]float64
+	if err := json.Unmarshal([]byte(encoded.String), &bindings); err != nil {
+		return nil, err
+	}
+
+	return bindings, nil
+}
+
+// encodeString stores the empty string as NULL
+func encodeString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// encodeTime stores the time in milliseconds, the zero time is stored as NULL
+func encodeTime(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+
+	return sql.NullInt64{Int64: t.UnixMilli(), Valid: true}
 }
 
-func (db *DB) AddExpression(expr *rest.Expression, id, user string) error {
-	var addStmt = `INSERT INTO expressions (id, expression, value, user, date) VALUES ($1, $2, $3, $4, $5);`
+// AddExpressions adds the rows in one transaction: if one of them cannot be added, none is
+func (db *DB) AddExpressions(rows ...*ExpressionRow) error {
+	var addStmt = `INSERT INTO expressions (id, expression, value, user, date, bindings, status, error, estimated, finished) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);`
+
 	tx, err := db.Connection.Begin()
 
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Exec(addStmt, id, expr.Express, expr.Value, user, expr.Created.UnixMilli())
+	stmt, err := tx.Prepare(addStmt)
 
 	if err != nil {
-		anErr := tx.Rollback()
+		return rollback(tx, err)
+	}
+	defer stmt.Close()
 
-		if anErr != nil {
-			return anErr
+	for _, row := range rows {
+		bindings, err := encodeBindings(row.Bindings)
+		if err != nil {
+			return rollback(tx, err)
 		}
 
-		return err
+		_, err = stmt.Exec(row.ID, row.Expression, row.Value, row.User, row.Created.UnixMilli(), bindings, row.Status,
+			encodeString(row.Error), int64(row.Estimated), encodeTime(row.Finished))
+
+		if err != nil {
+			return rollback(tx, err)
+		}
 	}
 
 	return tx.Commit()
 }
 
-func (db *DB) ChangeExpression(value int, id, user string) error {
-	var changeStmt = `UPDATE expressions SET value = $2 WHERE id = $4 AND user = $5;`
+// UpdateExpression saves the status and the result or the error of the expression
+func (db *DB) UpdateExpression(row *ExpressionRow) error {
+	var updateStmt = `UPDATE expressions SET value = $1, status = $2, error = $3, finished = $4 WHERE id = $5 AND user = $6;`
+
 	tx, err := db.Connection.Begin()
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Exec(changeStmt, value, id, user)
+	_, err = tx.Exec(updateStmt, row.Value, row.Status, encodeString(row.Error), encodeTime(row.Finished), row.ID, row.User)
 	if err != nil {
-		anErr := tx.Rollback()
-		if anErr != nil {
-			return anErr
-		}
-		return err
+		return rollback(tx, err)
 	}
 
 	return tx.Commit()
 }
 
-func (db *DB) GetExpression(id, userName string) (*rest.Expression, error) {
+// expressionColumns are the columns scanned by scanExpression
+const expressionColumns = `id, user, expression, value, date, bindings, status, error, IFNULL(estimated, 0), finished`
+
+// scanExpression reads a row selected with expressionColumns and the extra destinations
+func scanExpression(scan func(dest ...interface{}) error, extra ...interface{}) (*ExpressionRow, error) {
 	var (
-		getStmt  = `SELECT expression, value, date FROM expressions WHERE id = $1 AND user = $2;`
-		unixTime int64
-		expr     rest.Expression
-		err      = db.Connection.QueryRow(getStmt, id, userName).Scan(&expr.Express, &expr.Value, &unixTime)
+		row       ExpressionRow
+		created   int64
+		bindings  sql.NullString
+		status    sql.NullString
+		exprErr   sql.NullString
+		estimated int64
+		finished  sql.NullInt64
 	)
 
+	var dest = append([]interface{}{&row.ID, &row.User, &row.Expression, &row.Value, &created, &bindings, &status,
+		&exprErr, &estimated, &finished}, extra...)
+	if err := scan(dest...); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if row.Bindings, err = decodeBindings(bindings); err != nil {
+		return nil, err
+	}
+
+	row.Status = status.String
+	row.Error = exprErr.String
+	row.Created = time.UnixMilli(created)
+	row.Estimated = time.Duration(estimated)
+	if finished.Valid {
+		row.Finished = time.UnixMilli(finished.Int64)
+	}
+
+	return &row, nil
+}
+
+func (db *DB) GetExpression(user, id string) (*ExpressionRow, error) {
+	var getStmt = `SELECT ` + expressionColumns + ` FROM expressions WHERE user = $1 AND id = $2;`
+
+	row, err := scanExpression(db.Connection.QueryRow(getStmt, user, id).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	return row, err
+}
+
+func (db *DB) GetExpressions(user string) ([]*ExpressionRow, error) {
+	var getStmt = `SELECT ` + expressionColumns + ` FROM expressions WHERE user = $1 ORDER BY date, id;`
+
+	rows, err := db.Connection.Query(getStmt, user)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	var exprs = []*ExpressionRow{}
+	for rows.Next() {
+		row, err := scanExpression(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+
+		exprs = append(exprs, row)
+	}
 
-	expr.Created = time.UnixMilli(unixTime)
+	return exprs, rows.Err()
+}
+
+// AddTimingChanges records the changes of operation execution times in one transaction
+func (db *DB) AddTimingChanges(changes ...*TimingChange) error {
+	var addStmt = `INSERT INTO timings_audit (user, operation, previous, current, date) VALUES ($1, $2, $3, $4, $5);`
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		_, err = tx.Exec(addStmt, change.User, change.Operation, int64(change.Previous), int64(change.Current), change.Date.UnixMilli())
+		if err != nil {
+			anErr := tx.Rollback()
+			if anErr != nil {
+				return anErr
+			}
+			return err
+		}
+	}
 
-	return &expr, nil
+	return tx.Commit()
 }
 
-func (db *DB) GetExpressions(userName string) (*expressions.Expressions, error) {
+// GetTimingChanges retrieves the audit trail of operation execution times, oldest first
+func (db *DB) GetTimingChanges() ([]*TimingChange, error) {
+	var getStmt = `SELECT user, operation, previous, current, date FROM timings_audit ORDER BY id;`
+	rows, err := db.Connection.Query(getStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
 	var (
-		expresses = expressions.NewExpressions()
-		GetStmt   = `SELECT id, expression, value, date FROM expressions WHERE user = $1;`
-		err       error
-		tx        *sql.Tx
-		rows      *sql.Rows
+		changes           = []*TimingChange{}
+		previous, current int64
+		date              int64
 	)
+	for rows.Next() {
+		var change TimingChange
+		if err = rows.Scan(&change.User, &change.Operation, &previous, &current, &date); err != nil {
+			return nil, err
+		}
 
-	tx, err = db.Connection.Begin()
+		change.Previous = time.Duration(previous)
+		change.Current = time.Duration(current)
+		change.Date = time.UnixMilli(date)
+		changes = append(changes, &change)
+	}
+
+	return changes, rows.Err()
+}
+
+// SetVariable creates the user's variable or changes its value
+func (db *DB) SetVariable(user, name string, value float64) error {
+	var setStmt = `INSERT INTO variables (user, name, value) VALUES ($1, $2, $3) ON CONFLICT (user, name) DO UPDATE SET value = excluded.value;`
+	tx, err := db.Connection.Begin()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	defer Close(tx)
+	_, err = tx.Exec(setStmt, user, name, value)
+	if err != nil {
+		anErr := tx.Rollback()
+		if anErr != nil {
+			return anErr
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
 
-	rows, err = tx.Query(GetStmt, userName)
+// GetVariable retrieves the value of the user's variable
+func (db *DB) GetVariable(user, name string) (float64, error) {
+	var (
+		getStmt = `SELECT value FROM variables WHERE user = $1 AND name = $2;`
+		value   float64
+		err     = db.Connection.QueryRow(getStmt, user, name).Scan(&value)
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+
+	return value, err
+}
+
+// GetVariables retrieves all variables of the user
+func (db *DB) GetVariables(user string) (map[string]float64, error) {
+	var getStmt = `SELECT name, value FROM variables WHERE user = $1;`
+	rows, err := db.Connection.Query(getStmt, user)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	var (
-		id      string
-		expr    string
-		value   string
-		created int64
+		variables = map[string]float64{}
+		name      string
+		value     float64
 	)
 	for rows.Next() {
-		err = rows.Scan(&id, &expr, &value, &created)
-		if err != nil {
+		if err = rows.Scan(&name, &value); err != nil {
 			return nil, err
 		}
-		_, err = expresses.AddExpression(id, expr, time.UnixMilli(created), value)
-		if err != nil {
-			return nil, err
+		variables[name] = value
+	}
+
+	return variables, rows.Err()
+}
+
+// DeleteVariable removes the user's variable, ErrNotFound is returned if there is no such variable
+func (db *DB) DeleteVariable(user, name string) error {
+	var deleteStmt = `DELETE FROM variables WHERE user = $1 AND name = $2;`
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(deleteStmt, user, name)
+	if err == nil {
+		var affected int64
+		if affected, err = result.RowsAffected(); err == nil && affected == 0 {
+			err = ErrNotFound
 		}
 	}
 
-	return expresses, nil
+	if err != nil {
+		anErr := tx.Rollback()
+		if anErr != nil {
+			return anErr
+		}
+		return err
+	}
+
+	return tx.Commit()
 }
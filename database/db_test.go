@@ -1,31 +1,27 @@
 package database
 
 import (
-	"Distributed-arithmetic-expression-evaluator-version-2.0/rest"
 	"database/sql"
 	"fmt"
-	"os"
-	"strconv"
+	"path/filepath"
 	"testing"
 	"time"
 )
 
-// TODO: Add test with one time start of NewDB and NewExpressionsDB
-
-const name = "test.db"
-
-func cleanUp(db *DB, t *testing.T) {
-	err := db.Close()
-
+// newTestDB creates a migrated database in a temporary directory
+func newTestDB(t *testing.T) *DB {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 
-	err = os.Remove(name)
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+		}
+	})
 
-	if err != nil {
-		t.Error(err)
-	}
+	return db
 }
 
 func checkColumns(tx *sql.Tx, tableName string, columns []string) error {
@@ -62,17 +58,12 @@ func checkColumns(tx *sql.Tx, tableName string, columns []string) error {
 }
 
 func TestNewDB(t *testing.T) {
-	db, err := NewDB(name)
-	if err != nil {
-		t.Error(err)
-	}
-
-	defer cleanUp(db, t)
+	db := newTestDB(t)
 
 	tx, err := db.Connection.Begin()
 
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 
 	err = checkColumns(tx, "users", []string{"name", "password", "secret"})
@@ -81,28 +72,7 @@ func TestNewDB(t *testing.T) {
 		t.Error(err)
 	}
 
-	err = tx.Commit()
-
-	if err != nil {
-		t.Error(err)
-	}
-}
-
-func TestNewExpressionsDB(t *testing.T) {
-	db, err := NewExpressionsDB(name)
-	if err != nil {
-		t.Error(err)
-	}
-
-	defer cleanUp(db, t)
-
-	tx, err := db.Connection.Begin()
-
-	if err != nil {
-		t.Error(err)
-	}
-
-	err = checkColumns(tx, "expressions", []string{"id", "expression", "value", "user", "date"})
+	err = checkColumns(tx, "expressions", []string{"id", "expression", "value", "user", "date", "bindings", "status", "error", "estimated", "finished"})
 
 	if err != nil {
 		t.Error(err)
@@ -116,139 +86,69 @@ func TestNewExpressionsDB(t *testing.T) {
 }
 
 func TestDB_GetUser(t *testing.T) {
-	db, err := NewDB(name)
+	db := newTestDB(t)
 
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	defer cleanUp(db, t)
-
-	_, err = db.CreateUser("name", "password")
+	_, err := db.CreateUser("name", "password")
 
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	_, err = db.GetUser("name")
-
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	_, err = db.GetUser("wrongName")
-
 	if err == nil {
 		t.Fatal("There is no user with the name 'wrongName'")
 	}
 }
 
-func TestDB_ContainsUser(t *testing.T) {
-	db, err := NewDB(name)
-
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	defer cleanUp(db, t)
-
-	_, err = db.CreateUser("name", "password")
+func TestDB_ExpressionBindings(t *testing.T) {
+	var name = filepath.Join(t.TempDir(), "test.db")
+	db, err := OpenDB(name)
 
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = db.ContainsUser("name")
-	if err != nil {
+	if _, err = db.Connection.Exec(`CREATE TABLE expressions (id TEXT, expression TEXT, value INT, user TEXT, date INT, PRIMARY KEY (id, user));`); err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = db.ContainsUser("wrongName")
-	if err == nil {
-		t.Fatal("There is no user with the name 'wrongName'")
-	}
-}
-
-func TestDB_GetExpression(t *testing.T) {
-	db, err := NewExpressionsDB(name)
-
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	defer cleanUp(db, t)
-
-	expr := &rest.Expression{
-		Express: "1+1",
-		Value:   2,
-		Created: time.Now(),
-	}
-
-	err = db.AddExpression(expr, "1", "name")
-
-	if err != nil {
+	if err = db.Close(); err != nil {
 		t.Fatal(err)
 	}
 
-	newExpr, err := db.GetExpression("1", "name")
-
+	// The table created without the bindings column has to be upgraded
+	db, err = NewDB(name)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if expr.Express != newExpr.Express || expr.Value != newExpr.Value || expr.Created.Sub(newExpr.Created) > time.Millisecond {
-		t.Fatal("Expressions are not equal")
-	}
-}
+	defer db.Close()
 
-func Contains(expr []*rest.Expression, el *rest.Expression) bool {
-	for _, e := range expr {
-		if e.Express == el.Express && e.Value == el.Value && e.Created.Sub(el.Created) < time.Millisecond {
-			return true
-		}
+	row := &ExpressionRow{
+		ID:         "1",
+		User:       "name",
+		Expression: "price*qty",
+		Value:      10,
+		Status:     "done",
+		Created:    time.Now(),
+		Bindings:   map[string]float64{"price": 2.5, "qty": 4},
 	}
 
-	return false
-}
-
-func TestDB_GetExpressions(t *testing.T) {
-	db, err := NewExpressionsDB(name)
-
-	if err != nil {
+	if err = db.AddExpressions(row); err != nil {
 		t.Fatal(err)
 	}
 
-	defer cleanUp(db, t)
-
-	expr := []*rest.Expression{&rest.Expression{
-		Express: "1+1",
-		Value:   2,
-		Created: time.UnixMilli(time.Now().UnixMilli()),
-	},
-		&rest.Expression{
-			Express: "2+2",
-			Value:   4,
-			Created: time.UnixMilli(time.Now().UnixMilli()),
-		},
-	}
-
-	for i, el := range expr {
-		err = db.AddExpression(el, strconv.Itoa(i), "name")
-		if err != nil {
-			t.Fatal(err)
-		}
-	}
-
-	newExpr, err := db.GetExpressions("name")
+	newRow, err := db.GetExpression("name", "1")
 	if err != nil {
 		t.Fatal(err)
-	} else if len(newExpr.IDs) == 0 {
-		t.Fatal("There is no expressions")
 	}
 
-	for _, el := range newExpr.GetExpressions() {
-		if ok := Contains(expr, el); !ok {
-			t.Fatal("Expressions are not equal")
-		}
+	if len(newRow.Bindings) != 2 || newRow.Bindings["price"] != 2.5 || newRow.Bindings["qty"] != 4 {
+		t.Fatalf("Unexpected bindings: %v", newRow.Bindings)
 	}
 }
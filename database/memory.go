@@ -0,0 +1,317 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory keeps everything in memory. It behaves like DB, including the millisecond
+// precision of the stored times, and is meant for tests and throwaway servers.
+type Memory struct {
+	mu          sync.Mutex
+	users       map[string]DBUser
+	variables   map[string]map[string]float64        // user -> name -> value
+	expressions map[string]map[string]*ExpressionRow // user -> id -> row
+	changes     []TimingChange
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		users:       map[string]DBUser{},
+		variables:   map[string]map[string]float64{},
+		expressions: map[string]map[string]*ExpressionRow{},
+	}
+}
+
+// Ping does nothing, the memory is always reachable
+func (memory *Memory) Ping(context.Context) error {
+	return nil
+}
+
+// CheckSchema does nothing, the memory has no schema
+func (memory *Memory) CheckSchema() error {
+	return nil
+}
+
+// Close does nothing, the data is kept until the store is garbage collected
+func (memory *Memory) Close() error {
+	return nil
+}
+
+func (memory *Memory) CreateUser(name, password string) (*DBUser, error) {
+	var randomNum, err = RandomNumber(2, 127, 128)
+	if err != nil {
+		return nil, err
+	}
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	if _, ok := memory.users[name]; ok {
+		return nil, fmt.Errorf("user %s already exists", name)
+	}
+
+	var user = DBUser{Name: name, Password: password, Secret: randomNum.String()}
+	memory.users[name] = user
+
+	return &user, nil
+}
+
+func (memory *Memory) GetUser(name string) (*DBUser, error) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	var user, ok = memory.users[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &user, nil
+}
+
+func (memory *Memory) GetUsers() ([]*DBUser, error) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	var users = make([]*DBUser, 0, len(memory.users))
+	for _, user := range memory.users {
+		users = append(users, &user)
+	}
+
+	return users, nil
+}
+
+func (memory *Memory) SetVariable(user, name string, value float64) error {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	if memory.variables[user] == nil {
+		memory.variables[user] = map[string]float64{}
+	}
+	memory.variables[user][name] = value
+
+	return nil
+}
+
+func (memory *Memory) GetVariable(user, name string) (float64, error) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	var value, ok = memory.variables[user][name]
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	return value, nil
+}
+
+func (memory *Memory) GetVariables(user string) (map[string]float64, error) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	var variables = maps.Clone(memory.variables[user])
+	if variables == nil {
+		variables = map[string]float64{}
+	}
+
+	return variables, nil
+}
+
+func (memory *Memory) DeleteVariable(user, name string) error {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	if _, ok := memory.variables[user][name]; !ok {
+		return ErrNotFound
+	}
+	delete(memory.variables[user], name)
+
+	return nil
+}
+
+// storedRow copies the row with the precision of DB, so that callers cannot change stored rows
+func storedRow(row *ExpressionRow) *ExpressionRow {
+	var stored = *row
+	stored.Bindings = maps.Clone(row.Bindings)
+	stored.Created = time.UnixMilli(row.Created.UnixMilli())
+	if !row.Finished.IsZero() {
+		stored.Finished = time.UnixMilli(row.Finished.UnixMilli())
+	}
+
+	return &stored
+}
+
+func (memory *Memory) AddExpressions(rows ...*ExpressionRow) error {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	var added = make(map[[2]string]bool, len(rows))
+	for _, row := range rows {
+		var key = [2]string{row.User, row.ID}
+		if _, ok := memory.expressions[row.User][row.ID]; ok || added[key] {
+			return fmt.Errorf("expression %s of user %s already exists", row.ID, row.User)
+		}
+		added[key] = true
+	}
+
+	for _, row := range rows {
+		if memory.expressions[row.User] == nil {
+			memory.expressions[row.User] = map[string]*ExpressionRow{}
+		}
+		memory.expressions[row.User][row.ID] = storedRow(row)
+	}
+
+	return nil
+}
+
+func (memory *Memory) UpdateExpression(row *ExpressionRow) error {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	var stored, ok = memory.expressions[row.User][row.ID]
+	if !ok {
+		return nil // Like an UPDATE matching no rows
+	}
+
+	var updated = storedRow(row)
+	stored.Value, stored.Status, stored.Error, stored.Finished = updated.Value, updated.Status, updated.Error, updated.Finished
+
+	return nil
+}
+
+func (memory *Memory) GetExpression(user, id string) (*ExpressionRow, error) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	var row, ok = memory.expressions[user][id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return storedRow(row), nil
+}
+
+// userExpressions returns copies of the user's expressions. Called with the mutex locked.
+func (memory *Memory) userExpressions(user string) []*ExpressionRow {
+	var rows = make([]*ExpressionRow, 0, len(memory.expressions[user]))
+	for _, row := range memory.expressions[user] {
+		rows = append(rows, storedRow(row))
+	}
+
+	return rows
+}
+
+func (memory *Memory) GetExpressions(user string) ([]*ExpressionRow, error) {
+	memory.mu.Lock()
+	var rows = memory.userExpressions(user)
+	memory.mu.Unlock()
+
+	slices.SortFunc(rows, func(a, b *ExpressionRow) int {
+		if c := a.Created.Compare(b.Created); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return rows, nil
+}
+
+// sortKey returns the value of the row the listing is ordered by, the same as sortKeys of DB
+func sortKey(row *ExpressionRow, sort string) int64 {
+	switch sort {
+	case SortFinished:
+		if row.Finished.IsZero() {
+			return math.MaxInt64
+		}
+		return row.Finished.UnixMilli()
+	case SortEstimated:
+		return int64(row.Estimated)
+	default:
+		return row.Created.UnixMilli()
+	}
+}
+
+func (memory *Memory) ListExpressions(user string, query ExpressionQuery) ([]*ExpressionRow, string, error) {
+	var after, err = query.normalize()
+	if err != nil {
+		return nil, "", err
+	}
+
+	memory.mu.Lock()
+	var all = memory.userExpressions(user)
+	memory.mu.Unlock()
+
+	// compare orders the rows by the sort key and then by ID in the direction of the query
+	var compare = func(key int64, ID string, row *ExpressionRow) int {
+		var c = cmp.Compare(key, sortKey(row, query.Sort))
+		if c == 0 {
+			c = strings.Compare(ID, row.ID)
+		}
+		if query.Descending {
+			return -c
+		}
+		return c
+	}
+
+	var rows = make([]*ExpressionRow, 0, len(all))
+	for _, row := range all {
+		var created = row.Created.UnixMilli()
+		switch {
+		case len(query.Statuses) != 0 && !slices.Contains(query.Statuses, row.Status):
+		case !query.CreatedFrom.IsZero() && created < query.CreatedFrom.UnixMilli():
+		case !query.CreatedTo.IsZero() && created >= query.CreatedTo.UnixMilli():
+		case query.Contains != "" && !strings.Contains(row.Expression, query.Contains):
+		case after != nil && compare(after.Key, after.ID, row) >= 0:
+		default:
+			rows = append(rows, row)
+		}
+	}
+
+	slices.SortFunc(rows, func(a, b *ExpressionRow) int {
+		return compare(sortKey(a, query.Sort), a.ID, b)
+	})
+
+	if len(rows) <= query.Limit {
+		return rows, "", nil
+	}
+
+	rows = rows[:query.Limit]
+	var last = rows[len(rows)-1]
+	next, err := (&cursor{Sort: query.Sort, Descending: query.Descending, Key: sortKey(last, query.Sort), ID: last.ID}).encode()
+
+	return rows, next, err
+}
+
+func (memory *Memory) AddTimingChanges(changes ...*TimingChange) error {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	for _, change := range changes {
+		var stored = *change
+		stored.Date = time.UnixMilli(change.Date.UnixMilli())
+		memory.changes = append(memory.changes, stored)
+	}
+
+	return nil
+}
+
+func (memory *Memory) GetTimingChanges() ([]*TimingChange, error) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	var changes = make([]*TimingChange, len(memory.changes))
+	for i := range memory.changes {
+		var change = memory.changes[i]
+		changes[i] = &change
+	}
+
+	return changes, nil
+}
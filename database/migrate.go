@@ -0,0 +1,256 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is a versioned change of the schema with the statements that undo it.
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// AppliedMigration is a migration recorded in the schema_migrations table
+type AppliedMigration struct {
+	Version int
+	Name    string
+	Applied time.Time
+}
+
+// Migrations returns the embedded migrations ordered by version
+func Migrations() ([]*Migration, error) {
+	var files, err = fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var byVersion = map[int]*Migration{}
+	for _, file := range files {
+		var (
+			base              = strings.TrimPrefix(file, "migrations/")
+			prefix, name, ok1 = strings.Cut(base, "_")
+			version, err      = strconv.Atoi(prefix)
+		)
+		if !ok1 || err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name %s", base)
+		}
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			name, direction = strings.TrimSuffix(name, ".up.sql"), "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			name, direction = strings.TrimSuffix(name, ".down.sql"), "down"
+		default:
+			return nil, fmt.Errorf("invalid migration file name %s", base)
+		}
+
+		content, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var migration, exists = byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, migration.Name, name)
+		}
+
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	var migrations = make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, migration)
+	}
+
+	slices.SortFunc(migrations, func(a, b *Migration) int { return a.Version - b.Version })
+
+	return migrations, nil
+}
+
+// LatestVersion returns the version of the last embedded migration
+func LatestVersion() (int, error) {
+	var migrations, err = Migrations()
+	if err != nil || len(migrations) == 0 {
+		return 0, err
+	}
+
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// createMigrationsTable creates the table of applied migrations. A database that does not
+// have it is at version 0, the schema of the first release.
+func (db *DB) createMigrationsTable() error {
+	var _, err = db.Connection.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied INT NOT NULL);`)
+	return err
+}
+
+// AppliedMigrations returns the applied migrations ordered by version
+func (db *DB) AppliedMigrations() ([]*AppliedMigration, error) {
+	if err := db.createMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Connection.Query(`SELECT version, name, applied FROM schema_migrations ORDER BY version;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied []*AppliedMigration
+	for rows.Next() {
+		var (
+			migration AppliedMigration
+			date      int64
+		)
+		if err = rows.Scan(&migration.Version, &migration.Name, &date); err != nil {
+			return nil, err
+		}
+
+		migration.Applied = time.UnixMilli(date)
+		applied = append(applied, &migration)
+	}
+
+	return applied, rows.Err()
+}
+
+// SchemaVersion returns the version of the last applied migration
+func (db *DB) SchemaVersion() (int, error) {
+	var applied, err = db.AppliedMigrations()
+	if err != nil || len(applied) == 0 {
+		return 0, err
+	}
+
+	return applied[len(applied)-1].Version, nil
+}
+
+// CheckSchema returns an error if migrations are pending or the schema is newer than this binary
+func (db *DB) CheckSchema() error {
+	var latest, err = LatestVersion()
+	if err != nil {
+		return err
+	}
+
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if current != latest {
+		return fmt.Errorf("schema version is %d, want %d", current, latest)
+	}
+
+	return nil
+}
+
+// Migrate applies or reverts migrations until the schema is at the target version.
+// Every migration runs in its own transaction together with its schema_migrations record.
+func (db *DB) Migrate(target int) error {
+	var migrations, err = Migrations()
+	if err != nil {
+		return err
+	}
+
+	if target < 0 || (target > 0 && !slices.ContainsFunc(migrations, func(m *Migration) bool { return m.Version == target })) {
+		return fmt.Errorf("unknown schema version %d", target)
+	}
+
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if current < target {
+		for _, migration := range migrations {
+			if migration.Version <= current || migration.Version > target {
+				continue
+			}
+
+			err = db.runMigration(migration.Up,
+				`INSERT INTO schema_migrations (version, name, applied) VALUES ($1, $2, $3);`,
+				migration.Version, migration.Name, time.Now().UnixMilli())
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			slog.Info("Migration applied", "version", migration.Version, "name", migration.Name)
+		}
+	}
+
+	if current > target {
+		for i := len(migrations) - 1; i >= 0; i-- {
+			var migration = migrations[i]
+			if migration.Version > current || migration.Version <= target {
+				continue
+			}
+
+			err = db.runMigration(migration.Down, `DELETE FROM schema_migrations WHERE version = $1;`, migration.Version)
+			if err != nil {
+				return fmt.Errorf("reverting migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			slog.Info("Migration reverted", "version", migration.Version, "name", migration.Name)
+		}
+	}
+
+	return nil
+}
+
+// MigrateUp applies all migrations that are not applied yet
+func (db *DB) MigrateUp() error {
+	var latest, err = LatestVersion()
+	if err != nil {
+		return err
+	}
+
+	return db.Migrate(latest)
+}
+
+// runMigration executes the statements of a migration and records it in one transaction
+func (db *DB) runMigration(statements, recordStmt string, args ...interface{}) error {
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(statements); err != nil {
+		return rollback(tx, err)
+	}
+
+	if _, err = tx.Exec(recordStmt, args...); err != nil {
+		return rollback(tx, err)
+	}
+
+	return tx.Commit()
+}
+
+// rollback rolls the transaction back and returns the error that caused it
+func rollback(tx *sql.Tx, err error) error {
+	if anErr := tx.Rollback(); anErr != nil {
+		return anErr
+	}
+
+	return err
+}
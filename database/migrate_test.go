@@ -0,0 +1,155 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// copyV0 copies data.db, a database of the first release, so that tests can upgrade it
+func copyV0(t *testing.T) string {
+	content, err := os.ReadFile("data.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var path = filepath.Join(t.TempDir(), "v0.db")
+	if err = os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// tableColumns returns the columns of the table, or nil if there is no such table
+func tableColumns(t *testing.T, db *DB, table string) []string {
+	rows, err := db.Connection.Query(`SELECT name FROM pragma_table_info($1);`, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err = rows.Scan(&column); err != nil {
+			t.Fatal(err)
+		}
+		columns = append(columns, column)
+	}
+
+	return columns
+}
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("migration %s has version %d, want %d", migration.Name, migration.Version, i+1)
+		}
+	}
+}
+
+func TestMigrate_UpgradeV0(t *testing.T) {
+	var path = copyV0(t)
+
+	db, err := OpenDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if version, err := db.SchemaVersion(); err != nil || version != 0 {
+		t.Fatalf("got version %d, %v, want 0", version, err)
+	}
+
+	// A row written by the first release has neither a status nor bindings
+	_, err = db.Connection.Exec(`INSERT INTO expressions (id, expression, value, user, date) VALUES ('old', '2+2', 4, 'name', 0), ('pending', '3+3', -1, 'name', 0);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := LatestVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, err := db.SchemaVersion(); err != nil || version != latest {
+		t.Fatalf("got version %d, %v, want %d", version, err, latest)
+	}
+
+	var columns = tableColumns(t, db, "expressions")
+	for _, column := range []string{"bindings", "status", "error", "estimated", "finished"} {
+		if !slices.Contains(columns, column) {
+			t.Errorf("column %s was not added, got %v", column, columns)
+		}
+	}
+
+	for _, table := range []string{"timings_audit", "variables"} {
+		if tableColumns(t, db, table) == nil {
+			t.Errorf("table %s was not created", table)
+		}
+	}
+
+	row, err := db.GetExpression("name", "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Status != "done" || row.Value != 4 || row.Error != "" {
+		t.Errorf("got %s %v %q, want the old row done with 4", row.Status, row.Value, row.Error)
+	}
+
+	var status string
+	if err = db.Connection.QueryRow(`SELECT status FROM expressions WHERE id = 'pending';`).Scan(&status); err != nil || status != "computing" {
+		t.Errorf("got status %q, %v, want computing", status, err)
+	}
+
+	// Migrating again changes nothing
+	if err = db.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrate_Down(t *testing.T) {
+	var path = copyV0(t)
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err = db.Migrate(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if columns := tableColumns(t, db, "expressions"); !slices.Equal(columns, []string{"id", "expression", "value", "user", "date"}) {
+		t.Errorf("got columns %v after reverting to version 1", columns)
+	}
+	if tableColumns(t, db, "variables") != nil {
+		t.Error("table variables must be dropped")
+	}
+
+	if err = db.Migrate(0); err != nil {
+		t.Fatal(err)
+	}
+	if tableColumns(t, db, "users") != nil {
+		t.Error("table users must be dropped")
+	}
+
+	if err = db.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.Migrate(100); err == nil {
+		t.Error("an unknown version must be rejected")
+	}
+}
@@ -0,0 +1,2 @@
+DROP TABLE expressions;
+DROP TABLE users;
@@ -0,0 +1,8 @@
+-- The schema of the first release, which created the tables without tracking migrations
+CREATE TABLE IF NOT EXISTS users (
+    name TEXT PRIMARY KEY,
+    password TEXT NOT NULL,
+    secret TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS expressions (id TEXT, expression TEXT, value INT, user TEXT, date INT, PRIMARY KEY (id, user));
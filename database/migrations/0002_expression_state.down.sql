@@ -0,0 +1,3 @@
+ALTER TABLE expressions DROP COLUMN error;
+ALTER TABLE expressions DROP COLUMN status;
+ALTER TABLE expressions DROP COLUMN bindings;
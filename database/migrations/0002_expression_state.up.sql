@@ -0,0 +1,6 @@
+ALTER TABLE expressions ADD COLUMN bindings TEXT;
+ALTER TABLE expressions ADD COLUMN status TEXT;
+ALTER TABLE expressions ADD COLUMN error TEXT;
+
+-- Rows written before statuses were recorded are done unless their value is -1
+UPDATE expressions SET status = CASE WHEN value = -1 THEN 'computing' ELSE 'done' END;
@@ -0,0 +1 @@
+DROP TABLE timings_audit;
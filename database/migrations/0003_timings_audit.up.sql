@@ -0,0 +1 @@
+CREATE TABLE timings_audit (id INTEGER PRIMARY KEY AUTOINCREMENT, user TEXT NOT NULL, operation TEXT NOT NULL, previous INT NOT NULL, current INT NOT NULL, date INT NOT NULL);
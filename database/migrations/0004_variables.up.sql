@@ -0,0 +1 @@
+CREATE TABLE variables (user TEXT NOT NULL, name TEXT NOT NULL, value REAL NOT NULL, PRIMARY KEY (user, name));
@@ -0,0 +1,7 @@
+DROP INDEX expressions_status;
+DROP INDEX expressions_estimated;
+DROP INDEX expressions_finished;
+DROP INDEX expressions_created;
+
+ALTER TABLE expressions DROP COLUMN finished;
+ALTER TABLE expressions DROP COLUMN estimated;
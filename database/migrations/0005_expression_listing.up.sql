@@ -0,0 +1,8 @@
+ALTER TABLE expressions ADD COLUMN estimated INT;
+ALTER TABLE expressions ADD COLUMN finished INT;
+
+-- The finished and estimated indexes are on the same expressions as the sort keys of ListExpressions
+CREATE INDEX expressions_created ON expressions (user, date, id);
+CREATE INDEX expressions_finished ON expressions (user, IFNULL(finished, 9223372036854775807), id);
+CREATE INDEX expressions_estimated ON expressions (user, IFNULL(estimated, 0), id);
+CREATE INDEX expressions_status ON expressions (user, status, date);
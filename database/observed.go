@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// Observed wraps the store so that observe receives the name, the duration and the error
+// of every call, for example to export query latencies
+func Observed(store Store, observe func(method string, duration time.Duration, err error)) Store {
+	return &observedStore{store: store, observe: observe}
+}
+
+type observedStore struct {
+	store   Store
+	observe func(method string, duration time.Duration, err error)
+}
+
+var _ Store = (*observedStore)(nil)
+
+// track is deferred with the start of a call and the address of its error
+func (s *observedStore) track(method string, started time.Time, err *error) {
+	s.observe(method, time.Since(started), *err)
+}
+
+func (s *observedStore) CreateUser(name, password string) (user *DBUser, err error) {
+	defer s.track("CreateUser", time.Now(), &err)
+	return s.store.CreateUser(name, password)
+}
+
+func (s *observedStore) GetUser(name string) (user *DBUser, err error) {
+	defer s.track("GetUser", time.Now(), &err)
+	return s.store.GetUser(name)
+}
+
+func (s *observedStore) GetUsers() (users []*DBUser, err error) {
+	defer s.track("GetUsers", time.Now(), &err)
+	return s.store.GetUsers()
+}
+
+func (s *observedStore) SetVariable(user, name string, value float64) (err error) {
+	defer s.track("SetVariable", time.Now(), &err)
+	return s.store.SetVariable(user, name, value)
+}
+
+func (s *observedStore) GetVariable(user, name string) (value float64, err error) {
+	defer s.track("GetVariable", time.Now(), &err)
+	return s.store.GetVariable(user, name)
+}
+
+func (s *observedStore) GetVariables(user string) (variables map[string]float64, err error) {
+	defer s.track("GetVariables", time.Now(), &err)
+	return s.store.GetVariables(user)
+}
+
+func (s *observedStore) DeleteVariable(user, name string) (err error) {
+	defer s.track("DeleteVariable", time.Now(), &err)
+	return s.store.DeleteVariable(user, name)
+}
+
+func (s *observedStore) AddExpressions(rows ...*ExpressionRow) (err error) {
+	defer s.track("AddExpressions", time.Now(), &err)
+	return s.store.AddExpressions(rows...)
+}
+
+func (s *observedStore) UpdateExpression(row *ExpressionRow) (err error) {
+	defer s.track("UpdateExpression", time.Now(), &err)
+	return s.store.UpdateExpression(row)
+}
+
+func (s *observedStore) GetExpression(user, id string) (row *ExpressionRow, err error) {
+	defer s.track("GetExpression", time.Now(), &err)
+	return s.store.GetExpression(user, id)
+}
+
+func (s *observedStore) GetExpressions(user string) (rows []*ExpressionRow, err error) {
+	defer s.track("GetExpressions", time.Now(), &err)
+	return s.store.GetExpressions(user)
+}
+
+func (s *observedStore) ListExpressions(user string, query ExpressionQuery) (rows []*ExpressionRow, cursor string, err error) {
+	defer s.track("ListExpressions", time.Now(), &err)
+	return s.store.ListExpressions(user, query)
+}
+
+func (s *observedStore) AddTimingChanges(changes ...*TimingChange) (err error) {
+	defer s.track("AddTimingChanges", time.Now(), &err)
+	return s.store.AddTimingChanges(changes...)
+}
+
+func (s *observedStore) GetTimingChanges() (changes []*TimingChange, err error) {
+	defer s.track("GetTimingChanges", time.Now(), &err)
+	return s.store.GetTimingChanges()
+}
+
+func (s *observedStore) Ping(ctx context.Context) (err error) {
+	defer s.track("Ping", time.Now(), &err)
+	return s.store.Ping(ctx)
+}
+
+func (s *observedStore) CheckSchema() (err error) {
+	defer s.track("CheckSchema", time.Now(), &err)
+	return s.store.CheckSchema()
+}
+
+func (s *observedStore) Close() (err error) {
+	defer s.track("Close", time.Now(), &err)
+	return s.store.Close()
+}
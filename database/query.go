@@ -0,0 +1,184 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Sort orders of ListExpressions
+const (
+	SortCreated   = "created"
+	SortFinished  = "finished"
+	SortEstimated = "estimated"
+)
+
+// sortKeys are the SQL expressions the listing is ordered by. Unfinished expressions
+// come after the finished ones. Every key is covered by one of expressionIndexes.
+var sortKeys = map[string]string{
+	SortCreated:   "date",
+	SortFinished:  "IFNULL(finished, 9223372036854775807)",
+	SortEstimated: "IFNULL(estimated, 0)",
+}
+
+// DefaultLimit is the page size used when the query does not set one
+const DefaultLimit = 50
+
+// ErrInvalidCursor is returned for a cursor that was not issued for the same sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ExpressionQuery selects a page of a user's expressions
+type ExpressionQuery struct {
+	Statuses    []string  // Any status if empty
+	CreatedFrom time.Time // Inclusive, not limited if zero
+	CreatedTo   time.Time // Exclusive, not limited if zero
+	Contains    string    // Substring of the expression, spaces are ignored
+	Sort        string    // One of the Sort orders, SortCreated if empty
+	Descending  bool
+	Limit       int
+	Cursor      string // Next cursor of the previous page
+}
+
+// cursor is the position after the last expression of a page
+type cursor struct {
+	Sort       string `json:"s"`
+	Descending bool   `json:"d"`
+	Key        int64  `json:"k"`
+	ID         string `json:"i"`
+}
+
+func (c *cursor) encode() (string, error) {
+	var encoded, err = json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+func decodeCursor(value string) (*cursor, error) {
+	var decoded, err = base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err = json.Unmarshal(decoded, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// normalize fills in the defaults of the query and decodes its cursor, which is nil on the first page
+func (query *ExpressionQuery) normalize() (*cursor, error) {
+	if query.Sort == "" {
+		query.Sort = SortCreated
+	}
+	if query.Limit <= 0 {
+		query.Limit = DefaultLimit
+	}
+	if _, ok := sortKeys[query.Sort]; !ok {
+		return nil, fmt.Errorf("unknown sort order %s", query.Sort)
+	}
+
+	// Expressions are stored without spaces
+	query.Contains = strings.Join(strings.Fields(query.Contains), "")
+
+	if query.Cursor == "" {
+		return nil, nil
+	}
+
+	var after, err = decodeCursor(query.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	if after.Sort != query.Sort || after.Descending != query.Descending {
+		return nil, ErrInvalidCursor
+	}
+
+	return after, nil
+}
+
+// ListExpressions returns a page of the user's expressions matching the query and the cursor
+// of the next page, which is empty on the last page
+func (db *DB) ListExpressions(user string, query ExpressionQuery) ([]*ExpressionRow, string, error) {
+	var after, err = query.normalize()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var key = sortKeys[query.Sort]
+	var (
+		conditions = []string{"user = ?"}
+		args       = []interface{}{user}
+		direction  = "ASC"
+		comparison = ">"
+	)
+	if query.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if len(query.Statuses) != 0 {
+		conditions = append(conditions, "status IN (?"+strings.Repeat(", ?", len(query.Statuses)-1)+")")
+		for _, status := range query.Statuses {
+			args = append(args, status)
+		}
+	}
+
+	if !query.CreatedFrom.IsZero() {
+		conditions = append(conditions, "date >= ?")
+		args = append(args, query.CreatedFrom.UnixMilli())
+	}
+
+	if !query.CreatedTo.IsZero() {
+		conditions = append(conditions, "date < ?")
+		args = append(args, query.CreatedTo.UnixMilli())
+	}
+
+	if query.Contains != "" {
+		conditions = append(conditions, "instr(expression, ?) > 0")
+		args = append(args, query.Contains)
+	}
+
+	if after != nil {
+		conditions = append(conditions, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", key, comparison))
+		args = append(args, after.Key, after.Key, after.ID)
+	}
+
+	// One more row tells whether there is a next page
+	args = append(args, query.Limit+1)
+
+	var listStmt = fmt.Sprintf(`SELECT %s, %s FROM expressions WHERE %s ORDER BY %s %s, id %s LIMIT ?;`,
+		expressionColumns, key, strings.Join(conditions, " AND "), key, direction, direction)
+
+	rows, err := db.Connection.Query(listStmt, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var (
+		exprs = make([]*ExpressionRow, 0, query.Limit)
+		last  cursor
+	)
+	for rows.Next() {
+		if len(exprs) == query.Limit {
+			var next, err = last.encode()
+			return exprs, next, err
+		}
+
+		row, err := scanExpression(rows.Scan, &last.Key)
+		if err != nil {
+			return nil, "", err
+		}
+
+		last.Sort, last.Descending, last.ID = query.Sort, query.Descending, row.ID
+		exprs = append(exprs, row)
+	}
+
+	return exprs, "", rows.Err()
+}
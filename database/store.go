@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when the requested user, expression or variable does not exist
+var ErrNotFound = errors.New("not found")
+
+type DBUser struct {
+	Name     string
+	Password string
+	Secret   string
+}
+
+// TimingChange is a single audit record of an operation execution time change
+type TimingChange struct {
+	User      string
+	Operation string
+	Previous  time.Duration
+	Current   time.Duration
+	Date      time.Time
+}
+
+// ExpressionRow is the stored state of a user's expression
+type ExpressionRow struct {
+	ID         string
+	User       string
+	Expression string
+	Value      float64 // The result, valid only when Status is done
+	Status     string
+	Error      string // The error of a failed expression
+	Created    time.Time
+	Finished   time.Time // Zero until the expression is done or failed
+	Estimated  time.Duration
+	Bindings   map[string]float64
+}
+
+// UserStore keeps users and their variables
+type UserStore interface {
+	// CreateUser generates a secret and adds a new user
+	CreateUser(name, password string) (*DBUser, error)
+	// GetUser returns ErrNotFound if there is no such user
+	GetUser(name string) (*DBUser, error)
+	GetUsers() ([]*DBUser, error)
+
+	// SetVariable creates the user's variable or changes its value
+	SetVariable(user, name string, value float64) error
+	// GetVariable returns ErrNotFound if there is no such variable
+	GetVariable(user, name string) (float64, error)
+	GetVariables(user string) (map[string]float64, error)
+	// DeleteVariable returns ErrNotFound if there is no such variable
+	DeleteVariable(user, name string) error
+}
+
+// ExpressionStore keeps the state of users' expressions. It does not compute them.
+type ExpressionStore interface {
+	// AddExpressions adds all rows or, if one of them cannot be added, none of them
+	AddExpressions(rows ...*ExpressionRow) error
+	// UpdateExpression saves the value, status, error and finishing time of the row
+	UpdateExpression(row *ExpressionRow) error
+	// GetExpression returns ErrNotFound if there is no such expression
+	GetExpression(user, id string) (*ExpressionRow, error)
+	// GetExpressions returns all expressions of the user in order of creation
+	GetExpressions(user string) ([]*ExpressionRow, error)
+	// ListExpressions returns a page of the user's expressions and the cursor of the next page
+	ListExpressions(user string, query ExpressionQuery) ([]*ExpressionRow, string, error)
+}
+
+// TimingStore keeps the audit trail of operation execution times
+type TimingStore interface {
+	// AddTimingChanges records all changes or none of them
+	AddTimingChanges(changes ...*TimingChange) error
+	// GetTimingChanges returns the changes, oldest first
+	GetTimingChanges() ([]*TimingChange, error)
+}
+
+// Store is everything the server keeps. DB stores it in SQLite and Memory in memory.
+type Store interface {
+	UserStore
+	ExpressionStore
+	TimingStore
+	// Ping checks that the store can be reached
+	Ping(ctx context.Context) error
+	// CheckSchema returns an error if the schema is not at the latest version
+	CheckSchema() error
+	Close() error
+}
+
+var (
+	_ Store = (*DB)(nil)
+	_ Store = (*Memory)(nil)
+)
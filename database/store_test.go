@@ -0,0 +1,279 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// forEachStore runs the test against every Store implementation
+func forEachStore(t *testing.T, test func(t *testing.T, store Store)) {
+	t.Run("sqlite", func(t *testing.T) { test(t, newTestDB(t)) })
+	t.Run("memory", func(t *testing.T) { test(t, NewMemory()) })
+}
+
+func TestStore_GetUser(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		created, err := store.CreateUser("name", "password")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = store.CreateUser("name", "other"); err == nil {
+			t.Error("The user 'name' already exists")
+		}
+
+		user, err := store.GetUser("name")
+		if err != nil {
+			t.Fatal(err)
+		} else if *user != *created {
+			t.Errorf("got %v, want %v", user, created)
+		}
+
+		if _, err = store.GetUser("wrongName"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("got %v, want ErrNotFound", err)
+		}
+
+		if _, err = store.CreateUser("another", "password"); err != nil {
+			t.Fatal(err)
+		}
+
+		users, err := store.GetUsers()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, user := range users {
+			names = append(names, user.Name)
+		}
+		slices.Sort(names)
+		if !slices.Equal(names, []string{"another", "name"}) {
+			t.Errorf("got users %v, want [another name]", names)
+		}
+	})
+}
+
+func TestStore_GetExpression(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		row := &ExpressionRow{
+			ID:         "1",
+			User:       "name",
+			Expression: "1+x",
+			Value:      -1,
+			Status:     "computing",
+			Created:    time.Now(),
+			Estimated:  time.Second,
+			Bindings:   map[string]float64{"x": 1},
+		}
+
+		if err := store.AddExpressions(row); err != nil {
+			t.Fatal(err)
+		}
+
+		// Finishing the expression changes only its state
+		var finished = *row
+		finished.Value, finished.Status, finished.Finished = 2, "done", row.Created.Add(time.Second)
+		if err := store.UpdateExpression(&finished); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := store.GetExpression("name", "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.Expression != row.Expression || got.Value != 2 || got.Status != "done" || got.Error != "" ||
+			got.Created.UnixMilli() != row.Created.UnixMilli() || got.Finished.UnixMilli() != finished.Finished.UnixMilli() ||
+			got.Estimated != time.Second || got.Bindings["x"] != 1 {
+			t.Errorf("got %+v, want %+v", got, finished)
+		}
+
+		if _, err = store.GetExpression("another", "1"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("got %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStore_AddExpressions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		var created = time.UnixMilli(time.Now().UnixMilli())
+		err := store.AddExpressions(
+			&ExpressionRow{ID: "b", User: "name", Expression: "2+2", Value: 4, Status: "done", Created: created},
+			&ExpressionRow{ID: "a", User: "name", Expression: "1+1", Value: 2, Status: "done", Created: created},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// "b" already exists, so "c" must not be written either
+		err = store.AddExpressions(
+			&ExpressionRow{ID: "c", User: "name", Expression: "4+4", Value: 8, Status: "done", Created: created},
+			&ExpressionRow{ID: "b", User: "name", Expression: "3+3", Value: 6, Status: "done", Created: created},
+		)
+		if err == nil {
+			t.Fatal("Duplicate ID must fail the whole batch")
+		}
+
+		// The same ID of another user is a different expression
+		err = store.AddExpressions(&ExpressionRow{ID: "a", User: "another", Expression: "5+5", Value: 10, Status: "done", Created: created})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rows, err := store.GetExpressions("name")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var IDs []string
+		for _, row := range rows {
+			IDs = append(IDs, row.ID)
+		}
+		if !slices.Equal(IDs, []string{"a", "b"}) {
+			t.Errorf("got expressions %v, want [a b]", IDs)
+		}
+	})
+}
+
+func TestStore_GetTimingChanges(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		changes := []*TimingChange{
+			{User: "name", Operation: "addition", Previous: 500 * time.Millisecond, Current: 750 * time.Millisecond, Date: time.UnixMilli(time.Now().UnixMilli())},
+			{User: "name", Operation: "division", Previous: 1500 * time.Millisecond, Current: 2 * time.Second, Date: time.UnixMilli(time.Now().UnixMilli())},
+		}
+
+		err := store.AddTimingChanges(changes...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		newChanges, err := store.GetTimingChanges()
+		if err != nil {
+			t.Fatal(err)
+		} else if len(newChanges) != len(changes) {
+			t.Fatalf("Expected %d changes, got %d", len(changes), len(newChanges))
+		}
+
+		for i, change := range newChanges {
+			if change.User != changes[i].User || change.Operation != changes[i].Operation || change.Previous != changes[i].Previous ||
+				change.Current != changes[i].Current || !change.Date.Equal(changes[i].Date) {
+				t.Fatalf("Changes are not equal: %v != %v", change, changes[i])
+			}
+		}
+	})
+}
+
+func TestStore_Variables(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		if err := store.SetVariable("name", "price", 2.5); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.SetVariable("name", "price", 3); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.SetVariable("another", "price", 10); err != nil {
+			t.Fatal(err)
+		}
+
+		variables, err := store.GetVariables("name")
+		if err != nil {
+			t.Fatal(err)
+		} else if len(variables) != 1 || variables["price"] != 3 {
+			t.Fatalf("Unexpected variables: %v", variables)
+		}
+
+		if err = store.DeleteVariable("name", "price"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = store.GetVariable("name", "price"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("The variable 'price' was deleted, got %v", err)
+		}
+
+		if err = store.DeleteVariable("name", "price"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("There is no variable 'price' to delete, got %v", err)
+		}
+
+		if value, err := store.GetVariable("another", "price"); err != nil || value != 10 {
+			t.Errorf("got %v, %v, want 10", value, err)
+		}
+	})
+}
+
+func TestStore_ListExpressions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		var start = time.UnixMilli(time.Now().UnixMilli())
+		for i := 0; i < 5; i++ {
+			var row = &ExpressionRow{
+				ID:         strconv.Itoa(i),
+				User:       "name",
+				Expression: fmt.Sprintf("%d+1", i),
+				Value:      -1,
+				Status:     "computing",
+				Created:    start.Add(time.Duration(i) * time.Second),
+				Estimated:  time.Duration(5-i) * time.Second,
+			}
+			if i%2 == 0 {
+				row.Value, row.Status, row.Finished = float64(i+1), "done", start.Add(10*time.Second)
+			}
+
+			if err := store.AddExpressions(row); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var list = func(query ExpressionQuery) []string {
+			var IDs []string
+			for {
+				rows, next, err := store.ListExpressions("name", query)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for _, row := range rows {
+					IDs = append(IDs, row.ID)
+				}
+
+				if next == "" {
+					return IDs
+				}
+				query.Cursor = next
+			}
+		}
+
+		tests := []struct {
+			query ExpressionQuery
+			want  []string
+		}{
+			{ExpressionQuery{Limit: 2}, []string{"0", "1", "2", "3", "4"}},
+			{ExpressionQuery{Limit: 2, Descending: true}, []string{"4", "3", "2", "1", "0"}},
+			{ExpressionQuery{Limit: 2, Sort: SortEstimated}, []string{"4", "3", "2", "1", "0"}},
+			{ExpressionQuery{Limit: 2, Sort: SortFinished}, []string{"0", "2", "4", "1", "3"}},
+			{ExpressionQuery{Limit: 1, Sort: SortFinished, Statuses: []string{"done"}}, []string{"0", "2", "4"}},
+			{ExpressionQuery{Limit: 2, Statuses: []string{"computing"}}, []string{"1", "3"}},
+			{ExpressionQuery{CreatedFrom: start.Add(time.Second), CreatedTo: start.Add(3 * time.Second)}, []string{"1", "2"}},
+			{ExpressionQuery{Contains: "3 + 1"}, []string{"3"}},
+		}
+
+		for i, test := range tests {
+			if got := list(test.query); !slices.Equal(got, test.want) {
+				t.Errorf("query %d: got %v, want %v", i, got, test.want)
+			}
+		}
+
+		_, next, err := store.ListExpressions("name", ExpressionQuery{Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err = store.ListExpressions("name", ExpressionQuery{Limit: 1, Sort: SortEstimated, Cursor: next}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("a cursor of another sort order must be rejected, got %v", err)
+		}
+	})
+}
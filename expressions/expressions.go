@@ -3,141 +3,578 @@ package expressions
 import (
 	// Импорт зависимостей из других пакетов проекта и стандартных библиотек
 	"Distributed-arithmetic-expression-evaluator-version-2.0/calculator"
-	"Distributed-arithmetic-expression-evaluator-version-2.0/data"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/database"
 	"Distributed-arithmetic-expression-evaluator-version-2.0/rest"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/tracing"
+	"context"
 	"errors"
-	"slices"
+	"fmt"
+	"log/slog"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
 // Expressions структура для управления коллекцией арифметических выражений.
 type Expressions struct {
-	IDs map[string]*rest.Expression // Мапа, связывающая ID с объектами Expression
-	mu  sync.Mutex                  // Мьютекс для синхронизации доступа к мапе
+	IDs       map[string]*rest.Expression // Мапа, связывающая ID с объектами Expression
+	mu        sync.Mutex                  // Мьютекс для синхронизации доступа к мапе
+	user      string                      // Владелец выражений
+	store     database.ExpressionStore    // Хранилище выражений, может отсутствовать
+	scheduler *calculator.Scheduler       // Вычислитель выражений коллекции
 }
 
-// NewExpressions создает и возвращает новый экземпляр структуры Expressions.
-func NewExpressions() *Expressions {
+// NewExpressions создает и возвращает новый экземпляр структуры Expressions,
+// выражения которого вычисляет scheduler.
+func NewExpressions(scheduler *calculator.Scheduler) *Expressions {
 	return &Expressions{
-		IDs: map[string]*rest.Expression{},
-		mu:  sync.Mutex{},
+		IDs:       map[string]*rest.Expression{},
+		mu:        sync.Mutex{},
+		scheduler: scheduler,
 	}
 }
 
-// AddExpression добавляет новое выражение в коллекцию.
-func (express *Expressions) AddExpression(ID, expr string, args ...interface{}) (*rest.Expression, error) {
-	express.mu.Lock() // Блокировка для безопасного доступа к мапе
-	var keys = rest.MapGetKeys(express.IDs)
-	express.mu.Unlock() // Разблокировка после доступа к мапе
+// Now возвращает текущее время по часам вычислителя коллекции.
+func (express *Expressions) Now() time.Time {
+	return express.scheduler.Clock().Now()
+}
 
-	// Проверка, существует ли уже выражение с таким ID
-	if slices.Contains(keys, ID) {
-		return nil, rest.NewError("An expression with ID %s is already exists", ID)
+// SetStore задаёт хранилище, в которое записываются новые выражения и результаты вычислений.
+func (express *Expressions) SetStore(user string, store database.ExpressionStore) {
+	express.mu.Lock()
+	defer express.mu.Unlock()
+
+	express.user = user
+	express.store = store
+}
+
+// Load загружает выражения пользователя из хранилища и запускает вычисление незавершённых.
+func Load(store database.ExpressionStore, scheduler *calculator.Scheduler, user string) (*Expressions, error) {
+	var rows, err = store.GetExpressions(user)
+	if err != nil {
+		return nil, err
+	}
+
+	var express = NewExpressions(scheduler)
+	express.SetStore(user, store)
+	for _, row := range rows {
+		express.Restore(row.ID, FromRow(scheduler.Timings(), row))
+	}
+
+	// Незавершённые выражения вычисляются после загрузки всех, чтобы ссылки на них разрешились
+	express.Resume()
+
+	return express, nil
+}
+
+// NewRow возвращает текущее состояние выражения для записи в хранилище.
+func NewRow(ID, user string, ex *rest.Expression) *database.ExpressionRow {
+	var status, value, err = ex.State()
+
+	var row = &database.ExpressionRow{
+		ID:         ID,
+		User:       user,
+		Expression: ex.Express,
+		Value:      value,
+		Status:     status,
+		Created:    ex.Created,
+		Finished:   ex.FinishedAt(),
+		Estimated:  ex.Expiration,
+		Bindings:   ex.Bindings,
+	}
+	if err != nil {
+		row.Error = err.Error()
+	}
+
+	return row
+}
+
+// FromRow восстанавливает выражение из хранилища. Состояние берётся из статуса строки.
+// Выражение, которое больше не разбирается, восстанавливается завершившимся ошибкой.
+func FromRow(timings *calculator.Timings, row *database.ExpressionRow) *rest.Expression {
+	ex, err := NewExpression(timings, row.Expression, row.Bindings, row.Created)
+	switch {
+	case err != nil:
+		ex = &rest.Expression{Value: -1, Express: row.Expression, Created: row.Created, Bindings: row.Bindings}
+		ex.Fail(err)
+	case row.Status == rest.StatusDone:
+		ex.Finish(row.Value)
+	case row.Status == rest.StatusFailed:
+		ex.Fail(errors.New(row.Error))
+	}
+
+	if !row.Finished.IsZero() {
+		ex.Finished = row.Finished
 	}
 
+	return ex
+}
+
+// AddExpression добавляет новое выражение в коллекцию.
+// bindings - значения переменных, с которыми выражение вычисляется.
+// Вычисление записывается в новую трассу, связанную с текущим span ctx.
+func (express *Expressions) AddExpression(ctx context.Context, ID, expr string, bindings map[string]float64, args ...interface{}) (*rest.Expression, error) {
 	var (
-		date  = time.Now()
-		value = -1
+		date  = express.Now()
+		value float64
 	)
 	if err := errors.New(""); args != nil {
 		date = args[0].(time.Time)
-		value, err = strconv.Atoi(args[1].(string))
+		value, err = strconv.ParseFloat(args[1].(string), 64)
 		if err != nil {
 			return nil, rest.NewError("Invalid value %s", args[1].(string))
 		}
 	}
 
-	var ex, err = NewExpression(expr, date, value)
+	var ex, err = NewExpression(express.scheduler.Timings(), expr, bindings, date)
 	if err != nil {
 		return nil, err
 	}
+	ex.SetClock(express.Now)
+	if args != nil {
+		ex.Finish(value) // Выражение с известным результатом не вычисляется
+	}
 
-	express.mu.Lock()
+	express.mu.Lock() // Блокировка для безопасного доступа к мапе
+	if err = express.check(ID, ex); err != nil {
+		express.mu.Unlock()
+		return nil, err
+	}
 	express.IDs[ID] = ex
-	express.mu.Unlock()
+	var user, store = express.user, express.store
+	express.mu.Unlock() // Разблокировка после доступа к мапе
 
-	if value == -1 {
-		go calculator.Calculator(ex) // Запуск вычисления выражения в отдельной горутине
+	ctx, span := express.trace(ctx, ID, ex)
+
+	if store != nil {
+		if err = express.persist(ctx, "AddExpressions", func() error { return store.AddExpressions(NewRow(ID, user, ex)) }); err != nil {
+			express.mu.Lock()
+			delete(express.IDs, ID)
+			express.mu.Unlock()
+			span.SetError(err)
+			span.End()
+			return nil, err
+		}
 	}
 
-	if err != nil {
-		return nil, err
+	if status, _, _ := ex.State(); status != rest.StatusDone {
+		express.scheduler.Submitted()
+		go express.schedule(ctx, span, ID, ex) // Запуск вычисления выражения в отдельной горутине
+	} else {
+		span.End()
 	}
 
 	return ex, nil
 }
 
-// Delete удаляет выражения по их ID.
-func (express *Expressions) Delete(IDs ...string) {
-	defer express.mu.Unlock()
-	express.mu.Lock()
-	for _, key := range IDs {
-		delete(express.IDs, key)
+// AddExpressions добавляет несколько готовых выражений. Каждое проверяется отдельно в порядке
+// следования, поэтому выражение может ссылаться на предыдущие выражения пакета. Принятые выражения
+// записываются в хранилище одной операцией: если запись не удалась, не добавляется ни одно.
+// Возвращает ошибку проверки каждого выражения (nil для принятых) и ошибку записи.
+// Запись пакета относится к текущему span ctx, каждое выражение вычисляется в своей трассе.
+func (express *Expressions) AddExpressions(ctx context.Context, IDs []string, exprs []*rest.Expression) ([]error, error) {
+	var (
+		errs     = make([]error, len(IDs))
+		accepted = make(map[string]*rest.Expression, len(IDs))
+		rows     = make([]*database.ExpressionRow, 0, len(IDs))
+	)
+
+	express.mu.Lock() // Блокировка на всё время проверки, чтобы пакет не смешался с другими выражениями
+	var user, store = express.user, express.store
+	for i, ID := range IDs {
+		if errs[i] = express.check(ID, exprs[i]); errs[i] == nil {
+			express.IDs[ID] = exprs[i]
+			accepted[ID] = exprs[i]
+			rows = append(rows, NewRow(ID, user, exprs[i]))
+		}
 	}
+	express.mu.Unlock()
 
-	_ = express.UploadExpressions("data/data_expressions.csv")
-}
+	if store != nil && len(rows) != 0 {
+		if err := express.persist(ctx, "AddExpressions", func() error { return store.AddExpressions(rows...) }); err != nil {
+			express.mu.Lock()
+			for ID := range accepted {
+				delete(express.IDs, ID)
+			}
+			express.mu.Unlock()
+			return errs, err
+		}
+	}
 
-// Lock блокирует мьютекс для внешнего доступа
-func (express *Expressions) Lock() {
-	express.mu.Lock()
+	for ID, ex := range accepted {
+		if status, _, _ := ex.State(); status != rest.StatusDone && status != rest.StatusFailed {
+			var exCtx, span = express.trace(ctx, ID, ex)
+			express.scheduler.Submitted()
+			go express.schedule(exCtx, span, ID, ex)
+		}
+	}
+
+	return errs, nil
 }
 
-// Unlock разблокирует мьютекс после внешнего доступа
-func (express *Expressions) Unlock() {
-	express.mu.Unlock()
+// Ошибки проверки нового выражения, к которым сводятся ошибки AddExpression и AddExpressions
+var (
+	ErrDuplicateID       = errors.New("duplicate expression ID")
+	ErrUnknownReference  = errors.New("unknown reference")
+	ErrCircularReference = errors.New("circular reference")
+)
+
+// checkError ошибка проверки с сообщением для пользователя, сводящаяся к одной из ошибок выше
+type checkError struct {
+	kind    error
+	message string
 }
 
-// DownloadExpressions загружает выражения из файла CSV.
-func (express *Expressions) DownloadExpressions(name string) error {
-	var info, err = data.OpenCSV(name, ';')
-	if err != nil {
-		return err
+func (err *checkError) Error() string { return err.message }
+
+func (err *checkError) Unwrap() error { return err.kind }
+
+// check проверяет, что ID свободен, а выражения, на которые ссылается новое, существуют
+// и не образуют цикл. Вызывается под мьютексом.
+func (express *Expressions) check(ID string, ex *rest.Expression) error {
+	// Проверка, существует ли уже выражение с таким ID
+	if _, ok := express.IDs[ID]; ok {
+		return &checkError{ErrDuplicateID, fmt.Sprintf("An expression with ID %s is already exists", ID)}
 	}
 
-	for i, val := range info {
-		if i == 0 {
-			continue // Пропускаем заголовок файла
+	var graph = map[string][]string{ID: ex.Dependencies}
+	for key, val := range express.IDs {
+		graph[key] = val.Dependencies
+	}
+
+	for _, dependency := range ex.Dependencies {
+		if _, ok := graph[dependency]; !ok {
+			return &checkError{ErrUnknownReference, "There is no such expression: $" + dependency}
 		}
+	}
 
-		if val[2] != "-1" {
-			var expr, err = NewExpression(val[1])
-			digit, err := strconv.Atoi(val[2])
-			if err != nil {
-				return err
+	if cycle := FindCycle(graph, ID); cycle != nil {
+		return &checkError{ErrCircularReference, "Circular reference: $" + strings.Join(cycle, " -> $")}
+	}
+
+	return nil
+}
+
+// FindCycle возвращает цикл ссылок, проходящий через start, или nil, если его нет.
+// graph связывает ID выражения с ID выражений, на которые оно ссылается.
+func FindCycle(graph map[string][]string, start string) []string {
+	var (
+		visited = map[string]bool{}
+		path    []string
+		search  func(ID string) bool
+	)
+
+	search = func(ID string) bool {
+		path = append(path, ID)
+		for _, dependency := range graph[ID] {
+			if dependency == start {
+				path = append(path, start)
+				return true
 			}
-			expr.Value = digit
 
-			express.Lock()
-			express.IDs[val[0]] = expr
-			express.Unlock()
-		} else {
-			_, err = express.AddExpression(val[0], val[1])
-			if err != nil {
-				return err
+			if !visited[dependency] {
+				visited[dependency] = true
+				if search(dependency) {
+					return true
+				}
 			}
 		}
+		path = path[:len(path)-1]
+
+		return false
+	}
+
+	if search(start) {
+		return path
 	}
 
 	return nil
 }
 
-// UploadExpressions сохраняет текущие выражения в файл CSV.
-func (express *Expressions) UploadExpressions(name string) error {
-	var csvFile = make([][]string, 0)
-	csvFile = append(csvFile, []string{"ID", "Expression", "Value"})
+// trace начинает трассу вычисления выражения, связанную с текущим span ctx.
+// Возвращает контекст с корневым span трассы, который завершает schedule.
+func (express *Expressions) trace(ctx context.Context, ID string, ex *rest.Expression) (context.Context, *tracing.Span) {
+	express.mu.Lock()
+	var user = express.user
+	express.mu.Unlock()
+
+	// Вычисление продолжается после ответа на запрос, поэтому от ctx берутся только значения
+	ctx, span := express.scheduler.Tracer().StartTrace(context.WithoutCancel(ctx), "expression",
+		"expression.id", ID, "user", user, "content", ex.Express)
+	ex.SetTrace(span.Context().TraceID)
 
-	for key, val := range express.GetExpressions() {
-		var expr = []string{key, val.Express, strconv.Itoa(val.Value)}
-		csvFile = append(csvFile, expr)
+	return ctx, span
+}
+
+// persist выполняет запись в хранилище в span с именем вызванного метода, если ctx трассируется.
+func (express *Expressions) persist(ctx context.Context, method string, write func() error) error {
+	if tracing.SpanFromContext(ctx) == nil {
+		return write() // Запись вне вычисления, например отмена, не начинает отдельную трассу
 	}
 
-	var err = data.WriteCSV(csvFile, name, ';')
+	var _, span = express.scheduler.Tracer().Start(ctx, "persist", "db.method", method)
+	var err = write()
+	span.SetError(err)
+	span.End()
+
 	return err
 }
 
+// schedule ждёт завершения выражений, на которые ссылается выражение, и вычисляет его.
+// Если одно из них завершилось ошибкой, выражение тоже завершается ошибкой.
+// Если вычислитель остановлен, выражение остаётся незавершённым и вычисляется после перезапуска.
+// span - корневой span трассы выражения, он завершается после записи результата.
+func (express *Expressions) schedule(ctx context.Context, span *tracing.Span, ID string, ex *rest.Expression) {
+	var (
+		acquired bool
+		logger   = express.logger(ID)
+		clock    = express.scheduler.Clock()
+		started  = clock.Now()
+	)
+	defer func() {
+		express.save(ctx, ID, ex)
+		var status, _, err = ex.State()
+		span.SetAttributes("status", status)
+		span.SetError(err)
+		span.End()
+		if status == rest.StatusDone || status == rest.StatusFailed {
+			express.scheduler.Finished(status)
+			if err != nil {
+				logger.Info("Expression failed", "status", status, "error", err, "duration", clock.Now().Sub(started))
+			} else {
+				logger.Info("Expression computed", "status", status, "duration", clock.Now().Sub(started))
+			}
+		} else {
+			logger.Info("Expression left unfinished by the stopped scheduler", "status", status)
+		}
+		if acquired {
+			express.scheduler.Release() // После записи результата, чтобы его дождалась остановка сервера
+		}
+	}()
+
+	var (
+		references = make(map[string]float64, len(ex.Dependencies))
+		_, waiting = express.scheduler.Tracer().Start(ctx, "dependencies", "dependencies", strings.Join(ex.Dependencies, ","))
+	)
+	for _, dependency := range ex.Dependencies {
+		var dep, err = express.GetExpression(dependency)
+		if err != nil {
+			ex.Fail(err)
+			waiting.SetError(err)
+			waiting.End()
+			return
+		}
+
+		select {
+		case <-dep.Done():
+		case <-ex.Done():
+			waiting.End()
+			return // Выражение отменено, пока ждало
+		}
+
+		_, value, err := dep.State()
+		if err != nil {
+			ex.Fail(rest.NewError("Expression $%s failed: %v", dependency, err))
+			waiting.SetError(err)
+			waiting.End()
+			return
+		}
+
+		references[dependency] = value
+	}
+	waiting.End()
+
+	if isDone(ex) {
+		return // Выражение отменено, пока ждало
+	}
+
+	logger.Debug("Waiting for a worker")
+	var _, queued = express.scheduler.Tracer().Start(ctx, "queue", "queue.depth", express.scheduler.Queued())
+	acquired = express.scheduler.Acquire()
+	queued.End()
+	if !acquired {
+		return
+	}
+
+	logger.Debug("Computing started", "waited", clock.Now().Sub(started))
+	ex.SetClock(clock.Now)
+	if !ex.Start(references) {
+		return // Выражение отменено в очереди, место освобождается при выходе
+	}
+	if len(ex.Dependencies) != 0 {
+		express.save(ctx, ID, ex) // Выражение перестало ожидать и вычисляется
+	}
+	express.scheduler.Calculator(ctx, ex, logger)
+}
+
+// isDone сообщает, завершено ли выражение, например отменено
+func isDone(ex *rest.Expression) bool {
+	select {
+	case <-ex.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// ETA оценивает, через сколько будет вычислено выражение: после выражений, на которые оно ссылается,
+// ожидания свободного места и оставшейся части лучшего случая. Для завершённых выражений возвращает 0.
+// Оценка обновляется по мере вычисления.
+func (express *Expressions) ETA(ID string) (time.Duration, error) {
+	var (
+		exprs = express.GetExpressions()
+		known = map[string]time.Duration{}
+		now   = express.Now()
+		eta   func(ID string) time.Duration
+	)
+	if _, ok := exprs[ID]; !ok {
+		return 0, rest.NewError("There is no such expression: %s", ID)
+	}
+
+	eta = func(ID string) time.Duration {
+		if duration, ok := known[ID]; ok {
+			return duration
+		}
+		known[ID] = 0 // Циклы ссылок отклоняются при добавлении, но оценка не должна зациклиться
+
+		var ex, ok = exprs[ID]
+		if !ok {
+			return 0
+		}
+
+		var (
+			status, _, _ = ex.State()
+			started      = ex.StartedAt()
+			duration     time.Duration
+		)
+		switch {
+		case status == rest.StatusDone || status == rest.StatusFailed:
+		case !started.IsZero():
+			duration = max(ex.Expiration-now.Sub(started), 0)
+		default:
+			var dependencies time.Duration
+			for _, dependency := range ex.Dependencies {
+				dependencies = max(dependencies, eta(dependency))
+			}
+
+			// Выражение, которое ещё ждёт другие, встанет в очередь за всеми, кто уже в ней.
+			// Порядок очереди не известен, поэтому выражение в ней считается последним.
+			var ahead = express.scheduler.Queued()
+			if dependencies == 0 {
+				ahead = max(ahead-1, 0)
+			}
+			duration = dependencies + express.scheduler.QueueWait(ahead, ex.Expiration) + ex.Expiration
+		}
+
+		known[ID] = duration
+		return duration
+	}
+
+	return eta(ID), nil
+}
+
+// ErrFinished возвращается при отмене выражения, которое уже вычислено или завершилось ошибкой.
+var ErrFinished = errors.New("the expression is already finished")
+
+// Cancel отменяет вычисление выражения. Выражения, которые на него ссылаются, завершаются ошибкой.
+func (express *Expressions) Cancel(ID string) (*rest.Expression, error) {
+	var ex, err = express.GetExpression(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ex.Cancel() {
+		return ex, ErrFinished
+	}
+	express.save(context.Background(), ID, ex)
+
+	return ex, nil
+}
+
+// Flush записывает в хранилище текущее состояние всех выражений коллекции.
+func (express *Expressions) Flush() error {
+	express.mu.Lock()
+	var user, store = express.user, express.store
+	express.mu.Unlock()
+
+	if store == nil {
+		return nil
+	}
+
+	var errs []error
+	for ID, ex := range express.GetExpressions() {
+		if err := store.UpdateExpression(NewRow(ID, user, ex)); err != nil {
+			errs = append(errs, fmt.Errorf("expression %s: %w", ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// logger возвращает журнал вычислителя с владельцем и ID выражения, которые добавляются к каждой записи.
+func (express *Expressions) logger(ID string) *slog.Logger {
+	express.mu.Lock()
+	var user = express.user
+	express.mu.Unlock()
+
+	return express.scheduler.Logger().With("user", user, "expression", ID)
+}
+
+// save записывает текущее состояние выражения в хранилище.
+func (express *Expressions) save(ctx context.Context, ID string, ex *rest.Expression) {
+	express.mu.Lock()
+	var user, store = express.user, express.store
+	express.mu.Unlock()
+
+	if store == nil {
+		return
+	}
+
+	if err := express.persist(ctx, "UpdateExpression", func() error { return store.UpdateExpression(NewRow(ID, user, ex)) }); err != nil {
+		express.logger(ID).Error("Failed to save the state of the expression", "error", err)
+	}
+}
+
+// Restore добавляет в коллекцию выражение, загруженное из хранилища, не вычисляя его.
+// Незавершённые выражения вычисляются после вызова Resume.
+func (express *Expressions) Restore(ID string, ex *rest.Expression) {
+	express.mu.Lock()
+	express.IDs[ID] = ex
+	express.mu.Unlock()
+}
+
+// Resume запускает вычисление всех незавершённых выражений коллекции, каждое в новой трассе.
+func (express *Expressions) Resume() {
+	for ID, ex := range express.GetExpressions() {
+		if status, _, _ := ex.State(); status != rest.StatusDone && status != rest.StatusFailed {
+			var ctx, span = express.trace(context.Background(), ID, ex)
+			span.SetAttributes("resumed", true)
+			express.scheduler.Submitted()
+			go express.schedule(ctx, span, ID, ex)
+		}
+	}
+}
+
+// Delete удаляет выражения по их ID.
+func (express *Expressions) Delete(IDs ...string) {
+	defer express.mu.Unlock()
+	express.mu.Lock()
+	for _, key := range IDs {
+		delete(express.IDs, key)
+	}
+}
+
+// Lock блокирует мьютекс для внешнего доступа
+func (express *Expressions) Lock() {
+	express.mu.Lock()
+}
+
+// Unlock разблокирует мьютекс после внешнего доступа
+func (express *Expressions) Unlock() {
+	express.mu.Unlock()
+}
+
 // GetExpression возвращает выражение по ID, если оно существует, или ошибку.
 func (express *Expressions) GetExpression(ID string) (*rest.Expression, error) {
 	express.mu.Lock()
@@ -145,7 +582,7 @@ func (express *Expressions) GetExpression(ID string) (*rest.Expression, error) {
 	express.mu.Unlock()
 
 	if !ok {
-		return nil, rest.NewError("There is no such expression: %d", ID)
+		return nil, rest.NewError("There is no such expression: %s", ID)
 	}
 
 	return expr, nil
@@ -164,28 +601,33 @@ func (express *Expressions) GetExpressions() map[string]*rest.Expression {
 	return expressions
 }
 
-// NewExpression создает новый объект Expression с заданным арифметическим выражением.
-func NewExpression(express string, args ...interface{}) (*rest.Expression, error) {
-	var (
-		date          = time.Now()
-		value         = -1
-		duration, err = calculator.CalculationTime(express)
-	)
+// NewExpression создает новый объект Expression с заданным арифметическим выражением и временем создания.
+// Время вычисления в лучшем случае оценивается по таблице timings. Выражение ещё не вычислено:
+// результат сохранённого выражения задаётся через Finish или Fail.
+func NewExpression(timings *calculator.Timings, express string, bindings map[string]float64, created time.Time) (*rest.Expression, error) {
+	duration, err := timings.CalculationTime(express, bindings)
 	if err != nil {
 		return nil, err
 	}
 
-	if args != nil {
-		date = args[0].(time.Time)
-		value = args[1].(int)
+	tree, err := calculator.ParseWith(express, bindings)
+	if err != nil {
+		return nil, err
+	}
+
+	var ex = &rest.Expression{
+		Value:        -1, // Начальное значение, означает отсутствие результата
+		Express:      express,
+		Created:      created,
+		Expiration:   duration,
+		Bindings:     bindings,
+		Status:       rest.StatusComputing,
+		Dependencies: calculator.References(tree),
 	}
 
-	return &rest.Expression{
-		Value:      value, // Начальное значение, означает отсутствие результата
-		Express:    express,
-		Result:     make(chan int),
-		ErrCh:      make(chan error),
-		Created:    date,
-		Expiration: duration,
-	}, nil
+	if len(ex.Dependencies) != 0 {
+		ex.Status = rest.StatusWaiting
+	}
+
+	return ex, nil
 }
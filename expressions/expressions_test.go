@@ -0,0 +1,238 @@
+package expressions
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/calculator"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/database"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/rest"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	var (
+		store   = database.NewMemory()
+		created = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+	var err = store.AddExpressions(
+		// -1 - результат вычисленного выражения, а не признак его отсутствия
+		&database.ExpressionRow{ID: "a", User: "name", Expression: "0-1", Value: -1, Status: rest.StatusDone, Created: created, Finished: created},
+		&database.ExpressionRow{ID: "b", User: "name", Expression: "1/0", Value: -1, Status: rest.StatusFailed, Error: "Division by zero", Created: created, Finished: created},
+		&database.ExpressionRow{ID: "c", User: "name", Expression: "$a*2", Value: -1, Status: rest.StatusWaiting, Created: created},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var scheduler = calculator.NewScheduler(calculator.NewTimings(), 0)
+	var clock = calculator.NewFakeClock(created)
+	scheduler.SetClock(clock)
+
+	express, err := Load(store, scheduler, "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := express.GetExpression("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, value, err := a.State(); status != rest.StatusDone || value != -1 || err != nil || !a.StartedAt().IsZero() {
+		t.Errorf("a is %s with %v and %v, want done with -1 and not computed again", status, value, err)
+	}
+
+	b, _ := express.GetExpression("b")
+	if status, _, err := b.State(); status != rest.StatusFailed || err == nil || err.Error() != "Division by zero" {
+		t.Errorf("b is %s with %v", status, err)
+	}
+
+	// Незавершённое выражение вычисляется по результату восстановленного
+	c, _ := express.GetExpression("c")
+	clock.BlockUntil(1)
+	clock.AdvanceNext()
+	<-c.Done()
+	if status, value, err := c.State(); status != rest.StatusDone || value != -2 || err != nil {
+		t.Errorf("c is %s with %v and %v, want done with -2", status, value, err)
+	}
+
+	if err = scheduler.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	row, err := store.GetExpression("name", "c")
+	if err != nil || row.Status != rest.StatusDone || row.Value != -2 {
+		t.Errorf("got row %+v, %v", row, err)
+	}
+}
+
+func TestFindCycle(t *testing.T) {
+	var graph = map[string][]string{
+		"a": {"b"},
+		"b": {"c", "d"},
+		"c": {},
+		"d": {"a"},
+		"e": {"e"},
+		"f": {"a"},
+	}
+
+	var tests = []struct {
+		start string
+		cycle []string
+	}{
+		{"a", []string{"a", "b", "d", "a"}},
+		{"d", []string{"d", "a", "b", "d"}},
+		{"e", []string{"e", "e"}},
+		{"c", nil},
+		{"f", nil}, // Ссылается на цикл, но не входит в него
+	}
+
+	for _, test := range tests {
+		if cycle := FindCycle(graph, test.start); !slices.Equal(cycle, test.cycle) {
+			t.Errorf("%s: got %v, want %v", test.start, cycle, test.cycle)
+		}
+	}
+}
+
+func TestAddExpression_Check(t *testing.T) {
+	var express = NewExpressions(calculator.NewScheduler(calculator.NewTimings(), 0))
+	if _, err := express.AddExpression(context.Background(), "a", "2+2", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		ID, expr string
+		kind     error
+		message  string
+	}{
+		{"a", "1+1", ErrDuplicateID, "An expression with ID a is already exists"},
+		{"b", "$missing+1", ErrUnknownReference, "There is no such expression: $missing"},
+		{"c", "$c+1", ErrCircularReference, "Circular reference: $c -> $c"},
+	}
+
+	for _, test := range tests {
+		var _, err = express.AddExpression(context.Background(), test.ID, test.expr, nil)
+		if !errors.Is(err, test.kind) || err.Error() != test.message {
+			t.Errorf("%s = %s: got %v, want %q", test.ID, test.expr, err, test.message)
+		}
+		if _, err = express.GetExpression(test.ID); test.ID != "a" && err == nil {
+			t.Errorf("%s must not be added", test.ID)
+		}
+	}
+}
+
+func TestAddExpression_FailedDependency(t *testing.T) {
+	var scheduler = calculator.NewScheduler(calculator.NewTimings(), 0)
+	var clock = calculator.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	scheduler.SetClock(clock)
+	var express = NewExpressions(scheduler)
+
+	// Ошибка передаётся по цепочке ссылок
+	for _, add := range [][2]string{{"a", "1/0"}, {"b", "$a+1"}, {"c", "$b*2"}} {
+		if _, err := express.AddExpression(context.Background(), add[0], add[1], nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Вычисляется только деление, остальные выражения завершаются ошибкой, не дойдя до вычислителя
+	clock.BlockUntil(1)
+	clock.AdvanceNext()
+
+	for ID, message := range map[string]string{
+		"a": "Division by zero",
+		"b": "Expression $a failed: Division by zero",
+		"c": "Expression $b failed: Expression $a failed: Division by zero",
+	} {
+		var ex, _ = express.GetExpression(ID)
+		<-ex.Done()
+		if status, _, err := ex.State(); status != rest.StatusFailed || err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("%s is %s with %v, want failed with %q", ID, status, err, message)
+		}
+	}
+
+	if err := scheduler.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddExpression_Clock(t *testing.T) {
+	var (
+		scheduler = calculator.NewScheduler(calculator.NewTimings(), 0)
+		now       = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+	scheduler.SetClock(calculator.NewFakeClock(now))
+	var express = NewExpressions(scheduler)
+
+	// Время создания берётся по часам вычислителя, а не по системному времени
+	ex, err := express.AddExpression(context.Background(), "a", "2+2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ex.Created.Equal(now) {
+		t.Errorf("created at %s, want %s", ex.Created, now)
+	}
+
+	ex, err = express.AddExpression(context.Background(), "b", "3", nil, now.Add(-time.Hour), "3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ex.Created.Equal(now.Add(-time.Hour)) || !ex.FinishedAt().Equal(now) {
+		t.Errorf("created at %s and finished at %s", ex.Created, ex.FinishedAt())
+	}
+}
+
+func TestCancel_Waiting(t *testing.T) {
+	var tests = []struct {
+		name    string
+		workers int
+		expr    string
+	}{
+		{"dependency", 0, "$a*2"}, // Ждёт, пока вычисляется a
+		{"worker", 1, "2*2"},      // Ждёт места, которое занимает a
+	}
+
+	for _, test := range tests {
+		var (
+			store     = database.NewMemory()
+			scheduler = calculator.NewScheduler(calculator.NewTimings(), test.workers)
+			clock     = calculator.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			finished  = make(chan string, 2)
+		)
+		scheduler.SetClock(clock)
+		scheduler.Observe(calculator.Observer{Finished: func(status string) { finished <- status }})
+		var express = NewExpressions(scheduler)
+		express.SetStore("name", store)
+
+		if _, err := express.AddExpression(context.Background(), "a", "1+1", nil); err != nil {
+			t.Fatal(err)
+		}
+		clock.BlockUntil(1) // a вычисляется
+
+		if _, err := express.AddExpression(context.Background(), "b", test.expr, nil); err != nil {
+			t.Fatal(err)
+		}
+		for test.workers != 0 && scheduler.Queued() == 0 {
+			time.Sleep(time.Millisecond) // b ждёт места
+		}
+		if _, err := express.Cancel("b"); err != nil {
+			t.Fatal(err)
+		}
+
+		clock.AdvanceNext()
+		for range 2 {
+			<-finished // Вычисление обоих выражений закончено
+		}
+
+		b, _ := express.GetExpression("b")
+		if status, _, err := b.State(); status != rest.StatusFailed || !errors.Is(err, rest.ErrCanceled) || !b.StartedAt().IsZero() {
+			t.Errorf("%s: b is %s with %v, started at %s", test.name, status, err, b.StartedAt())
+		}
+		if row, err := store.GetExpression("name", "b"); err != nil || row.Status != rest.StatusFailed {
+			t.Errorf("%s: got row %+v, %v", test.name, row, err)
+		}
+		if computing := scheduler.Computing(); computing != 0 {
+			t.Errorf("%s: %d workers are still taken", test.name, computing)
+		}
+	}
+}
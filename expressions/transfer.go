@@ -0,0 +1,357 @@
+package expressions
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/calculator"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/database"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/rest"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Форматы экспорта и импорта выражений
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatJSON   = "json"
+)
+
+// csvHeader Заголовок CSV файла с выражениями
+var csvHeader = []string{"id", "expression", "status", "result", "error", "created", "finished", "estimated", "bindings"}
+
+// Record выражение в том виде, в котором оно экспортируется и импортируется.
+type Record struct {
+	ID         string             `json:"id"`
+	Expression string             `json:"expression"`
+	Status     string             `json:"status"`
+	Result     *float64           `json:"result,omitempty"`
+	Error      string             `json:"error,omitempty"`
+	Created    time.Time          `json:"created"`
+	Finished   *time.Time         `json:"finished,omitempty"`
+	Estimated  string             `json:"estimated"`
+	Bindings   map[string]float64 `json:"bindings,omitempty"`
+}
+
+// NewRecord создаёт запись о текущем состоянии выражения.
+func NewRecord(ID string, ex *rest.Expression) Record {
+	var status, value, err = ex.State()
+
+	var record = Record{
+		ID:         ID,
+		Expression: ex.Express,
+		Status:     status,
+		Created:    ex.Created,
+		Estimated:  ex.Expiration.String(),
+		Bindings:   ex.Bindings,
+	}
+
+	if finished := ex.FinishedAt(); !finished.IsZero() {
+		record.Finished = &finished
+	}
+
+	switch {
+	case err != nil:
+		record.Error = err.Error()
+	case status == rest.StatusDone:
+		record.Result = &value
+	}
+
+	return record
+}
+
+// RowRecord создаёт запись о выражении, сохранённом в хранилище.
+func RowRecord(row *database.ExpressionRow) Record {
+	var record = Record{
+		ID:         row.ID,
+		Expression: row.Expression,
+		Status:     row.Status,
+		Error:      row.Error,
+		Created:    row.Created,
+		Estimated:  row.Estimated.String(),
+		Bindings:   row.Bindings,
+	}
+
+	if row.Status == rest.StatusDone {
+		var value = row.Value
+		record.Result = &value
+	}
+	if !row.Finished.IsZero() {
+		var finished = row.Finished
+		record.Finished = &finished
+	}
+
+	return record
+}
+
+// Records возвращает записи всех выражений коллекции в порядке их создания.
+func (express *Expressions) Records() []Record {
+	var records = make([]Record, 0)
+	for ID, ex := range express.GetExpressions() {
+		records = append(records, NewRecord(ID, ex))
+	}
+
+	slices.SortFunc(records, func(a, b Record) int {
+		if c := a.Created.Compare(b.Created); c != 0 {
+			return c
+		}
+		if a.ID < b.ID {
+			return -1
+		} else if a.ID > b.ID {
+			return 1
+		}
+		return 0
+	})
+
+	return records
+}
+
+// Build создаёт выражение из записи. Вычисленные и завершившиеся ошибкой выражения
+// сохраняют результат, остальные будут вычислены заново. Выражение очищается от пробелов,
+// как при добавлении. Время вычисления оценивается по timings, а время создания без даты - now.
+func (record *Record) Build(timings *calculator.Timings, now time.Time) (*rest.Expression, error) {
+	var created = record.Created
+	if created.IsZero() {
+		created = now
+	}
+
+	switch record.Status {
+	case rest.StatusDone:
+		if record.Result == nil {
+			return nil, rest.NewError("A computed expression must have a result")
+		}
+	case "", rest.StatusWaiting, rest.StatusComputing, rest.StatusFailed:
+	default:
+		return nil, rest.NewError("Unknown status %s", record.Status)
+	}
+
+	content, err := calculator.PreparingExpression(record.Expression, record.Bindings)
+	if err != nil {
+		return nil, err
+	}
+
+	ex, err := NewExpression(timings, content, record.Bindings, created)
+	if err != nil {
+		return nil, err
+	}
+
+	switch record.Status {
+	case rest.StatusDone:
+		ex.Finish(*record.Result)
+
+	case rest.StatusFailed:
+		var message = record.Error
+		if message == "" {
+			message = "Unknown error"
+		}
+		ex.Fail(errors.New(message))
+
+	default:
+		return ex, nil
+	}
+
+	if record.Finished != nil {
+		ex.Finished = *record.Finished
+	}
+
+	return ex, nil
+}
+
+// WriteRecords записывает записи в заданном формате.
+func WriteRecords(w io.Writer, format string, records []Record) error {
+	switch format {
+	case FormatCSV:
+		var writer = csv.NewWriter(w)
+		if err := writer.Write(csvHeader); err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			var result, finished, bindings string
+			if record.Result != nil {
+				result = rest.FormatValue(*record.Result)
+			}
+			if record.Finished != nil {
+				finished = record.Finished.Format(time.RFC3339Nano)
+			}
+			if len(record.Bindings) != 0 {
+				var encoded, err = json.Marshal(record.Bindings)
+				if err != nil {
+					return err
+				}
+				bindings = string(encoded)
+			}
+
+			var err = writer.Write([]string{record.ID, record.Expression, record.Status, result, record.Error,
+				record.Created.Format(time.RFC3339Nano), finished, record.Estimated, bindings})
+			if err != nil {
+				return err
+			}
+		}
+
+		writer.Flush()
+		return writer.Error()
+
+	case FormatNDJSON:
+		var encoder = json.NewEncoder(w)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	case FormatJSON:
+		return json.NewEncoder(w).Encode(records)
+
+	default:
+		return rest.NewError("Unknown format %s", format)
+	}
+}
+
+// ReadRecords читает записи в заданном формате. Если формат не задан,
+// он определяется по первому символу: "[" - JSON, "{" - NDJSON, иначе CSV.
+func ReadRecords(r io.Reader, format string) ([]Record, error) {
+	var reader = bufio.NewReader(r)
+
+	if format == "" {
+		format = FormatCSV
+		for {
+			var b, err = reader.ReadByte()
+			if errors.Is(err, io.EOF) {
+				return nil, nil
+			} else if err != nil {
+				return nil, err
+			}
+
+			if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+				continue
+			}
+
+			if b == '[' {
+				format = FormatJSON
+			} else if b == '{' {
+				format = FormatNDJSON
+			}
+			if err = reader.UnreadByte(); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	switch format {
+	case FormatCSV:
+		return readCSVRecords(reader)
+
+	case FormatNDJSON:
+		var (
+			records []Record
+			decoder = json.NewDecoder(reader)
+		)
+		for {
+			var record Record
+			if err := decoder.Decode(&record); errors.Is(err, io.EOF) {
+				return records, nil
+			} else if err != nil {
+				return nil, rest.NewError("Record %d: %v", len(records)+1, err)
+			}
+
+			records = append(records, record)
+		}
+
+	case FormatJSON:
+		var records []Record
+		if err := json.NewDecoder(reader).Decode(&records); err != nil {
+			return nil, err
+		}
+
+		return records, nil
+
+	default:
+		return nil, rest.NewError("Unknown format %s", format)
+	}
+}
+
+// readCSVRecords читает CSV файл, столбцы которого определяются заголовком.
+// Обязательны только столбцы id и expression.
+func readCSVRecords(r io.Reader) ([]Record, error) {
+	var reader = csv.NewReader(r)
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var columns = make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range []string{"id", "expression"} {
+		if _, ok := columns[name]; !ok {
+			return nil, rest.NewError("Column %s is missing", name)
+		}
+	}
+
+	var records []Record
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		var field = func(name string) string {
+			if i, ok := columns[name]; ok && i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+
+		var record = Record{
+			ID:         field("id"),
+			Expression: field("expression"),
+			Status:     field("status"),
+			Error:      field("error"),
+			Estimated:  field("estimated"),
+		}
+
+		if value := field("result"); value != "" {
+			result, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, rest.NewError("Line %d: invalid result %s", line, value)
+			}
+			record.Result = &result
+		}
+
+		if value := field("created"); value != "" {
+			if record.Created, err = time.Parse(time.RFC3339Nano, value); err != nil {
+				return nil, rest.NewError("Line %d: invalid creation date %s", line, value)
+			}
+		}
+
+		if value := field("finished"); value != "" {
+			finished, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return nil, rest.NewError("Line %d: invalid finishing date %s", line, value)
+			}
+			record.Finished = &finished
+		}
+
+		if value := field("bindings"); value != "" {
+			if err = json.Unmarshal([]byte(value), &record.Bindings); err != nil {
+				return nil, rest.NewError("Line %d: invalid bindings %s", line, value)
+			}
+		}
+
+		records = append(records, record)
+	}
+}
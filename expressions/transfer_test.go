@@ -0,0 +1,93 @@
+package expressions
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/calculator"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/rest"
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRecordBuild(t *testing.T) {
+	var (
+		timings  = calculator.NewTimings()
+		minusOne = -1.0
+		finished = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	)
+
+	var tests = []struct {
+		record  Record
+		express string
+		status  string
+		value   float64
+		err     string
+	}{
+		// -1 - обычный результат, а не признак его отсутствия
+		{Record{Expression: "0 - 1", Status: rest.StatusDone, Result: &minusOne, Finished: &finished}, "0-1", rest.StatusDone, -1, ""},
+		{Record{Expression: " 2 +  2 ", Status: rest.StatusWaiting}, "2+2", rest.StatusComputing, -1, ""},
+		{Record{Expression: "2 * $a"}, "2*$a", rest.StatusWaiting, -1, ""},
+		{Record{Expression: "1 / 0", Status: rest.StatusFailed, Error: "Division by zero", Finished: &finished}, "1/0", rest.StatusFailed, -1, "Division by zero"},
+		{Record{Expression: "1/0", Status: rest.StatusFailed}, "1/0", rest.StatusFailed, -1, "Unknown error"},
+	}
+
+	for _, test := range tests {
+		var ex, err = test.record.Build(timings, finished)
+		if err != nil {
+			t.Fatalf("%s: %v", test.record.Expression, err)
+		}
+
+		var status, value, exErr = ex.State()
+		if ex.Express != test.express || status != test.status || value != test.value {
+			t.Errorf("%q: got %q %s %v, want %q %s %v", test.record.Expression, ex.Express, status, value, test.express, test.status, test.value)
+		}
+		if exErr != nil && exErr.Error() != test.err || exErr == nil && test.err != "" {
+			t.Errorf("%q: got error %v, want %q", test.record.Expression, exErr, test.err)
+		}
+		if test.record.Created.IsZero() && !ex.Created.Equal(finished) {
+			t.Errorf("%q: created at %s, want %s", test.record.Expression, ex.Created, finished)
+		}
+		if test.record.Finished != nil && !ex.FinishedAt().Equal(finished) {
+			t.Errorf("%q: finished at %s, want %s", test.record.Expression, ex.FinishedAt(), finished)
+		}
+	}
+
+	for _, record := range []Record{
+		{Expression: "2+2", Status: rest.StatusDone},
+		{Expression: "2+2", Status: "lost"},
+		{Expression: "2+", Status: rest.StatusWaiting},
+		{Expression: "2*x"},
+	} {
+		if _, err := record.Build(timings, finished); err == nil {
+			t.Errorf("%+v must be rejected", record)
+		}
+	}
+}
+
+func TestRecordsRoundTrip(t *testing.T) {
+	var (
+		result  = -1.0
+		created = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		records = []Record{
+			{ID: "a", Expression: "0-1", Status: rest.StatusDone, Result: &result, Created: created, Estimated: "750ms"},
+			{ID: "b", Expression: "x*$a", Status: rest.StatusWaiting, Created: created, Estimated: "1s", Bindings: map[string]float64{"x": 2}},
+		}
+	)
+
+	for _, format := range []string{FormatCSV, FormatNDJSON, FormatJSON} {
+		var buffer bytes.Buffer
+		if err := WriteRecords(&buffer, format, records); err != nil {
+			t.Fatal(err)
+		}
+
+		// Формат определяется по содержимому
+		var read, err = ReadRecords(&buffer, "")
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		if len(read) != 2 || read[0].Result == nil || *read[0].Result != -1 || read[1].Result != nil ||
+			read[1].Bindings["x"] != 2 || !read[0].Created.Equal(created) {
+			t.Errorf("%s: got %+v", format, read)
+		}
+	}
+}
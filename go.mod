@@ -3,6 +3,8 @@ module Distributed-arithmetic-expression-evaluator-version-2.0
 go 1.22.2
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/golang-jwt/jwt/v5 v5.2.1
 	github.com/mattn/go-sqlite3 v1.14.22
+	gopkg.in/yaml.v3 v3.0.1
 )
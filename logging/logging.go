@@ -0,0 +1,134 @@
+// Package logging configures the structured logger of the server. Loggers created by New
+// hide passwords, tokens and secrets, and add the request ID carried by the context.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Formats of the log records
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Redacted replaces the values of sensitive attributes
+const Redacted = "[REDACTED]"
+
+// RequestIDKey is the attribute holding the ID of the request a record was written for
+const RequestIDKey = "request_id"
+
+// sensitiveKeys are parts of the attribute names that hold secrets
+var sensitiveKeys = []string{"password", "token", "secret", "authorization", "cookie"}
+
+// jwtPattern finds tokens embedded in messages and other values
+var jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+
+// Sensitive reports whether the attribute with the name holds a secret
+func Sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redact is the ReplaceAttr of the handlers
+func redact(_ []string, attr slog.Attr) slog.Attr {
+	if Sensitive(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+
+	if attr.Value.Kind() == slog.KindString {
+		if value := attr.Value.String(); jwtPattern.MatchString(value) {
+			return slog.String(attr.Key, jwtPattern.ReplaceAllString(value, Redacted))
+		}
+	}
+
+	return attr
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(level string) (slog.Level, error) {
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q, want debug, info, warn or error", level)
+	}
+
+	return parsed, nil
+}
+
+// New returns a logger writing records of the level and above in the format to w
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var parsed, err = ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		options = &slog.HandlerOptions{Level: parsed, ReplaceAttr: redact}
+		handler slog.Handler
+	)
+	switch format {
+	case FormatText:
+		handler = slog.NewTextHandler(w, options)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		return nil, fmt.Errorf("unknown log format %q, want %s or %s", format, FormatText, FormatJSON)
+	}
+
+	return slog.New(contextHandler{handler}), nil
+}
+
+// contextHandler adds the request ID of the context to the records
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ID := RequestID(ctx); ID != "" {
+		record.AddAttrs(slog.String(RequestIDKey, ID))
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of the context carrying the request ID
+func WithRequestID(ctx context.Context, ID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, ID)
+}
+
+// RequestID returns the request ID of the context or "" if there is none
+func RequestID(ctx context.Context) string {
+	var ID, _ = ctx.Value(requestIDKey{}).(string)
+	return ID
+}
+
+// NewRequestID returns a random ID of 16 hexadecimal digits
+func NewRequestID() string {
+	var buf [8]byte
+	_, _ = rand.Read(buf[:])
+
+	return hex.EncodeToString(buf[:])
+}
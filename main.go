@@ -1,9 +1,46 @@
 package main
 
 import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/config"
 	"Distributed-arithmetic-expression-evaluator-version-2.0/server"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
 )
 
 func main() {
-	server.StartHandler("8080")
+	var command string
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	var err error
+	switch command {
+	case "migrate":
+		err = migrate(os.Args[2:])
+	case "config":
+		err = configCommand(os.Args[2:])
+	default:
+		err = serve(os.Args[1:])
+	}
+
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// serve starts the server with the configuration of the flags, the environment and the config file
+func serve(args []string) error {
+	cfg, rest, err := config.Load("server", args)
+	if err != nil {
+		return err
+	}
+
+	if len(rest) != 0 {
+		return errors.New("unknown command " + rest[0])
+	}
+
+	return server.StartHandler(cfg)
 }
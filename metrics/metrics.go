@@ -0,0 +1,298 @@
+// Package metrics collects counters, gauges and histograms and writes them
+// in the Prometheus text exposition format
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds in seconds of the histograms of latencies
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// collector is a metric family of the registry
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds the metrics exposed together. It is safe for concurrent use.
+type Registry struct {
+	mu         sync.Mutex
+	names      map[string]bool
+	collectors []collector
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+// register adds the family. Names must be unique.
+func (registry *Registry) register(name string, c collector) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if registry.names[name] {
+		panic("metrics: " + name + " is registered twice")
+	}
+	registry.names[name] = true
+	registry.collectors = append(registry.collectors, c)
+}
+
+// WriteText writes every metric in the Prometheus text format
+func (registry *Registry) WriteText(w io.Writer) error {
+	registry.mu.Lock()
+	var collectors = slices.Clone(registry.collectors)
+	registry.mu.Unlock()
+
+	var buffered = bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(buffered)
+	}
+
+	return buffered.Flush()
+}
+
+// ServeHTTP serves the metrics to a Prometheus scraper
+func (registry *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := registry.WriteText(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// family is the name, the help and the label names shared by the series of a metric
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (f *family) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.kind)
+}
+
+// key joins the label values into a map key
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", f.name, len(f.labels), len(values)))
+	}
+
+	return strings.Join(values, "\xff")
+}
+
+// series formats the name with the labels, and the extra label if it is not empty
+func (f *family) series(name, key, extraName, extraValue string) string {
+	var pairs []string
+	if len(f.labels) != 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, f.labels[i]+`="`+escapeValue(value)+`"`)
+		}
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+
+	if len(pairs) == 0 {
+		return name
+	}
+
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Counter is a value that only grows, one per combination of label values
+type Counter struct {
+	family
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter registers a counter with the label names
+func (registry *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	var c = &Counter{family: family{name, help, "counter", labels}, values: map[string]float64{}}
+	registry.register(name, c)
+
+	return c
+}
+
+// Inc adds one to the series of the label values
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds a non-negative delta to the series of the label values
+func (c *Counter) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic("metrics: counter " + c.name + " cannot decrease")
+	}
+
+	var key = c.key(values)
+	c.mu.Lock()
+	c.values[key] += delta
+	c.mu.Unlock()
+}
+
+// Value returns the value of the series of the label values
+func (c *Counter) Value(values ...string) float64 {
+	var key = c.key(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.values[key]
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.header(w)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s %s\n", c.series(c.name, key, "", ""), formatFloat(c.values[key]))
+	}
+}
+
+// GaugeFunc is a value read when the metrics are written
+type GaugeFunc struct {
+	family
+	collect func(set func(value float64, values ...string))
+}
+
+// NewGaugeFunc registers a gauge. Collect is called on every scrape and calls set once per series.
+func (registry *Registry) NewGaugeFunc(name, help string, labels []string, collect func(set func(value float64, values ...string))) *GaugeFunc {
+	var g = &GaugeFunc{family: family{name, help, "gauge", labels}, collect: collect}
+	registry.register(name, g)
+
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	g.header(w)
+
+	var values = map[string]float64{}
+	g.collect(func(value float64, labels ...string) {
+		values[g.key(labels)] = value
+	})
+
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s %s\n", g.series(g.name, key, "", ""), formatFloat(values[key]))
+	}
+}
+
+// Histogram counts observations in buckets, one per combination of label values
+type Histogram struct {
+	family
+	buckets []float64
+	mu      sync.Mutex
+	data    map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // Observations per bucket, not cumulative, the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram registers a histogram with the upper bounds of the buckets, DefaultBuckets if nil
+func (registry *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+
+	var h = &Histogram{family: family{name, help, "histogram", labels}, buckets: buckets, data: map[string]*histogramSeries{}}
+	registry.register(name, h)
+
+	return h
+}
+
+// Observe records the value in the series of the label values
+func (h *Histogram) Observe(value float64, values ...string) {
+	var key = h.key(values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var s, ok = h.data[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets)+1)}
+		h.data[key] = s
+	}
+
+	var index, _ = slices.BinarySearch(h.buckets, value)
+	s.counts[index]++
+	s.sum += value
+	s.count++
+}
+
+// Count returns the number of observations of the series of the label values
+func (h *Histogram) Count(values ...string) uint64 {
+	var key = h.key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if s, ok := h.data[key]; ok {
+		return s.count
+	}
+
+	return 0
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.header(w)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, key := range sortedKeys(h.data) {
+		var (
+			s          = h.data[key]
+			cumulative uint64
+		)
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s %d\n", h.series(h.name+"_bucket", key, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s %d\n", h.series(h.name+"_bucket", key, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s %s\n", h.series(h.name+"_sum", key, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s %d\n", h.series(h.name+"_count", key, "", ""), s.count)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	var keys = make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	return keys
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string   { return helpEscaper.Replace(help) }
+func escapeValue(value string) string { return valueEscaper.Replace(value) }
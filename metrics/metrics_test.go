@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	var (
+		registry  = NewRegistry()
+		requests  = registry.NewCounter("requests_total", "Requests.", "route", "status")
+		duration  = registry.NewHistogram("duration_seconds", "Duration\nof requests.", []float64{1, 0.5}, "route")
+		connected = 3
+	)
+	registry.NewGaugeFunc("connected", "Connected clients.", nil, func(set func(float64, ...string)) {
+		set(float64(connected))
+	})
+
+	requests.Inc("/b", "200")
+	requests.Add(2, "/a", "500")
+	requests.Inc(`/"quoted"`, "200")
+	duration.Observe(0.25, "/a")
+	duration.Observe(0.5, "/a")
+	duration.Observe(2, "/a")
+
+	var text strings.Builder
+	if err := registry.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+
+	var want = `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{route="/\"quoted\"",status="200"} 1
+requests_total{route="/a",status="500"} 2
+requests_total{route="/b",status="200"} 1
+# HELP duration_seconds Duration\nof requests.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="/a",le="0.5"} 2
+duration_seconds_bucket{route="/a",le="1"} 2
+duration_seconds_bucket{route="/a",le="+Inf"} 3
+duration_seconds_sum{route="/a"} 2.75
+duration_seconds_count{route="/a"} 3
+# HELP connected Connected clients.
+# TYPE connected gauge
+connected 3
+`
+	if text.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", text.String(), want)
+	}
+
+	if got := requests.Value("/a", "500"); got != 2 {
+		t.Errorf("got counter %v, want 2", got)
+	}
+	if got := duration.Count("/a"); got != 3 {
+		t.Errorf("got %d observations, want 3", got)
+	}
+}
+
+func TestRegistry_Panics(t *testing.T) {
+	var registry = NewRegistry()
+	var counter = registry.NewCounter("total", "Total.", "label")
+
+	for name, call := range map[string]func(){
+		"duplicate":       func() { registry.NewCounter("total", "Again.") },
+		"labels":          func() { counter.Inc() },
+		"negative amount": func() { counter.Add(-1, "value") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("did not panic")
+				}
+			}()
+			call()
+		})
+	}
+}
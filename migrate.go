@@ -0,0 +1,110 @@
+package main
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/config"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/database"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// migrate runs the "migrate" subcommand:
+//
+//	migrate [-db path] [up | down | to <version> | status]
+//
+// up applies all pending migrations, down reverts the last one.
+// The database is the one of the configuration, see config.Load.
+func migrate(args []string) error {
+	var flags = config.NewFlagSet("migrate")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: migrate [-db path] [up | down | to <version> | status]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := flags.Load(os.LookupEnv)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.OpenDB(cfg.Database.Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	var command = "up"
+	if flags.NArg() > 0 {
+		command = flags.Arg(0)
+	}
+
+	switch command {
+	case "up":
+		err = db.MigrateUp()
+	case "down":
+		if current == 0 {
+			return errors.New("the database has no migrations to revert")
+		}
+		err = db.Migrate(current - 1)
+	case "to":
+		var target int
+		if target, err = strconv.Atoi(flags.Arg(1)); err != nil {
+			return fmt.Errorf("invalid version %q", flags.Arg(1))
+		}
+		err = db.Migrate(target)
+	case "status":
+		return printMigrations(db)
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown migrate command %s", command)
+	}
+	if err != nil {
+		return err
+	}
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Schema version %d -> %d\n", current, version)
+	return nil
+}
+
+// printMigrations lists the embedded migrations and when they were applied
+func printMigrations(db *database.DB) error {
+	migrations, err := database.Migrations()
+	if err != nil {
+		return err
+	}
+
+	applied, err := db.AppliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	var dates = make(map[int]string, len(applied))
+	for _, migration := range applied {
+		dates[migration.Version] = migration.Applied.Format("2006-01-02 15:04:05")
+	}
+
+	for _, migration := range migrations {
+		var date, ok = dates[migration.Version]
+		if !ok {
+			date = "pending"
+		}
+
+		fmt.Printf("%04d %-24s %s\n", migration.Version, migration.Name, date)
+	}
+
+	return nil
+}
@@ -1,42 +1,219 @@
 package rest
 
 import (
+	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"sync"
 	"time"
 )
 
 // Пришлось поместить сюда, чтобы не происходил cycle, так как пакету calculator нужен данный класс
 
+// Состояния выражения
+const (
+	StatusWaiting   = "waiting"   // Ожидает результаты выражений, на которые ссылается
+	StatusComputing = "computing" // Вычисляется
+	StatusDone      = "done"      // Вычислено
+	StatusFailed    = "failed"    // Завершилось ошибкой
+)
+
+// ErrCanceled ошибка выражения, вычисление которого отменено
+var ErrCanceled = errors.New("Canceled")
+
 // Expression представляет выражение с его свойствами.
 type Expression struct {
-	Value      int           // Используется для хранения результата выражения
-	Express    string        // Строковое представление выражения, например "2+2"
-	Result     chan int      // Канал для получения результата вычисления выражения
-	ErrCh      chan error    // Канал для передачи ошибок при вычислении
-	Created    time.Time     // Время создания экземпляра выражения
-	Expiration time.Duration // Продолжительность жизни выражения
+	Value        float64            // Используется для хранения результата выражения
+	Express      string             // Строковое представление выражения, например "2+2"
+	Created      time.Time          // Время создания экземпляра выражения
+	Expiration   time.Duration      // Оценка времени вычисления в лучшем случае
+	Bindings     map[string]float64 // Значения переменных, использованных в выражении
+	Status       string             // Состояние выражения
+	Err          error              // Ошибка вычисления, если оно завершилось неудачей
+	Dependencies []string           // ID выражений, на результаты которых ссылается выражение
+	References   map[string]float64 // Результаты выражений, на которые ссылается выражение
+	Finished     time.Time          // Время завершения вычисления
+	Started      time.Time          // Время начала вычисления
+
+	mu         sync.Mutex
+	clock      func() time.Time  // Источник времени начала и завершения, time.Now, если nil
+	trace      string            // ID трассы последнего вычисления
+	operations []OperationRecord // Выполненные операции последнего вычисления
+	done       chan struct{}     // Закрывается по завершении вычисления
+}
+
+// OperationRecord Операция, выполненная при вычислении выражения
+type OperationRecord struct {
+	Operator string    // Символ операции или имя функции
+	Operands []float64 // Значения операндов или аргументов
+	Result   float64   // Результат, если операция не завершилась ошибкой
+	Err      error     // Ошибка операции
+	Worker   int       // Номер вычислителя выражения, одновременные операции выполняются разными
+	Start    time.Time // Начало выполнения
+	End      time.Time // Конец выполнения
+}
+
+// Done возвращает канал, который закрывается, когда выражение вычислено или завершилось ошибкой.
+func (express *Expression) Done() <-chan struct{} {
+	express.mu.Lock()
+	defer express.mu.Unlock()
+
+	if express.done == nil {
+		express.done = make(chan struct{})
+	}
+
+	return express.done
+}
+
+// Start отмечает начало вычисления с результатами выражений, на которые оно ссылается.
+// Завершённое, например отменённое, выражение не меняется, и Start возвращает false.
+func (express *Expression) Start(references map[string]float64) bool {
+	express.mu.Lock()
+	defer express.mu.Unlock()
+
+	if express.done == nil {
+		express.done = make(chan struct{})
+	}
+	select {
+	case <-express.done:
+		return false
+	default:
+	}
+
+	express.Status = StatusComputing
+	express.References = references
+	express.Started = express.now()
+	express.operations = nil
+
+	return true
+}
+
+// SetClock задаёт источник времени начала и завершения вычисления, nil возвращает time.Now.
+func (express *Expression) SetClock(now func() time.Time) {
+	express.mu.Lock()
+	defer express.mu.Unlock()
+
+	express.clock = now
+}
+
+// now возвращает текущее время по источнику выражения. Вызывается под mu.
+func (express *Expression) now() time.Time {
+	if express.clock == nil {
+		return time.Now()
+	}
+
+	return express.clock()
+}
+
+// StartedAt возвращает время начала вычисления или нулевое время, если оно не начато.
+func (express *Expression) StartedAt() time.Time {
+	express.mu.Lock()
+	defer express.mu.Unlock()
+
+	return express.Started
+}
+
+// Record добавляет выполненную операцию в хронологию вычисления.
+func (express *Expression) Record(operation OperationRecord) {
+	express.mu.Lock()
+	defer express.mu.Unlock()
+
+	express.operations = append(express.operations, operation)
+}
+
+// Operations возвращает копию выполненных операций в порядке их завершения.
+func (express *Expression) Operations() []OperationRecord {
+	express.mu.Lock()
+	defer express.mu.Unlock()
+
+	return slices.Clone(express.operations)
+}
+
+// Finish сохраняет результат вычисления.
+func (express *Expression) Finish(value float64) {
+	express.complete(StatusDone, value, nil)
+}
+
+// Fail сохраняет ошибку вычисления.
+func (express *Expression) Fail(err error) {
+	express.complete(StatusFailed, -1, err)
 }
 
-// Close метод закрывает каналы ErrCh и Result для освобождения ресурсов.
-func (express *Expression) Close() {
-	close(express.ErrCh)
-	close(express.Result)
+// Cancel завершает выражение ошибкой ErrCanceled. Возвращает false, если выражение уже завершено.
+// Результат вычисления, которое продолжается после отмены, отбрасывается.
+func (express *Expression) Cancel() bool {
+	return express.complete(StatusFailed, -1, ErrCanceled)
 }
 
-// GetValue пытается получить значение из канала Result или ошибку из канала ErrCh.
-// Возвращает 0 и ошибку, если есть ошибка, или результат, если нет ошибки.
-// Если нет доступных значений в каналах, возвращает -1, что означает отсутствие данных.
-func (express *Expression) GetValue() (int, error) {
+// complete завершает выражение, если оно ещё не завершено, и сообщает, было ли оно завершено сейчас.
+func (express *Expression) complete(status string, value float64, err error) bool {
+	express.mu.Lock()
+	defer express.mu.Unlock()
+
+	if express.done == nil {
+		express.done = make(chan struct{})
+	}
+
 	select {
-	case err := <-express.ErrCh: // Чтение из канала ошибок
+	case <-express.done:
+		return false // Выражение уже завершено
+	default:
+	}
+
+	express.Status = status
+	express.Value = value
+	express.Err = err
+	express.Finished = express.now()
+	close(express.done)
+
+	return true
+}
+
+// FinishedAt возвращает время завершения вычисления или нулевое время, если оно не завершено.
+func (express *Expression) FinishedAt() time.Time {
+	express.mu.Lock()
+	defer express.mu.Unlock()
+
+	return express.Finished
+}
+
+// SetTrace запоминает ID трассы, в которую записывается вычисление выражения.
+func (express *Expression) SetTrace(traceID string) {
+	express.mu.Lock()
+	defer express.mu.Unlock()
+
+	express.trace = traceID
+}
+
+// Trace возвращает ID трассы последнего вычисления или "", если оно не трассировалось.
+func (express *Expression) Trace() string {
+	express.mu.Lock()
+	defer express.mu.Unlock()
+
+	return express.trace
+}
+
+// State возвращает состояние, результат и ошибку выражения.
+func (express *Expression) State() (string, float64, error) {
+	express.mu.Lock()
+	defer express.mu.Unlock()
+
+	return express.Status, express.Value, express.Err
+}
+
+// GetValue возвращает 0 и ошибку, если вычисление завершилось ошибкой, или результат.
+// Если выражение ещё не вычислено, возвращает -1, что означает отсутствие данных.
+func (express *Expression) GetValue() (float64, error) {
+	var status, value, err = express.State()
+
+	switch status {
+	case StatusFailed:
 		return 0, err
-	case answer := <-express.Result: // Чтение результата вычисления
-		if express.Value == -1 {
-			express.Value = answer // Сохранение результата в свойство Value, если оно было инициализировано как -1
-		}
-		return answer, nil
+	case StatusDone:
+		return value, nil
 	default:
-		return -1, nil // Возврат -1, если ни одно значение не готово для чтения
+		return -1, nil
 	}
 }
 
@@ -45,6 +222,11 @@ func Last[E any](s []E) E {
 	return s[len(s)-1]
 }
 
+// FormatValue форматирует результат выражения без лишних нулей и экспоненты.
+func FormatValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
 // NewError создает новый экземпляр ошибки с форматированным сообщением.
 func NewError(format string, values ...interface{}) error {
 	return fmt.Errorf(format, values...)
@@ -0,0 +1,357 @@
+// Package sdk is a client of the HTTP API of the evaluator
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPollInterval is how often Wait asks for the state of an expression
+const DefaultPollInterval = 250 * time.Millisecond
+
+// ErrNotLoggedIn is returned by the calls that need a token before Login or SetToken
+var ErrNotLoggedIn = errors.New("not logged in")
+
+// Client calls the API as one user and is safe for concurrent use.
+// After Login or SetCredentials the token is renewed before it expires and when the server refuses it.
+type Client struct {
+	BaseURL       string // For example http://localhost:8080
+	HTTPClient    *http.Client
+	PollInterval  time.Duration // DefaultPollInterval if zero
+	RefreshBefore time.Duration // How long before the expiry the token is renewed, DefaultRefreshBefore if zero
+	DisableEvents bool          // Wait only polls instead of reading the event stream
+
+	mu       sync.Mutex
+	username string
+	password string // Kept to renew the token, empty if the token was given by SetToken
+	token    string
+}
+
+// New returns a client of the server at the base URL
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), HTTPClient: http.DefaultClient}
+}
+
+// request is a call of the API
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	body        interface{} // Sent as JSON if not nil
+	accept      string      // application/json if empty
+	auth        bool        // Whether the token is sent
+	tokenInBody bool        // The username and the token are added to the body, which must be a map[string]string
+}
+
+// do sends the request and decodes the JSON response into out, if it is not nil
+func (client *Client) do(ctx context.Context, req request, out interface{}) error {
+	var resp, err = client.open(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch out := out.(type) {
+	case nil:
+		return nil
+	case *string:
+		*out = string(content)
+		return nil
+	default:
+		return json.Unmarshal(content, out)
+	}
+}
+
+// open sends the request and returns the successful response.
+// If the server refuses the token, it is renewed and the request is sent again once.
+func (client *Client) open(ctx context.Context, req request) (*http.Response, error) {
+	var resp, token, err = client.send(ctx, req, "")
+	if err != nil && req.auth && errors.Is(err, ErrUnauthorized) && client.canRefresh() {
+		resp, _, err = client.send(ctx, req, token)
+	}
+
+	return resp, err
+}
+
+// send makes one attempt of the request, renewing the token if it is the stale one.
+// It returns the token that was sent.
+func (client *Client) send(ctx context.Context, req request, stale string) (*http.Response, string, error) {
+	var username, token string
+	if req.auth {
+		var err error
+		if username, token, err = client.authorize(ctx, stale); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var body io.Reader
+	if req.body != nil {
+		var value = req.body
+		if req.tokenInBody {
+			var fields = maps.Clone(req.body.(map[string]string))
+			if fields == nil {
+				fields = map[string]string{}
+			}
+			fields["username"], fields["token"] = username, token
+			value = fields
+		}
+
+		var encoded, err = json.Marshal(value)
+		if err != nil {
+			return nil, token, err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	var address = client.BaseURL + req.path
+	if len(req.query) != 0 {
+		address += "?" + req.query.Encode()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, address, body)
+	if err != nil {
+		return nil, token, err
+	}
+
+	if req.accept == "" {
+		req.accept = "application/json"
+	}
+	httpReq.Header.Set("Accept", req.accept)
+	if req.body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if req.auth && !req.tokenInBody {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	var httpClient = client.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, token, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+
+		var content, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, token, err
+		}
+
+		return nil, token, newError(resp.StatusCode, content)
+	}
+
+	return resp, token, nil
+}
+
+// credentials is the body of /register and /login
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Register creates a user
+func (client *Client) Register(ctx context.Context, username, password string) error {
+	return client.do(ctx, request{method: http.MethodPost, path: "/register", body: credentials{username, password}}, nil)
+}
+
+// Login gets a token of the user, which is used by the following calls and renewed when needed
+func (client *Client) Login(ctx context.Context, username, password string) (string, error) {
+	var token, err = client.login(ctx, username, password)
+	if err != nil {
+		return "", err
+	}
+
+	client.mu.Lock()
+	client.username, client.password, client.token = username, password, token
+	client.mu.Unlock()
+
+	return token, nil
+}
+
+// login gets a token without remembering it
+func (client *Client) login(ctx context.Context, username, password string) (string, error) {
+	var token string
+	var err = client.do(ctx, request{method: http.MethodGet, path: "/login", body: credentials{username, password}}, &token)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(token), nil
+}
+
+// Submit adds an expression. A rejected expression is reported as an *Error.
+func (client *Client) Submit(ctx context.Context, item Item) (*Result, error) {
+	var response, err = client.SubmitBatch(ctx, []Item{item})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(response.Results) != 1 {
+		return nil, fmt.Errorf("got %d results for one expression", len(response.Results))
+	}
+
+	var result = response.Results[0]
+	if result.Error != nil {
+		return &result, result.Error
+	}
+
+	return &result, nil
+}
+
+// SubmitBatch adds the expressions that are valid and reports the result of every item
+func (client *Client) SubmitBatch(ctx context.Context, items []Item) (*BatchResponse, error) {
+	var response BatchResponse
+	var err = client.do(ctx, request{method: http.MethodPost, path: "/api/v1/expressions:batch", body: items, auth: true}, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// Get returns the state of an expression
+func (client *Client) Get(ctx context.Context, ID string) (*Expression, error) {
+	var expression Expression
+	var err = client.do(ctx, request{method: http.MethodGet, path: "/expressions/" + url.PathEscape(ID), auth: true}, &expression)
+	if err != nil {
+		return nil, err
+	}
+
+	return &expression, nil
+}
+
+// List returns a page of the user's expressions
+func (client *Client) List(ctx context.Context, options ListOptions) (*Page, error) {
+	var query = url.Values{}
+	if len(options.Statuses) != 0 {
+		query.Set("status", strings.Join(options.Statuses, ","))
+	}
+	if !options.CreatedAfter.IsZero() {
+		query.Set("created_after", options.CreatedAfter.Format(time.RFC3339))
+	}
+	if !options.CreatedBefore.IsZero() {
+		query.Set("created_before", options.CreatedBefore.Format(time.RFC3339))
+	}
+	if options.Contains != "" {
+		query.Set("q", options.Contains)
+	}
+	if options.Sort != "" {
+		query.Set("sort", options.Sort)
+	}
+	if options.Descending {
+		query.Set("order", "desc")
+	}
+	if options.Limit > 0 {
+		query.Set("limit", strconv.Itoa(options.Limit))
+	}
+	if options.Cursor != "" {
+		query.Set("cursor", options.Cursor)
+	}
+
+	var page Page
+	var err = client.do(ctx, request{method: http.MethodGet, path: "/api/v1/expressions", query: query, auth: true}, &page)
+	if err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// Wait follows the expression until it is done or failed, or the context is done.
+// It reads the event stream of the expression and polls if the server does not stream events.
+func (client *Client) Wait(ctx context.Context, ID string) (*Expression, error) {
+	if !client.DisableEvents {
+		var expression, err = client.waitEvents(ctx, ID)
+
+		var apiErr *Error
+		switch {
+		case err == nil:
+			return expression, nil
+		case ctx.Err() != nil:
+			return expression, ctx.Err()
+		case errors.As(err, &apiErr) && !isMissingRoute(err):
+			return nil, err
+		}
+	}
+
+	return client.poll(ctx, ID)
+}
+
+// poll asks for the state of the expression until it is done or failed
+func (client *Client) poll(ctx context.Context, ID string) (*Expression, error) {
+	var interval = client.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var expression, err = client.Get(ctx, ID)
+		if err != nil || expression.IsFinished() {
+			return expression, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return expression, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Cancel stops computing an expression that is not finished yet
+func (client *Client) Cancel(ctx context.Context, ID string) (*Expression, error) {
+	var expression Expression
+	var err = client.do(ctx, request{method: http.MethodPost, path: "/api/v1/expressions/" + url.PathEscape(ID) + "/cancel", auth: true}, &expression)
+	if err != nil {
+		return nil, err
+	}
+
+	return &expression, nil
+}
+
+// Timings returns the execution time of every operation keyed by its name
+func (client *Client) Timings(ctx context.Context) (map[string]string, error) {
+	var timings map[string]string
+	var err = client.do(ctx, request{method: http.MethodGet, path: "/math"}, &timings)
+	if err != nil {
+		return nil, err
+	}
+
+	return timings, nil
+}
+
+// SetTimings changes the execution times of the given operations, for example {"addition": "750ms"},
+// and returns the times of all operations
+func (client *Client) SetTimings(ctx context.Context, timings map[string]string) (map[string]string, error) {
+	var table map[string]string
+	var err = client.do(ctx, request{method: http.MethodPatch, path: "/math", body: timings, auth: true, tokenInBody: true}, &table)
+	if err != nil {
+		return nil, err
+	}
+
+	return table, nil
+}
@@ -0,0 +1,366 @@
+package sdk
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/calculator"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/database"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/server"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testServer runs the real handlers with an in-memory store and counts the logins
+type testServer struct {
+	*httptest.Server
+	logins atomic.Int32
+}
+
+// newTestServer starts a server. The wrap function, if not nil, may replace the handler.
+func newTestServer(t *testing.T, options server.Options, wrap func(http.Handler) http.Handler) *testServer {
+	options.Store = database.NewMemory()
+	s, err := server.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		ts      = &testServer{}
+		handler = s.Handler()
+	)
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			ts.logins.Add(1)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+// newTestClient registers a user on the server and returns the client logged in as the user
+func newTestClient(t *testing.T, ts *testServer) *Client {
+	var (
+		client = New(ts.URL)
+		ctx    = context.Background()
+	)
+	client.PollInterval = 10 * time.Millisecond
+
+	if err := client.Register(ctx, "name", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Login(ctx, "name", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func TestClient_Expressions(t *testing.T) {
+	var (
+		ts     = newTestServer(t, server.Options{Timings: calculator.NewUniformTimings(0)}, nil)
+		client = newTestClient(t, ts)
+		ctx    = context.Background()
+	)
+
+	result, err := client.Submit(ctx, Item{ID: "a", Content: "2+x*2", Bindings: map[string]float64{"x": 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ID != "a" {
+		t.Errorf("Submit: ID %q, want a", result.ID)
+	}
+
+	batch, err := client.SubmitBatch(ctx, []Item{{ID: "b", Content: "$a*10"}, {ID: "c", Content: ""}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Accepted != 1 || batch.Rejected != 1 || !errors.Is(batch.Results[1].Error, ErrValidation) {
+		t.Errorf("SubmitBatch: %+v", batch)
+	}
+
+	expression, err := client.Wait(ctx, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expression.Status != StatusDone || expression.Result == nil || *expression.Result != 60 {
+		t.Errorf("Wait: %+v, want done with 60", expression)
+	}
+
+	expression, err = client.Get(ctx, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expression.Dependencies) != 1 || expression.Dependencies[0] != "a" || expression.Finished == nil {
+		t.Errorf("Get: %+v", expression)
+	}
+
+	page, err := client.List(ctx, ListOptions{Statuses: []string{StatusDone}, Sort: "created", Descending: true, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 1 || page.Items[0].ID != "b" || page.NextCursor == "" {
+		t.Fatalf("List: %+v, want b and a cursor", page)
+	}
+
+	page, err = client.List(ctx, ListOptions{Statuses: []string{StatusDone}, Sort: "created", Descending: true, Limit: 1, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 1 || page.Items[0].ID != "a" {
+		t.Errorf("List: second page %+v, want a", page)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	var (
+		ts     = newTestServer(t, server.Options{Timings: calculator.NewUniformTimings(0)}, nil)
+		client = newTestClient(t, ts)
+		ctx    = context.Background()
+	)
+
+	if _, err := client.Submit(ctx, Item{ID: "a", Content: "1+1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Wait(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{"missing expression", func() error {
+			_, err := client.Get(ctx, "missing")
+			return err
+		}, ErrNotFound},
+		{"cancel finished", func() error {
+			_, err := client.Cancel(ctx, "a")
+			return err
+		}, ErrConflict},
+		{"invalid query", func() error {
+			_, err := client.List(ctx, ListOptions{Sort: "name"})
+			return err
+		}, ErrValidation},
+		{"invalid timing", func() error {
+			_, err := client.SetTimings(ctx, map[string]string{"addition": "-1s"})
+			return err
+		}, ErrValidation},
+		{"unknown user", func() error {
+			_, err := New(ts.URL).Login(ctx, "other", "password")
+			return err
+		}, ErrUnauthorized},
+		{"foreign token", func() error {
+			var other = New(ts.URL)
+			other.SetToken("name", "invalid")
+			_, err := other.Get(ctx, "a")
+			return err
+		}, ErrUnauthorized},
+		{"not logged in", func() error {
+			_, err := New(ts.URL).Get(ctx, "a")
+			return err
+		}, ErrNotLoggedIn},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var err = test.call()
+			if !errors.Is(err, test.want) {
+				t.Errorf("got %v, want %v", err, test.want)
+			}
+		})
+	}
+
+	var _, err = client.Get(ctx, "missing")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Code != CodeNotFound {
+		t.Errorf("Get: %#v, want a not_found *Error", err)
+	}
+}
+
+func TestClient_Wait(t *testing.T) {
+	// noEvents hides the event stream like a server without it
+	var noEvents = func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/events") {
+				http.NotFound(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	var tests = []struct {
+		name          string
+		wrap          func(http.Handler) http.Handler
+		disableEvents bool
+	}{
+		{"events", nil, false},
+		{"polling", nil, true},
+		{"fallback", noEvents, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				ts     = newTestServer(t, server.Options{Timings: calculator.NewUniformTimings(30 * time.Millisecond)}, test.wrap)
+				client = newTestClient(t, ts)
+				ctx    = context.Background()
+			)
+			client.DisableEvents = test.disableEvents
+
+			if _, err := client.SubmitBatch(ctx, []Item{{ID: "a", Content: "1+2"}, {ID: "b", Content: "$a*3"}}); err != nil {
+				t.Fatal(err)
+			}
+
+			var expression, err = client.Wait(ctx, "b")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expression.Status != StatusDone || *expression.Result != 9 {
+				t.Errorf("got %+v, want done with 9", expression)
+			}
+
+			if _, err = client.Wait(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("missing expression: got %v, want ErrNotFound", err)
+			}
+
+			if _, err = client.Submit(ctx, Item{ID: "slow", Content: "1+1+1+1+1+1+1+1+1+1"}); err != nil {
+				t.Fatal(err)
+			}
+
+			timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+			defer cancel()
+			if _, err = client.Wait(timeout, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("timeout: got %v, want DeadlineExceeded", err)
+			}
+		})
+	}
+}
+
+func TestClient_Cancel(t *testing.T) {
+	var (
+		ts     = newTestServer(t, server.Options{Timings: calculator.NewUniformTimings(time.Second)}, nil)
+		client = newTestClient(t, ts)
+		ctx    = context.Background()
+	)
+
+	if _, err := client.SubmitBatch(ctx, []Item{{ID: "a", Content: "1+2"}, {ID: "b", Content: "$a*3"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	expression, err := client.Cancel(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expression.Status != StatusFailed || expression.Error != "Canceled" {
+		t.Errorf("Cancel: %+v, want failed with Canceled", expression)
+	}
+
+	expression, err = client.Wait(ctx, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expression.Status != StatusFailed {
+		t.Errorf("dependent: %+v, want failed", expression)
+	}
+}
+
+func TestClient_Timings(t *testing.T) {
+	var (
+		ts     = newTestServer(t, server.Options{Timings: calculator.NewUniformTimings(0)}, nil)
+		client = newTestClient(t, ts)
+		ctx    = context.Background()
+	)
+
+	table, err := client.SetTimings(ctx, map[string]string{"addition": "5ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table["addition"] != "5ms" || table["subtraction"] != "0s" {
+		t.Errorf("SetTimings: %v", table)
+	}
+
+	table, err = client.Timings(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table["addition"] != "5ms" {
+		t.Errorf("Timings: %v", table)
+	}
+}
+
+func TestClient_TokenRefresh(t *testing.T) {
+	var ctx = context.Background()
+
+	t.Run("before expiry", func(t *testing.T) {
+		var (
+			ts     = newTestServer(t, server.Options{Timings: calculator.NewUniformTimings(0), TokenLifetime: time.Hour}, nil)
+			client = newTestClient(t, ts)
+		)
+
+		if _, err := client.List(ctx, ListOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if got := ts.logins.Load(); got != 1 {
+			t.Errorf("fresh token: %d logins, want 1", got)
+		}
+
+		client.RefreshBefore = 2 * time.Hour
+		if _, err := client.List(ctx, ListOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if got := ts.logins.Load(); got != 2 {
+			t.Errorf("expiring token: %d logins, want 2", got)
+		}
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		var (
+			ts     = newTestServer(t, server.Options{Timings: calculator.NewUniformTimings(0), TokenLifetime: time.Second}, nil)
+			client = newTestClient(t, ts)
+		)
+		client.RefreshBefore = time.Nanosecond
+
+		// The expiry is in whole seconds
+		time.Sleep(2 * time.Second)
+
+		if _, err := client.SetTimings(ctx, map[string]string{"addition": "1ms"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.List(ctx, ListOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if got := ts.logins.Load(); got != 2 {
+			t.Errorf("%d logins, want 2", got)
+		}
+	})
+
+	t.Run("credentials", func(t *testing.T) {
+		var (
+			ts     = newTestServer(t, server.Options{Timings: calculator.NewUniformTimings(0)}, nil)
+			client = New(ts.URL)
+		)
+		if err := client.Register(ctx, "name", "password"); err != nil {
+			t.Fatal(err)
+		}
+
+		client.SetCredentials("name", "password")
+		if _, err := client.List(ctx, ListOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if username, token := client.Token(); username != "name" || token == "" {
+			t.Errorf("Token: %q %q", username, token)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package sdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Error codes of the API
+const (
+	CodeInvalidJSON      = "invalid_json"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeInternal         = "internal_error"
+)
+
+// Errors matched by errors.Is against an *Error of the corresponding code
+var (
+	ErrInvalidJSON      = errors.New("invalid JSON")
+	ErrValidation       = errors.New("validation failed")
+	ErrUnauthorized     = errors.New("unauthorized")
+	ErrNotFound         = errors.New("not found")
+	ErrConflict         = errors.New("conflict")
+	ErrMethodNotAllowed = errors.New("method not allowed")
+	ErrInternal         = errors.New("internal server error")
+)
+
+// codeErrors maps the codes to the errors they match
+var codeErrors = map[string]error{
+	CodeInvalidJSON:      ErrInvalidJSON,
+	CodeValidationFailed: ErrValidation,
+	CodeUnauthorized:     ErrUnauthorized,
+	CodeNotFound:         ErrNotFound,
+	CodeConflict:         ErrConflict,
+	CodeMethodNotAllowed: ErrMethodNotAllowed,
+	CodeInternal:         ErrInternal,
+}
+
+// statusCodes gives the code of a plain text error by its status
+var statusCodes = map[int]string{
+	http.StatusBadRequest:       CodeValidationFailed,
+	http.StatusUnauthorized:     CodeUnauthorized,
+	http.StatusNotFound:         CodeNotFound,
+	http.StatusConflict:         CodeConflict,
+	http.StatusMethodNotAllowed: CodeMethodNotAllowed,
+}
+
+// Error is an error response of the API. Use errors.Is with ErrNotFound and others to tell them apart.
+type Error struct {
+	StatusCode int               `json:"-"`
+	Code       string            `json:"code"`
+	Message    string            `json:"message"`
+	Fields     map[string]string `json:"fields,omitempty"` // Problems of the request keyed by the field
+
+	plain bool // The body was not a JSON error, so the code was guessed from the status
+}
+
+func (err *Error) Error() string {
+	var message = err.Message
+	if len(err.Fields) != 0 {
+		var fields = make([]string, 0, len(err.Fields))
+		for name, problem := range err.Fields {
+			fields = append(fields, name+" "+problem)
+		}
+		message += " (" + strings.Join(fields, "; ") + ")"
+	}
+
+	if err.Code == "" {
+		return fmt.Sprintf("%d: %s", err.StatusCode, message)
+	}
+
+	return fmt.Sprintf("%s: %s", err.Code, message)
+}
+
+// Is reports whether the target is the error of the code
+func (err *Error) Is(target error) bool {
+	return err.Code != "" && codeErrors[err.Code] == target
+}
+
+// newError decodes an error response. Some endpoints answer with plain text.
+func newError(statusCode int, content []byte) *Error {
+	var apiErr = &Error{}
+	if err := json.Unmarshal(content, apiErr); err != nil || apiErr.Code == "" {
+		apiErr = &Error{Code: statusCodes[statusCode], Message: strings.TrimSpace(string(content)), plain: true}
+		if statusCode >= http.StatusInternalServerError {
+			apiErr.Code = CodeInternal
+		}
+	}
+
+	apiErr.StatusCode = statusCode
+	return apiErr
+}
+
+// isMissingRoute tells whether the server does not know the endpoint, as older servers do
+func isMissingRoute(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.plain &&
+		(apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusMethodNotAllowed)
+}
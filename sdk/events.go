@@ -0,0 +1,70 @@
+package sdk
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// errStreamEnded tells that the event stream ended before the expression finished
+var errStreamEnded = errors.New("the event stream ended before the expression finished")
+
+// waitEvents reads the "state" events of the expression until it is done or failed
+func (client *Client) waitEvents(ctx context.Context, ID string) (*Expression, error) {
+	var resp, err = client.open(ctx, request{
+		method: http.MethodGet,
+		path:   "/api/v1/expressions/" + url.PathEscape(ID) + "/events",
+		accept: "text/event-stream",
+		auth:   true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/event-stream" {
+		return nil, errStreamEnded
+	}
+
+	var (
+		scanner    = bufio.NewScanner(resp.Body)
+		expression *Expression
+		event      string
+		data       []string
+	)
+	scanner.Buffer(nil, 1<<20) // The details of an expression with a large graph are long
+
+	for scanner.Scan() {
+		var line = scanner.Text()
+		switch {
+		case line == "":
+			if event == "state" && len(data) != 0 {
+				var state Expression
+				if err = json.Unmarshal([]byte(strings.Join(data, "\n")), &state); err != nil {
+					return expression, err
+				}
+
+				expression = &state
+				if expression.IsFinished() {
+					return expression, nil
+				}
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return expression, err
+	}
+
+	return expression, errStreamEnded
+}
@@ -0,0 +1,96 @@
+package sdk
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// DefaultRefreshBefore is how long before the expiry the token is renewed
+const DefaultRefreshBefore = time.Minute
+
+// SetToken makes the client use a token got earlier, for example one saved by a command-line tool.
+// Such a token cannot be renewed, so the calls fail with ErrUnauthorized after it expires.
+func (client *Client) SetToken(username, token string) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.username, client.password, client.token = username, "", token
+}
+
+// SetCredentials makes the client log in by the first call that needs a token and whenever it must be renewed
+func (client *Client) SetCredentials(username, password string) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.username, client.password, client.token = username, password, ""
+}
+
+// Token returns the user and the current token, empty before logging in
+func (client *Client) Token() (string, string) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	return client.username, client.token
+}
+
+// canRefresh tells whether the client can get a new token by itself
+func (client *Client) canRefresh() bool {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	return client.password != ""
+}
+
+// authorize returns the user and the token to send. The token is renewed if there is none yet,
+// if it expires soon or if it is the stale one refused by the server.
+func (client *Client) authorize(ctx context.Context, stale string) (string, string, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	var refreshBefore = client.RefreshBefore
+	if refreshBefore <= 0 {
+		refreshBefore = DefaultRefreshBefore
+	}
+
+	var renew = client.token == "" || (stale != "" && stale == client.token) || expiresWithin(client.token, refreshBefore)
+	if renew && client.password != "" {
+		// Concurrent calls wait here for the new token instead of logging in each
+		var token, err = client.login(ctx, client.username, client.password)
+		if err != nil {
+			return "", "", err
+		}
+		client.token = token
+	}
+
+	if client.token == "" {
+		return "", "", ErrNotLoggedIn
+	}
+
+	return client.username, client.token, nil
+}
+
+// expiresWithin tells whether the token expires within the period.
+// The claims are read without checking the signature, which is the server's job.
+func expiresWithin(token string, period time.Duration) bool {
+	var parts = strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+
+	var payload, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err = json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return false
+	}
+
+	return time.Until(time.Unix(claims.Exp, 0)) < period
+}
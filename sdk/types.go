@@ -0,0 +1,106 @@
+package sdk
+
+import "time"
+
+// Statuses of an expression
+const (
+	StatusWaiting   = "waiting"
+	StatusComputing = "computing"
+	StatusDone      = "done"
+	StatusFailed    = "failed"
+)
+
+// Expression is the state of an expression. Estimated is only filled in by List, while Dependencies,
+// Dependents, BestCase, ETA and Timeline are only filled in by Get, Wait and Cancel.
+type Expression struct {
+	ID           string             `json:"id"`
+	Expression   string             `json:"expression"`
+	Status       string             `json:"status"`
+	Result       *float64           `json:"result,omitempty"`
+	Error        string             `json:"error,omitempty"`
+	Created      time.Time          `json:"created"`
+	Finished     *time.Time         `json:"finished,omitempty"`
+	Estimated    string             `json:"estimated,omitempty"`
+	BestCase     string             `json:"best_case,omitempty"`
+	ETA          string             `json:"eta,omitempty"`
+	Timeline     *Timeline          `json:"timeline,omitempty"`
+	Bindings     map[string]float64 `json:"bindings,omitempty"`
+	Dependencies []string           `json:"dependencies,omitempty"`
+	Dependents   []string           `json:"dependents,omitempty"`
+}
+
+// Timeline is how the last calculation of an expression actually went
+type Timeline struct {
+	Started    time.Time         `json:"started"`
+	Finished   *time.Time        `json:"finished,omitempty"`
+	Actual     string            `json:"actual"`
+	Operations []OperationTiming `json:"operations"`
+}
+
+// OperationTiming is an operation executed by a calculation
+type OperationTiming struct {
+	Operator string    `json:"operator"`
+	Operands []float64 `json:"operands"`
+	Result   *float64  `json:"result,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Worker   int       `json:"worker"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration string    `json:"duration"`
+}
+
+// IsFinished tells whether the expression is done or failed
+func (expression *Expression) IsFinished() bool {
+	return expression.Status == StatusDone || expression.Status == StatusFailed
+}
+
+// EstimatedDuration returns the best case calculation time, 0 if the server did not give one
+func (expression *Expression) EstimatedDuration() time.Duration {
+	var estimated = expression.Estimated
+	if estimated == "" {
+		estimated = expression.BestCase
+	}
+
+	var duration, _ = time.ParseDuration(estimated)
+	return duration
+}
+
+// Item is an expression to submit
+type Item struct {
+	ID       string             `json:"id"`
+	Content  string             `json:"content"`
+	Bindings map[string]float64 `json:"bindings,omitempty"`
+}
+
+// Result tells whether an item of a batch was accepted
+type Result struct {
+	Index  int    `json:"index"`
+	ID     string `json:"id"`
+	Status string `json:"status"` // The status of the accepted expression or "rejected"
+	Error  *Error `json:"error,omitempty"`
+}
+
+// BatchResponse holds the result of every item of a batch in order
+type BatchResponse struct {
+	Accepted int      `json:"accepted"`
+	Rejected int      `json:"rejected"`
+	Results  []Result `json:"results"`
+}
+
+// ListOptions filter and sort the expressions returned by List. Zero fields are not sent.
+type ListOptions struct {
+	Statuses      []string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Contains      string
+	Sort          string // created, finished or estimated
+	Descending    bool
+	Limit         int
+	Cursor        string // NextCursor of the previous page
+}
+
+// Page is a page of the expression listing
+type Page struct {
+	Items      []Expression `json:"items"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
@@ -2,15 +2,17 @@ package server
 
 import (
 	"Distributed-arithmetic-expression-evaluator-version-2.0/client"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/rest"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"strings"
 )
 
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	defer Close(r)
 
 	if r.Method != http.MethodPost {
@@ -18,7 +20,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 
 	var (
 		expr = ClientExpression{}
@@ -35,23 +37,25 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err = client.NewClient(DB, expr.Username, expr.Password); err != nil {
+	webClient, err := client.NewClient(s.store, s.scheduler, expr.Username, expr.Password)
+	if err != nil {
 		http.Error(w, fmt.Sprintf("Error registering user: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.clients.Add(webClient)
+
+	s.logger.InfoContext(r.Context(), "User registered", "user", expr.Username)
 
 	_, err = fmt.Fprintf(w, "The user under the nickname %s was successfully registered", expr.Username)
 	if err != nil {
-		w.WriteHeader(500)
-		return
+		// Статус уже отправлен, поэтому ошибку можно только записать в лог
+		s.logger.ErrorContext(r.Context(), "Failed to write the response", "error", err)
 	}
-	w.WriteHeader(200)
-	return
 }
 
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	defer Close(r)
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	// Проверяем, что используется метод GET
 	if r.Method != http.MethodGet {
 		http.Error(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
@@ -74,14 +78,19 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Получаем объект клиента из базы данных
-	webUser, err := client.GetClient(DB, expr.Username)
+	webUser, err := client.GetClient(s.store, expr.Username)
 	if err != nil {
 		http.Error(w, "Unauthorized: No such user", http.StatusUnauthorized)
 		return
 	}
 
+	if !webUser.CheckPassword(expr.Password) {
+		http.Error(w, "Unauthorized: Wrong password", http.StatusUnauthorized)
+		return
+	}
+
 	// Генерируем токен для пользователя
-	token, err := webUser.GenerateToken()
+	token, err := webUser.GenerateToken(s.tokenLife)
 	if err != nil {
 		http.Error(w, "Internal server error while generating token", http.StatusInternalServerError)
 		return
@@ -92,12 +101,54 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	if _, err = fmt.Fprint(w, token); err != nil {
 		// Если возникает ошибка при отправке токена, логируем её
 		// В этот момент изменить статус ответа уже нельзя, поэтому только логируем ошибку
-		log.Printf("Failed to write token to response: %v", err)
+		s.logger.ErrorContext(r.Context(), "Failed to write the token to the response", "user", expr.Username, "error", err)
+	}
+}
+
+// Authorize проверяет, что токен выдан пользователю.
+// Пользователь ищется среди загруженных клиентов, поэтому запрос к базе данных не выполняется.
+func (s *Server) Authorize(username, token string) error {
+	webUser, ok := s.clients.Get(username)
+	if !ok {
+		return fmt.Errorf("User not found: %s", username)
+	}
+
+	if err := webUser.VerifyToken(token); err != nil {
+		return fmt.Errorf("Invalid token: %w", err)
 	}
+
+	return nil
 }
 
-func AuthorizationMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// usernameKey ключ контекста с именем авторизованного пользователя
+type usernameKey struct{}
+
+// Username возвращает имя пользователя, авторизованного AuthorizationMiddleware
+func Username(r *http.Request) string {
+	var username, _ = r.Context().Value(usernameKey{}).(string)
+	return username
+}
+
+// AuthorizationMiddleware принимает либо заголовок "Authorization: Bearer <token>",
+// либо поля username и token JSON-тела запроса
+func (s *Server) AuthorizationMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			username, err := client.TokenName(token)
+			if err != nil {
+				http.Error(w, "Unauthorized - Invalid token: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			if err = s.Authorize(username, token); err != nil {
+				http.Error(w, "Unauthorized - "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), usernameKey{}, username)))
+			return
+		}
+
 		bodyBytes, err := io.ReadAll(r.Body)
 		if err != nil {
 			http.Error(w, "Cannot read the request body: "+err.Error(), http.StatusBadRequest)
@@ -118,26 +169,19 @@ func AuthorizationMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		webUser, err := client.GetClient(DB, expr.Username)
-		if err != nil {
-			http.Error(w, "Unauthorized - User not found: "+err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		err = webUser.VerifyToken(expr.Token)
-		if err != nil {
-			http.Error(w, "Unauthorized - Invalid token: "+err.Error(), http.StatusUnauthorized)
+		if err = s.Authorize(expr.Username, expr.Token); err != nil {
+			http.Error(w, "Unauthorized - "+err.Error(), http.StatusUnauthorized)
 			return
 		}
 
 		// Re-assign the readable body back to the request
 		r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), usernameKey{}, expr.Username)))
 	})
 }
 
-func ResultHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) ResultHandler(w http.ResponseWriter, r *http.Request) {
 	defer Close(r)
 	if r.Method != http.MethodPost {
 		w.WriteHeader(400)
@@ -152,15 +196,16 @@ func ResultHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, decodeErr, http.StatusInternalServerError)
 		return
 	}
+	expr.Username = Username(r)
 
 	if expr.Username == "" || expr.ID == "" {
 		w.WriteHeader(400)
 		return
 	}
 
-	WebClients.Mu.Lock()
-	var webClient = WebClients.Names[expr.Username]
-	WebClients.Mu.Unlock()
+	s.clients.Mu.Lock()
+	var webClient = s.clients.Names[expr.Username]
+	s.clients.Mu.Unlock()
 	if webClient == nil {
 		w.WriteHeader(400)
 		return
@@ -172,20 +217,18 @@ func ResultHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if result.Value == -1 {
-		result.Value, err = result.GetValue()
-
-		if err != nil {
-			w.WriteHeader(400)
-			return
-		}
+	value, err := result.GetValue()
+	if err != nil {
+		w.WriteHeader(400)
+		return
 	}
 
-	_, err = fmt.Fprintf(w, "Expression - %s = %d\nCreation data: %s\nTime: %s", result.Express, result.Value, result.Created, result.Expiration)
+	_, err = fmt.Fprintf(w, "Expression - %s = %s\nCreation data: %s\nTime: %s", result.Express, rest.FormatValue(value), result.Created, result.Expiration)
+	if err == nil && len(result.Bindings) != 0 {
+		_, err = fmt.Fprintf(w, "\nBindings: %s", FormatBindings(result.Bindings))
+	}
 
 	if err != nil {
-		w.WriteHeader(500)
-		return
+		s.logger.ErrorContext(r.Context(), "Failed to write the response", "error", err)
 	}
-	w.WriteHeader(200)
 }
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/expressions"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/rest"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// MaxBatchSize наибольшее число выражений в одном пакете по умолчанию
+const MaxBatchSize = 1000
+
+// MaxBatchItemBytes средний размер элемента пакета, по которому ограничивается тело запроса:
+// оно может занимать не больше (размер пакета + 1) * MaxBatchItemBytes байт
+const MaxBatchItemBytes = 64 << 10
+
+// BatchItem одно выражение пакета
+type BatchItem struct {
+	ID       string             `json:"id"`
+	Content  string             `json:"content"`
+	Bindings map[string]float64 `json:"bindings,omitempty"`
+}
+
+// BatchResult итог добавления одного элемента пакета. Status - статус добавленного
+// выражения или "rejected".
+type BatchResult struct {
+	Index  int            `json:"index"`
+	ID     string         `json:"id"`
+	Status string         `json:"status"`
+	Error  *ErrorResponse `json:"error,omitempty"`
+}
+
+// BatchResponse тело ответа POST /api/v1/expressions:batch
+type BatchResponse struct {
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Results  []BatchResult `json:"results"`
+}
+
+// statusRejected статус элемента пакета, который не был добавлен
+const statusRejected = "rejected"
+
+// readBatch читает JSON-массив элементов или поток JSON-объектов, разделённых переводом строки.
+// Элементы возвращаются неразобранными, чтобы ошибка в одном отклоняла только его.
+// Элементы читаются по одному, и чтение останавливается, как только их больше max.
+func readBatch(body io.Reader, max int) ([]json.RawMessage, error) {
+	var reader = bufio.NewReader(body)
+
+	var first byte
+	for {
+		var b, err = reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			first = b
+			break
+		}
+	}
+	if err := reader.UnreadByte(); err != nil {
+		return nil, err
+	}
+
+	var (
+		decoder = json.NewDecoder(reader)
+		array   = first == '['
+		items   []json.RawMessage
+	)
+	if array {
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	for !array || decoder.More() {
+		var item json.RawMessage
+		if err := decoder.Decode(&item); !array && errors.Is(err, io.EOF) {
+			return items, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+		if len(items) > max {
+			return items, nil // О размере сообщает вызывающий
+		}
+	}
+
+	// Закрывающая скобка массива
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// batchBody ограничивает тело запроса, добавляющего пакет выражений
+func (s *Server) batchBody(w http.ResponseWriter, r *http.Request) io.Reader {
+	return http.MaxBytesReader(w, r.Body, int64(s.batchSize+1)*MaxBatchItemBytes)
+}
+
+// writeTooLarge отвечает 413, если err - ошибка превышения размера тела, и сообщает, ответил ли
+func writeTooLarge(w http.ResponseWriter, err error) bool {
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		return false
+	}
+
+	WriteError(w, http.StatusRequestEntityTooLarge, codeValidationFailed,
+		fmt.Sprintf("The request body may be at most %d bytes", tooLarge.Limit), nil)
+	return true
+}
+
+// writeBatchSize отвечает, что выражений больше, чем помещается в пакет
+func (s *Server) writeBatchSize(w http.ResponseWriter) {
+	WriteError(w, http.StatusBadRequest, codeValidationFailed,
+		fmt.Sprintf("A batch may hold at most %d expressions", s.batchSize), nil)
+}
+
+// batch собирает итоги элементов пакета и выражения для добавления
+type batch struct {
+	response BatchResponse
+	IDs      []string
+	exprs    []*rest.Expression
+	indexes  []int // Номер элемента каждого корректного выражения
+}
+
+func newBatch(size int) *batch {
+	return &batch{response: BatchResponse{Results: make([]BatchResult, size)}}
+}
+
+// reject записывает ошибку элемента, который не добавляется
+func (b *batch) reject(index int, ID string, err *ErrorResponse) {
+	b.response.Results[index] = BatchResult{Index: index, ID: ID, Status: statusRejected, Error: err}
+}
+
+// add ставит корректное выражение в очередь на добавление
+func (b *batch) add(index int, ID string, expr *rest.Expression) {
+	b.IDs = append(b.IDs, ID)
+	b.exprs = append(b.exprs, expr)
+	b.indexes = append(b.indexes, index)
+}
+
+// commit добавляет выражения из очереди одной транзакцией и дополняет ответ
+func (b *batch) commit(ctx context.Context, exprs *expressions.Expressions) error {
+	errs, err := exprs.AddExpressions(ctx, b.IDs, b.exprs)
+	if err != nil {
+		return err
+	}
+
+	for j, i := range b.indexes {
+		if errs[j] != nil {
+			var code = codeValidationFailed
+			if errors.Is(errs[j], expressions.ErrDuplicateID) {
+				code = codeConflict
+			}
+			b.reject(i, b.IDs[j], &ErrorResponse{Code: code, Message: "Error adding expression: " + errs[j].Error()})
+			continue
+		}
+
+		var status, _, _ = b.exprs[j].State()
+		b.response.Results[i] = BatchResult{Index: i, ID: b.IDs[j], Status: status}
+	}
+
+	for _, result := range b.response.Results {
+		if result.Status == statusRejected {
+			b.response.Rejected++
+		} else {
+			b.response.Accepted++
+		}
+	}
+
+	return nil
+}
+
+// invalid возвращает ошибку элемента, не прошедшего проверку
+func invalid(message string, fields map[string]string) *ErrorResponse {
+	return &ErrorResponse{Code: codeValidationFailed, Message: message, Fields: fields}
+}
+
+// BatchHandler добавляет пакет выражений. Каждый элемент проверяется отдельно и может ссылаться
+// на предыдущие элементы; принятые выражения сохраняются одной транзакцией.
+func (s *Server) BatchHandler(w http.ResponseWriter, r *http.Request) {
+	defer Close(r)
+
+	var webClient, ok = s.clients.Get(Username(r))
+	if !ok {
+		WriteError(w, http.StatusNotFound, codeNotFound, "User not found", nil)
+		return
+	}
+
+	items, err := readBatch(s.batchBody(w, r), s.batchSize)
+	if writeTooLarge(w, err) {
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusBadRequest, codeInvalidJSON, "Invalid request body: "+err.Error(), nil)
+		return
+	}
+
+	if len(items) == 0 {
+		WriteError(w, http.StatusBadRequest, codeValidationFailed, "The batch is empty", nil)
+		return
+	} else if len(items) > s.batchSize {
+		s.writeBatchSize(w)
+		return
+	}
+
+	variables, err := s.store.GetVariables(webClient.Name())
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, codeInternal, "Error reading variables: "+err.Error(), nil)
+		return
+	}
+
+	var (
+		b    = newBatch(len(items))
+		seen = make(map[string]bool, len(items))
+	)
+	for i, raw := range items {
+		var item BatchItem
+		if err = json.Unmarshal(raw, &item); err != nil {
+			b.reject(i, "", &ErrorResponse{Code: codeInvalidJSON, Message: "Invalid JSON data: " + err.Error()})
+			continue
+		}
+
+		var fields = map[string]string{}
+		switch {
+		case item.ID == "":
+			fields["id"] = "is required"
+		case seen[item.ID]:
+			fields["id"] = "is repeated in the batch"
+		}
+		if item.Content == "" {
+			fields["content"] = "is required"
+		}
+		if len(fields) != 0 {
+			b.reject(i, item.ID, invalid("Invalid expression", fields))
+			continue
+		}
+		seen[item.ID] = true
+
+		content, bindings, err := prepareContent(item.Content, variables, item.Bindings)
+		if err != nil {
+			b.reject(i, item.ID, invalid("Error preparing expression: "+err.Error(), map[string]string{"content": err.Error()}))
+			continue
+		}
+
+		expr, err := expressions.NewExpression(s.timings, content, bindings, webClient.Expressions.Now())
+		if err != nil {
+			b.reject(i, item.ID, invalid("Error preparing expression: "+err.Error(), map[string]string{"content": err.Error()}))
+			continue
+		}
+
+		b.add(i, item.ID, expr)
+	}
+
+	if err = b.commit(r.Context(), webClient.Expressions); err != nil {
+		WriteError(w, http.StatusInternalServerError, codeInternal, "Error saving expressions: "+err.Error(), nil)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, b.response)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/rest"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// EventsPollInterval как часто поток событий проверяет, изменился ли статус выражения
+const EventsPollInterval = 100 * time.Millisecond
+
+// EventsHandler передаёт состояние выражения пользователя как server-sent events.
+// Событие "state" с подробностями о выражении отправляется сразу и при каждой смене статуса.
+// Поток завершается, когда выражение вычислено или завершилось ошибкой, или когда сервер прекращает вычисления.
+func (s *Server) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	var ID = r.PathValue("id")
+
+	var webClient, ok = s.clients.Get(Username(r))
+	if !ok {
+		WriteError(w, http.StatusNotFound, codeNotFound, "User not found", nil)
+		return
+	}
+
+	var expr, found = webClient.Expressions.GetExpressions()[ID]
+	if !found {
+		WriteError(w, http.StatusNotFound, codeNotFound, "There is no such expression: "+ID, nil)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		WriteError(w, http.StatusInternalServerError, codeInternal, "Streaming is not supported", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	var (
+		ticker = time.NewTicker(EventsPollInterval)
+		sent   string
+	)
+	defer ticker.Stop()
+
+	for {
+		var status, _, _ = expr.State()
+		if status != sent {
+			var details, err = json.Marshal(newExpressionDetails(ID, webClient.Expressions))
+			if err != nil {
+				s.logger.ErrorContext(r.Context(), "Failed to encode the expression", "expression", ID, "error", err)
+				return
+			}
+
+			if _, err = fmt.Fprintf(w, "event: state\ndata: %s\n\n", details); err != nil {
+				return
+			}
+			flusher.Flush()
+			sent = status
+		}
+
+		if status == rest.StatusDone || status == rest.StatusFailed {
+			return
+		}
+
+		select {
+		case <-expr.Done():
+		case <-ticker.C:
+		case <-r.Context().Done():
+			return
+		case <-s.scheduler.Stopped():
+			return
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package server
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/database"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/expressions"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/rest"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxPageSize наибольший размер страницы списка выражений по умолчанию
+const MaxPageSize = 500
+
+// ExpressionPage тело ответа GET /api/v1/expressions
+type ExpressionPage struct {
+	Items      []expressions.Record `json:"items"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+// ExpressionDetails состояние выражения, которое возвращает GET /expressions/{id}
+type ExpressionDetails struct {
+	ID           string             `json:"id"`
+	Expression   string             `json:"expression"`
+	Status       string             `json:"status"`
+	Result       *float64           `json:"result,omitempty"`
+	Error        string             `json:"error,omitempty"`
+	Created      time.Time          `json:"created"`
+	Finished     *time.Time         `json:"finished,omitempty"`
+	BestCase     string             `json:"best_case"`
+	ETA          string             `json:"eta"`
+	Timeline     *Timeline          `json:"timeline,omitempty"`
+	Bindings     map[string]float64 `json:"bindings,omitempty"`
+	Dependencies []string           `json:"dependencies"`
+	Dependents   []string           `json:"dependents"`
+	Graph        DependencyGraph    `json:"graph"`
+}
+
+// Timeline как на самом деле прошло последнее вычисление выражения. Хранится в памяти,
+// поэтому у выражений, вычисленных до перезапуска, его нет.
+type Timeline struct {
+	Started    time.Time         `json:"started"`
+	Finished   *time.Time        `json:"finished,omitempty"`
+	Actual     string            `json:"actual"` // До окончания или до текущего момента, если вычисление идёт
+	Operations []OperationTiming `json:"operations"`
+}
+
+// OperationTiming операция, выполненная при вычислении
+type OperationTiming struct {
+	Operator string    `json:"operator"`
+	Operands []float64 `json:"operands"`
+	Result   *float64  `json:"result,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Worker   int       `json:"worker"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration string    `json:"duration"`
+}
+
+// newTimeline возвращает ход вычисления выражения или nil, если оно не начиналось.
+// Идущее вычисление измеряется до текущего момента.
+func newTimeline(expr *rest.Expression, now time.Time) *Timeline {
+	var started = expr.StartedAt()
+	if started.IsZero() {
+		return nil
+	}
+
+	var timeline = &Timeline{Started: started, Operations: []OperationTiming{}}
+	var end = now
+	if finished := expr.FinishedAt(); !finished.IsZero() {
+		timeline.Finished, end = &finished, finished
+	}
+	timeline.Actual = end.Sub(started).String()
+
+	for _, operation := range expr.Operations() {
+		var timing = OperationTiming{
+			Operator: operation.Operator,
+			Operands: operation.Operands,
+			Worker:   operation.Worker,
+			Start:    operation.Start,
+			End:      operation.End,
+			Duration: operation.End.Sub(operation.Start).String(),
+		}
+		if operation.Err != nil {
+			timing.Error = operation.Err.Error()
+		} else {
+			timing.Result = &operation.Result
+		}
+		timeline.Operations = append(timeline.Operations, timing)
+	}
+	slices.SortStableFunc(timeline.Operations, func(a, b OperationTiming) int {
+		return a.Start.Compare(b.Start)
+	})
+
+	return timeline
+}
+
+// DependencyGraph содержит выражение и все выражения, на которые оно ссылается, в том числе косвенно.
+// Ребро идёт от выражения к тому, на которое оно ссылается.
+type DependencyGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+type GraphNode struct {
+	ID     string   `json:"id"`
+	Status string   `json:"status"`
+	Result *float64 `json:"result,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// expressionState возвращает статус, результат, если он есть, и текст ошибки
+func expressionState(expr *rest.Expression) (string, *float64, string) {
+	var status, value, err = expr.State()
+
+	switch {
+	case err != nil:
+		return status, nil, err.Error()
+	case status == rest.StatusDone:
+		return status, &value, ""
+	default:
+		return status, nil, ""
+	}
+}
+
+// NewDependencyGraph собирает выражения, на которые прямо или косвенно ссылается выражение с ID
+func NewDependencyGraph(ID string, exprs map[string]*rest.Expression) DependencyGraph {
+	var (
+		graph   = DependencyGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+		queue   = []string{ID}
+		visited = map[string]bool{ID: true}
+	)
+
+	for len(queue) != 0 {
+		var current = queue[0]
+		queue = queue[1:]
+
+		var expr, ok = exprs[current]
+		if !ok {
+			graph.Nodes = append(graph.Nodes, GraphNode{ID: current, Status: "missing"})
+			continue
+		}
+
+		var status, result, errMessage = expressionState(expr)
+		graph.Nodes = append(graph.Nodes, GraphNode{ID: current, Status: status, Result: result, Error: errMessage})
+
+		for _, dependency := range expr.Dependencies {
+			graph.Edges = append(graph.Edges, GraphEdge{From: current, To: dependency})
+
+			if !visited[dependency] {
+				visited[dependency] = true
+				queue = append(queue, dependency)
+			}
+		}
+	}
+
+	return graph
+}
+
+// newExpressionDetails возвращает состояние выражения пользователя с ID, которое должно существовать
+func newExpressionDetails(ID string, collection *expressions.Expressions) ExpressionDetails {
+	var (
+		exprs  = collection.GetExpressions()
+		expr   = exprs[ID]
+		eta, _ = collection.ETA(ID)
+	)
+
+	var dependents = []string{}
+	for key, val := range exprs {
+		if slices.Contains(val.Dependencies, ID) {
+			dependents = append(dependents, key)
+		}
+	}
+	slices.Sort(dependents)
+
+	var status, result, errMessage = expressionState(expr)
+	var details = ExpressionDetails{
+		ID:           ID,
+		Expression:   expr.Express,
+		Status:       status,
+		Result:       result,
+		Error:        errMessage,
+		Created:      expr.Created,
+		BestCase:     expr.Expiration.String(),
+		ETA:          eta.Round(time.Millisecond).String(),
+		Timeline:     newTimeline(expr, collection.Now()),
+		Bindings:     expr.Bindings,
+		Dependencies: append([]string{}, expr.Dependencies...),
+		Dependents:   dependents,
+		Graph:        NewDependencyGraph(ID, exprs),
+	}
+	if finished := expr.FinishedAt(); !finished.IsZero() {
+		details.Finished = &finished
+	}
+
+	return details
+}
+
+// ExpressionHandler возвращает состояние выражения пользователя с графом его зависимостей
+func (s *Server) ExpressionHandler(w http.ResponseWriter, r *http.Request) {
+	var ID = r.PathValue("id")
+
+	var webClient, ok = s.clients.Get(Username(r))
+	if !ok {
+		WriteError(w, http.StatusNotFound, codeNotFound, "User not found", nil)
+		return
+	}
+
+	if _, err := webClient.Expressions.GetExpression(ID); err != nil {
+		WriteError(w, http.StatusNotFound, codeNotFound, "There is no such expression: "+ID, nil)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, newExpressionDetails(ID, webClient.Expressions))
+}
+
+// CancelHandler отменяет ещё не завершённое выражение пользователя.
+// Выражения, которые на него ссылаются, завершаются ошибкой; в ответе - отменённое выражение.
+func (s *Server) CancelHandler(w http.ResponseWriter, r *http.Request) {
+	var ID = r.PathValue("id")
+
+	var webClient, ok = s.clients.Get(Username(r))
+	if !ok {
+		WriteError(w, http.StatusNotFound, codeNotFound, "User not found", nil)
+		return
+	}
+
+	if _, ok = webClient.Expressions.GetExpressions()[ID]; !ok {
+		WriteError(w, http.StatusNotFound, codeNotFound, "There is no such expression: "+ID, nil)
+		return
+	}
+
+	if _, err := webClient.Expressions.Cancel(ID); errors.Is(err, expressions.ErrFinished) {
+		WriteError(w, http.StatusConflict, codeConflict, "The expression is already finished: "+ID, nil)
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, codeInternal, err.Error(), nil)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, newExpressionDetails(ID, webClient.Expressions))
+}
+
+// parseExpressionQuery читает фильтры, порядок сортировки и страницу списка.
+// Страница содержит не больше maxPage выражений.
+func parseExpressionQuery(r *http.Request, maxPage int) (database.ExpressionQuery, map[string]string) {
+	var (
+		params = r.URL.Query()
+		query  = database.ExpressionQuery{
+			Contains: params.Get("q"),
+			Sort:     params.Get("sort"),
+			Limit:    min(database.DefaultLimit, maxPage),
+			Cursor:   params.Get("cursor"),
+		}
+		fields = map[string]string{}
+	)
+
+	if value := params.Get("status"); value != "" {
+		for _, status := range strings.Split(value, ",") {
+			switch status {
+			case rest.StatusWaiting, rest.StatusComputing, rest.StatusDone, rest.StatusFailed:
+				query.Statuses = append(query.Statuses, status)
+			default:
+				fields["status"] = "must be waiting, computing, done or failed"
+			}
+		}
+	}
+
+	for name, date := range map[string]*time.Time{"created_after": &query.CreatedFrom, "created_before": &query.CreatedTo} {
+		if value := params.Get(name); value != "" {
+			var err error
+			if *date, err = time.Parse(time.RFC3339, value); err != nil {
+				fields[name] = "must be an RFC 3339 date"
+			}
+		}
+	}
+
+	switch query.Sort {
+	case "", database.SortCreated, database.SortFinished, database.SortEstimated:
+	default:
+		fields["sort"] = "must be created, finished or estimated"
+	}
+
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		fields["order"] = "must be asc or desc"
+	}
+
+	if value := params.Get("limit"); value != "" {
+		var err error
+		if query.Limit, err = strconv.Atoi(value); err != nil || query.Limit < 1 || query.Limit > maxPage {
+			fields["limit"] = "must be a number from 1 to " + strconv.Itoa(maxPage)
+		}
+	}
+
+	return query, fields
+}
+
+// ListExpressionsHandler возвращает страницу выражений пользователя, отфильтрованных и отсортированных на стороне базы данных
+func (s *Server) ListExpressionsHandler(w http.ResponseWriter, r *http.Request) {
+	var query, fields = parseExpressionQuery(r, s.pageSize)
+	if len(fields) != 0 {
+		WriteError(w, http.StatusBadRequest, codeValidationFailed, "Invalid query parameters", fields)
+		return
+	}
+
+	rows, next, err := s.store.ListExpressions(Username(r), query)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		WriteError(w, http.StatusBadRequest, codeValidationFailed, "Invalid query parameters",
+			map[string]string{"cursor": "is malformed or belongs to another sort order"})
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, codeInternal, "Error listing expressions: "+err.Error(), nil)
+		return
+	}
+
+	var records = make([]expressions.Record, len(rows))
+	for i, row := range rows {
+		records[i] = expressions.RowRecord(row)
+	}
+
+	WriteJSON(w, http.StatusOK, ExpressionPage{Items: records, NextCursor: next})
+}
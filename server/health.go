@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// ReadinessTimeout ограничивает, сколько /readyz ждёт ответа хранилища
+const ReadinessTimeout = 2 * time.Second
+
+// Health тело ответа /healthz и /readyz. Checks называет каждое условие готовности
+// и содержит "ok" или причину, по которой оно не выполнено.
+type Health struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Статусы Health
+const (
+	healthOK       = "ok"
+	healthReady    = "ready"
+	healthNotReady = "not_ready"
+)
+
+// HealthHandler сообщает, что процесс работает. Не зависит от хранилища и вычислителя.
+func (s *Server) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, Health{Status: healthOK})
+}
+
+// ReadyHandler сообщает, может ли сервер принимать работу: хранилище доступно, его схема
+// обновлена и вычислитель принимает новые вычисления. Перестаёт проходить, как только начинается плавная остановка.
+func (s *Server) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	var (
+		health = Health{Status: healthReady, Checks: map[string]string{}}
+		check  = func(name string, err error) {
+			if err != nil {
+				health.Status = healthNotReady
+				health.Checks[name] = err.Error()
+			} else {
+				health.Checks[name] = healthOK
+			}
+		}
+	)
+
+	var ctx, cancel = context.WithTimeout(r.Context(), ReadinessTimeout)
+	defer cancel()
+
+	var err = s.store.Ping(ctx)
+	check("database", err)
+	if err == nil {
+		check("migrations", s.store.CheckSchema())
+	} else {
+		check("migrations", errDatabaseUnreachable)
+	}
+
+	select {
+	case <-s.scheduler.Stopped():
+		check("scheduler", errDraining)
+	default:
+		check("scheduler", nil)
+	}
+
+	var status = http.StatusOK
+	if health.Status != healthReady {
+		status = http.StatusServiceUnavailable
+		s.logger.WarnContext(r.Context(), "Not ready", "checks", health.Checks)
+	}
+	WriteJSON(w, status, health)
+}
+
+// Причины непройденных проверок готовности, у которых нет своей ошибки
+var (
+	errDatabaseUnreachable = errors.New("database is unreachable")
+	errDraining            = errors.New("shutting down")
+)
+
+// Version тело ответа /version, взятое из информации о сборке
+type Version struct {
+	Module    string `json:"module"`
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// buildVersion читает информацию о сборке один раз, пока процесс работает, она не меняется
+var buildVersion = func() Version {
+	var info, ok = debug.ReadBuildInfo()
+	if !ok {
+		return Version{Version: "unknown"}
+	}
+
+	var version = Version{Module: info.Main.Path, Version: info.Main.Version, GoVersion: info.GoVersion}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			version.Revision = setting.Value
+		case "vcs.time":
+			version.Time = setting.Value
+		case "vcs.modified":
+			version.Modified = setting.Value == "true"
+		}
+	}
+	if version.Version == "" {
+		version.Version = "(devel)"
+	}
+
+	return version
+}()
+
+// VersionHandler возвращает информацию о сборке сервера
+func (s *Server) VersionHandler(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, buildVersion)
+}
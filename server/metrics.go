@@ -0,0 +1,133 @@
+package server
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/calculator"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/database"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/metrics"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/rest"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// operationBuckets верхние границы длительности операций в секундах, которые бывают до минуты
+var operationBuckets = []float64{.01, .05, .1, .25, .5, .75, 1, 1.5, 2, 3, 5, 10, 30, 60}
+
+// serverMetrics метрики, которые отдаёт /metrics
+type serverMetrics struct {
+	registry            *metrics.Registry
+	requests            *metrics.Counter
+	requestDuration     *metrics.Histogram
+	submitted           *metrics.Counter
+	finished            *metrics.Counter
+	operations          *metrics.Counter
+	operationDuration   *metrics.Histogram
+	operationConfigured *metrics.Counter
+	queryDuration       *metrics.Histogram
+	queryErrors         *metrics.Counter
+}
+
+// newMetrics регистрирует метрики сервера. Gauge читают состояние сервера при каждом сборе.
+func newMetrics(s *Server) *serverMetrics {
+	var (
+		registry = metrics.NewRegistry()
+		m        = &serverMetrics{registry: registry}
+	)
+
+	m.requests = registry.NewCounter("http_requests_total",
+		"HTTP requests by route, method and status code.", "route", "method", "status")
+	m.requestDuration = registry.NewHistogram("http_request_duration_seconds",
+		"Time to serve HTTP requests by route and method.", nil, "route", "method")
+
+	m.submitted = registry.NewCounter("calc_expressions_submitted_total",
+		"Expressions queued for computing, including the ones resumed after a restart.")
+	m.finished = registry.NewCounter("calc_expressions_finished_total",
+		"Expressions that finished computing by final status.", "status")
+	registry.NewGaugeFunc("calc_expressions", "Expressions of all users by current status.", []string{"status"},
+		func(set func(float64, ...string)) {
+			var counts = map[string]int{
+				rest.StatusWaiting: 0, rest.StatusComputing: 0, rest.StatusDone: 0, rest.StatusFailed: 0,
+			}
+			for _, webClient := range s.clientList() {
+				for _, ex := range webClient.Expressions.GetExpressions() {
+					var status, _, _ = ex.State()
+					counts[status]++
+				}
+			}
+			for status, count := range counts {
+				set(float64(count), status)
+			}
+		})
+
+	registry.NewGaugeFunc("calc_queue_depth", "Expressions waiting for a free worker.", nil,
+		func(set func(float64, ...string)) { set(float64(s.scheduler.Queued())) })
+	registry.NewGaugeFunc("calc_workers_busy", "Expressions being computed.", nil,
+		func(set func(float64, ...string)) { set(float64(s.scheduler.Computing())) })
+	registry.NewGaugeFunc("calc_workers_limit", "Maximum number of expressions computed at once, 0 if unlimited.", nil,
+		func(set func(float64, ...string)) { set(float64(s.scheduler.Workers())) })
+	registry.NewGaugeFunc("calc_active_workers", "Operations being executed right now by operation, as listed by /processes.",
+		[]string{"operation"}, func(set func(float64, ...string)) {
+			var counts = map[string]int{}
+			for _, operator := range s.scheduler.Processes() {
+				counts[operationName(operator)]++
+			}
+			for operation, count := range counts {
+				set(float64(count), operation)
+			}
+		})
+
+	m.operations = registry.NewCounter("calc_operations_total",
+		"Executed operations and functions by operation.", "operation")
+	m.operationDuration = registry.NewHistogram("calc_operation_duration_seconds",
+		"Actual execution time of operations and functions by operation.", operationBuckets, "operation")
+	m.operationConfigured = registry.NewCounter("calc_operation_configured_seconds_total",
+		"Sum of the configured execution times of the executed operations, to compare with calc_operation_duration_seconds_sum.",
+		"operation")
+	registry.NewGaugeFunc("calc_operation_configured_seconds", "Current configured execution time by operation.",
+		[]string{"operation"}, func(set func(float64, ...string)) {
+			for operator, duration := range s.timings.All() {
+				set(duration.Seconds(), operationName(operator))
+			}
+		})
+
+	m.queryDuration = registry.NewHistogram("calc_db_query_duration_seconds",
+		"Time of store calls by method.", nil, "method")
+	m.queryErrors = registry.NewCounter("calc_db_query_errors_total",
+		"Failed store calls by method, not counting missing records.", "method")
+
+	return m
+}
+
+// observer передаёт события вычислителя в метрики
+func (m *serverMetrics) observer() calculator.Observer {
+	return calculator.Observer{
+		Submitted: func() { m.submitted.Inc() },
+		Finished:  func(status string) { m.finished.Inc(status) },
+		Operation: func(operator string, configured, actual time.Duration) {
+			var operation = operationName(operator)
+			m.operations.Inc(operation)
+			m.operationDuration.Observe(actual.Seconds(), operation)
+			m.operationConfigured.Add(configured.Seconds(), operation)
+		},
+	}
+}
+
+// observeQuery учитывает вызов хранилища
+func (m *serverMetrics) observeQuery(method string, duration time.Duration, err error) {
+	m.queryDuration.Observe(duration.Seconds(), method)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		m.queryErrors.Inc(method)
+	}
+}
+
+// observeRequest учитывает обслуженный запрос маршрута
+func (m *serverMetrics) observeRequest(route, method string, status int, duration time.Duration) {
+	m.requests.Inc(route, method, strconv.Itoa(status))
+	m.requestDuration.Observe(duration.Seconds(), route, method)
+}
+
+// MetricsHandler отдаёт метрики в текстовом формате Prometheus
+func (s *Server) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	s.metrics.registry.ServeHTTP(w, r)
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/database"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/logging"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/tracing"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// RequestIDHeader содержит ID запроса. Корректный ID, присланный клиентом, сохраняется,
+// иначе создаётся новый. ID возвращается в ответе и добавляется в логи.
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID ограничивает ID, принимаемые от клиентов, чтобы они не могли подделать строки лога
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware добавляет ID запроса в его контекст и в заголовки ответа
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ID = r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(ID) {
+			ID = logging.NewRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, ID)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), ID)))
+	})
+}
+
+// quietRoutes опрашиваются оркестраторами и сборщиками метрик, поэтому их запросы пишутся в лог на уровне debug
+var quietRoutes = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+// observe пишет запросы маршрута в лог, учитывает их в метриках и трассирует.
+// Span запроса - текущий span его контекста.
+func (s *Server) observe(pattern string, next http.Handler) http.Handler {
+	var route = pattern
+	if _, path, found := strings.Cut(pattern, " "); found {
+		route = path
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			started  = time.Now()
+			recorder = &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			span     *tracing.Span
+		)
+		if !quietRoutes[route] { // Проверки и сбор метрик вытеснили бы вычисления из хранимых трасс
+			var ctx context.Context
+			ctx, span = s.tracer.Start(r.Context(), "http.request",
+				"http.method", r.Method, "http.route", route, "http.target", r.URL.Path, logging.RequestIDKey, logging.RequestID(r.Context()))
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(recorder, r)
+
+		var duration = time.Since(started)
+		s.metrics.observeRequest(route, r.Method, recorder.status, duration)
+		span.SetAttributes("http.status_code", recorder.status)
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetError(errors.New(http.StatusText(recorder.status)))
+		}
+		span.End()
+
+		var level = slog.LevelInfo
+		if quietRoutes[route] {
+			level = slog.LevelDebug
+		}
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		s.logger.LogAttrs(r.Context(), level, "Request served",
+			slog.String("method", r.Method), slog.String("route", route), slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.status), slog.Duration("duration", duration))
+	})
+}
+
+// observeQuery пишет в лог неудачные вызовы хранилища и учитывает каждый вызов в метриках
+func (s *Server) observeQuery(method string, duration time.Duration, err error) {
+	s.metrics.observeQuery(method, duration, err)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		s.logger.Warn("Store call failed", "method", method, "duration", duration, "error", err)
+	}
+}
+
+// statusRecorder запоминает код статуса, записанный обработчиком
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	if !recorder.wroteHeader {
+		recorder.status = status
+		recorder.wroteHeader = true
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *statusRecorder) Write(content []byte) (int, error) {
+	recorder.wroteHeader = true
+	return recorder.ResponseWriter.Write(content)
+}
+
+// Flush позволяет потоку событий дойти до клиента через statusRecorder
+func (recorder *statusRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap даёт http.ResponseController доступ к исходному http.ResponseWriter
+func (recorder *statusRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// OpenAPI документ OpenAPI 3.1, описывающий все маршруты Handler
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+// docsPage показывает OpenAPI в браузере, ничего не загружая с других хостов
+//
+//go:embed docs.html
+var docsPage []byte
+
+// OpenAPIHandler отдаёт документ OpenAPI
+func (s *Server) OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(OpenAPI); err != nil {
+		s.logger.ErrorContext(r.Context(), "Failed to write the OpenAPI document", "error", err)
+	}
+}
+
+// DocsHandler отдаёт страницу для просмотра и проверки API
+func (s *Server) DocsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write(docsPage); err != nil {
+		s.logger.ErrorContext(r.Context(), "Failed to write the documentation page", "error", err)
+	}
+}
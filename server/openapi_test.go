@@ -0,0 +1,437 @@
+package server
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/calculator"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// object разобранный JSON-объект документа OpenAPI
+type object = map[string]interface{}
+
+// methods операции, которые может содержать путь документа
+var methods = []string{"get", "post", "put", "patch", "delete"}
+
+// spec сверяет настоящие ответы с документом OpenAPI и запоминает проверенные операции
+type spec struct {
+	t         *testing.T
+	ts        *httptest.Server
+	doc       object
+	exercised map[string]bool
+}
+
+func newSpec(t *testing.T, ts *httptest.Server) *spec {
+	var doc object
+	if err := json.Unmarshal(OpenAPI, &doc); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+
+	return &spec{t: t, ts: ts, doc: doc, exercised: map[string]bool{}}
+}
+
+// resolve переходит по локальной ссылке $ref значения
+func (s *spec) resolve(value interface{}) object {
+	var node, _ = value.(object)
+	for node != nil {
+		var ref, ok = node["$ref"].(string)
+		if !ok {
+			break
+		}
+
+		var target interface{} = s.doc
+		for _, key := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			target = target.(object)[key]
+		}
+		node, _ = target.(object)
+		if node == nil {
+			s.t.Fatalf("unresolved reference %s", ref)
+		}
+	}
+
+	return node
+}
+
+// operation находит шаблон пути, подходящий к path, предпочитая постоянные сегменты параметрам
+func (s *spec) operation(method, path string) (string, object) {
+	var (
+		segments = strings.Split(path, "/")
+		best     string
+		params   = math.MaxInt
+	)
+	for template := range s.doc["paths"].(object) {
+		var parts = strings.Split(template, "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+
+		var count int
+		for i, part := range parts {
+			if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+				count++
+			} else if part != segments[i] {
+				count = -1
+				break
+			}
+		}
+
+		if count >= 0 && count < params {
+			best, params = template, count
+		}
+	}
+
+	if best == "" {
+		return "", nil
+	}
+
+	var op, _ = s.doc["paths"].(object)[best].(object)[strings.ToLower(method)].(object)
+	return best, op
+}
+
+// call отправляет запрос и проверяет статус, тип содержимого и тело ответа
+func (s *spec) call(method, path, token, contentType, body string) (int, string) {
+	s.t.Helper()
+
+	req, err := http.NewRequest(method, s.ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := s.ts.Client().Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	var route = method + " " + strings.SplitN(path, "?", 2)[0]
+	template, op := s.operation(method, strings.SplitN(path, "?", 2)[0])
+	if op == nil {
+		s.t.Errorf("%s: not documented", route)
+		return resp.StatusCode, string(content)
+	}
+	s.exercised[op["operationId"].(string)] = true
+
+	var response = s.resolve(op["responses"].(object)[strconv.Itoa(resp.StatusCode)])
+	if response == nil {
+		s.t.Errorf("%s: status %d is not documented: %s", route, resp.StatusCode, content)
+		return resp.StatusCode, string(content)
+	}
+
+	var media, _ = response["content"].(object)
+	if len(media) == 0 || len(content) == 0 {
+		return resp.StatusCode, string(content)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	var schema = s.resolve(media[mediaType])
+	if schema == nil {
+		s.t.Errorf("%s %d: content type %q is not documented for %s", route, resp.StatusCode, mediaType, template)
+		return resp.StatusCode, string(content)
+	}
+	schema = s.resolve(schema["schema"])
+
+	switch mediaType {
+	case "application/json":
+		s.validateJSON(route, schema, content)
+	case "application/x-ndjson":
+		var scanner = bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			s.validateJSON(route, schema, scanner.Bytes())
+		}
+	}
+
+	return resp.StatusCode, string(content)
+}
+
+// validateJSON разбирает content и сообщает, где он не соответствует схеме
+func (s *spec) validateJSON(route string, schema object, content []byte) {
+	s.t.Helper()
+
+	var value interface{}
+	if err := json.Unmarshal(content, &value); err != nil {
+		s.t.Errorf("%s: invalid JSON: %v", route, err)
+		return
+	}
+
+	for _, problem := range s.validate(schema, value, "$") {
+		s.t.Errorf("%s: %s in %s", route, problem, content)
+	}
+}
+
+// validate проверяет значение по той части JSON Schema, которая используется в документе
+func (s *spec) validate(schema object, value interface{}, at string) []string {
+	schema = s.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+
+	if values, ok := schema["enum"].([]interface{}); ok && !slices.Contains(values, value) {
+		return []string{fmt.Sprintf("%s: %v is not one of %v", at, value, values)}
+	}
+
+	var problems []string
+	switch schema["type"] {
+	case "object":
+		var fields, ok = value.(object)
+		if !ok {
+			return []string{at + ": not an object"}
+		}
+
+		var properties, _ = schema["properties"].(object)
+		for _, name := range asStrings(schema["required"]) {
+			if _, ok := fields[name]; !ok {
+				problems = append(problems, at+": missing "+name)
+			}
+		}
+
+		for name, field := range fields {
+			if property, ok := properties[name]; ok {
+				problems = append(problems, s.validate(s.resolve(property), field, at+"."+name)...)
+				continue
+			}
+
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					problems = append(problems, at+": undocumented field "+name)
+				}
+			case object:
+				problems = append(problems, s.validate(extra, field, at+"."+name)...)
+			}
+		}
+	case "array":
+		var items, ok = value.([]interface{})
+		if !ok {
+			return []string{at + ": not an array"}
+		}
+
+		var itemSchema, _ = schema["items"].(object)
+		for i, item := range items {
+			problems = append(problems, s.validate(itemSchema, item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		var text, ok = value.(string)
+		if !ok {
+			return []string{at + ": not a string"}
+		}
+
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, text); err != nil {
+				problems = append(problems, at+": not a date-time")
+			}
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return []string{at + ": not a number"}
+		}
+	case "integer":
+		if number, ok := value.(float64); !ok || number != math.Trunc(number) {
+			return []string{at + ": not an integer"}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{at + ": not a boolean"}
+		}
+	}
+
+	return problems
+}
+
+func asStrings(value interface{}) []string {
+	var items, _ = value.([]interface{})
+	var strs = make([]string, 0, len(items))
+	for _, item := range items {
+		strs = append(strs, item.(string))
+	}
+
+	return strs
+}
+
+// expect завершает тест ошибкой, если вызов вернул другой статус
+func (s *spec) expect(status int, method, path, token, contentType, body string) string {
+	s.t.Helper()
+
+	var code, content = s.call(method, path, token, contentType, body)
+	if code != status {
+		s.t.Errorf("%s %s: got %d, want %d: %s", method, path, code, status, content)
+	}
+
+	return content
+}
+
+// waitDone опрашивает выражение, пока оно не завершится
+func (s *spec) waitDone(token, ID string) {
+	s.t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var details ExpressionDetails
+		if err := json.Unmarshal([]byte(s.expect(http.StatusOK, http.MethodGet, "/expressions/"+ID, token, "", "")), &details); err != nil {
+			s.t.Fatal(err)
+		}
+		if details.Status == "done" || details.Status == "failed" {
+			return
+		}
+	}
+
+	s.t.Fatalf("%s is not finished", ID)
+}
+
+func TestOpenAPI_Routes(t *testing.T) {
+	var sp = newSpec(t, nil)
+
+	// Обработчики только перечисляются, поэтому серверу не нужно состояние
+	for _, route := range (&Server{}).routes() {
+		var method, path, found = strings.Cut(route.pattern, " ")
+		if !found {
+			method, path = "", route.pattern
+		}
+
+		var item, ok = sp.doc["paths"].(object)[path].(object)
+		if !ok {
+			t.Errorf("%s is not documented", route.pattern)
+			continue
+		}
+
+		if method != "" {
+			if _, ok = item[strings.ToLower(method)]; !ok {
+				t.Errorf("%s is not documented", route.pattern)
+			}
+			continue
+		}
+
+		if !slices.ContainsFunc(methods, func(method string) bool { return item[method] != nil }) {
+			t.Errorf("%s has no documented operations", route.pattern)
+		}
+	}
+}
+
+func TestOpenAPI_Responses(t *testing.T) {
+	var (
+		ts    = newTestServer(t, calculator.NewUniformTimings(0))
+		sp    = newSpec(t, ts)
+		creds = `{"username": "name", "password": "password"}`
+	)
+
+	// Пользователи
+	sp.expect(http.StatusOK, http.MethodPost, "/register", "", "application/json", creds)
+	sp.expect(http.StatusBadRequest, http.MethodPost, "/register", "", "application/json", `{"username": "name"}`)
+	var token = sp.expect(http.StatusOK, http.MethodGet, "/login", "", "application/json", creds)
+	sp.expect(http.StatusUnauthorized, http.MethodGet, "/login", "", "application/json", `{"username": "other", "password": "password"}`)
+	sp.expect(http.StatusUnauthorized, http.MethodGet, "/login", "", "application/json", `{"username": "name", "password": "wrong"}`)
+
+	// Служебные маршруты
+	sp.expect(http.StatusOK, http.MethodGet, "/openapi.json", "", "", "")
+	sp.expect(http.StatusOK, http.MethodGet, "/docs", "", "", "")
+	sp.expect(http.StatusOK, http.MethodGet, "/healthz", "", "", "")
+	sp.expect(http.StatusOK, http.MethodGet, "/readyz", "", "", "")
+	sp.expect(http.StatusOK, http.MethodGet, "/version", "", "", "")
+
+	// Время операций
+	var table map[string]string
+	if err := json.Unmarshal([]byte(sp.expect(http.StatusOK, http.MethodGet, "/math", "", "", "")), &table); err != nil {
+		t.Fatal(err)
+	}
+	table["username"], table["token"] = "name", token
+	full, _ := json.Marshal(table)
+	sp.expect(http.StatusOK, http.MethodPost, "/math", "", "application/json", string(full))
+	sp.expect(http.StatusOK, http.MethodPatch, "/math", "", "application/json",
+		`{"username": "name", "token": "`+token+`", "addition": "1ms"}`)
+	sp.expect(http.StatusBadRequest, http.MethodPatch, "/math", "", "application/json",
+		`{"username": "name", "token": "`+token+`", "addition": "-1s", "unknown": "1s"}`)
+	sp.expect(http.StatusUnauthorized, http.MethodPatch, "/math", "", "application/json", `{"addition": "1ms"}`)
+	sp.expect(http.StatusOK, http.MethodGet, "/math/audit", token, "", "")
+	sp.expect(http.StatusUnauthorized, http.MethodGet, "/math/audit", "wrong", "", "")
+
+	// Переменные
+	sp.expect(http.StatusCreated, http.MethodPost, "/variables", token, "application/json", `{"name": "x", "value": 2}`)
+	sp.expect(http.StatusConflict, http.MethodPost, "/variables", token, "application/json", `{"name": "x", "value": 2}`)
+	sp.expect(http.StatusBadRequest, http.MethodPost, "/variables", token, "application/json", `{"name": "1x", "value": 2}`)
+	sp.expect(http.StatusOK, http.MethodPut, "/variables", token, "application/json", `{"name": "x", "value": 3}`)
+	sp.expect(http.StatusOK, http.MethodGet, "/variables", token, "", "")
+	sp.expect(http.StatusNotFound, http.MethodDelete, "/variables", token, "application/json", `{"name": "y"}`)
+	sp.expect(http.StatusNoContent, http.MethodDelete, "/variables", token, "application/json", `{"name": "x"}`)
+	sp.expect(http.StatusNotFound, http.MethodPut, "/variables", token, "application/json", `{"name": "x", "value": 3}`)
+
+	// Прежние маршруты
+	sp.expect(http.StatusOK, http.MethodPost, "/expression", token, "application/json",
+		`{"id": "a", "content": "1+x", "bindings": {"x": 2}}`)
+	sp.expect(http.StatusBadRequest, http.MethodPost, "/expression", token, "application/json", `{"id": "a"}`)
+	sp.expect(http.StatusConflict, http.MethodPost, "/expression", token, "application/json", `{"id": "a", "content": "1"}`)
+	sp.expect(http.StatusBadRequest, http.MethodPost, "/expression", token, "application/json", `{"id": "c", "content": "$c+1"}`)
+	sp.waitDone(token, "a")
+	sp.expect(http.StatusOK, http.MethodPost, "/get", token, "application/json", `{"id": "a"}`)
+	sp.expect(http.StatusBadRequest, http.MethodPost, "/get", token, "application/json", `{"id": "missing"}`)
+	sp.expect(http.StatusOK, http.MethodGet, "/list", token, "application/json", `{}`)
+	sp.expect(http.StatusOK, http.MethodGet, "/processes", "", "", "")
+
+	// Выражения
+	sp.expect(http.StatusOK, http.MethodPost, "/api/v1/expressions:batch", token, "application/json",
+		`[{"id": "b", "content": "$a*2"}, {"id": "", "content": ""}, {"id": "c", "content": "2+"}]`)
+	sp.expect(http.StatusOK, http.MethodPost, "/api/v1/expressions:batch", token, "application/x-ndjson",
+		"{\"id\": \"d\", \"content\": \"$b-1\"}\n{\"id\": \"e\", \"content\": \"min(1, 2)\"}\n")
+	sp.expect(http.StatusBadRequest, http.MethodPost, "/api/v1/expressions:batch", token, "application/json", `[]`)
+	sp.expect(http.StatusUnauthorized, http.MethodPost, "/api/v1/expressions:batch", "invalid", "application/json", `[]`)
+	sp.waitDone(token, "d")
+
+	sp.expect(http.StatusOK, http.MethodGet, "/expressions/d", token, "", "")
+	sp.expect(http.StatusNotFound, http.MethodGet, "/expressions/missing", token, "", "")
+	sp.expect(http.StatusOK, http.MethodGet, "/expressions/d/trace", token, "", "")
+	sp.expect(http.StatusNotFound, http.MethodGet, "/expressions/missing/trace", token, "", "")
+	sp.expect(http.StatusOK, http.MethodGet, "/api/v1/expressions?status=done&sort=finished&order=desc&limit=2", token, "", "")
+	sp.expect(http.StatusBadRequest, http.MethodGet, "/api/v1/expressions?sort=name&limit=0", token, "", "")
+	sp.expect(http.StatusOK, http.MethodGet, "/api/v1/expressions/d/events", token, "", "")
+	sp.expect(http.StatusNotFound, http.MethodGet, "/api/v1/expressions/missing/events", token, "", "")
+
+	// Отмена выражения, которое вычисляется достаточно долго, чтобы застать его незавершённым
+	sp.expect(http.StatusOK, http.MethodPatch, "/math", "", "application/json",
+		`{"username": "name", "token": "`+token+`", "addition": "1m"}`)
+	sp.expect(http.StatusOK, http.MethodPost, "/api/v1/expressions:batch", token, "application/json",
+		`[{"id": "slow", "content": "1+1"}, {"id": "after", "content": "$slow*2"}]`)
+	sp.expect(http.StatusOK, http.MethodPost, "/api/v1/expressions/slow/cancel", token, "", "")
+	sp.expect(http.StatusConflict, http.MethodPost, "/api/v1/expressions/slow/cancel", token, "", "")
+	sp.expect(http.StatusNotFound, http.MethodPost, "/api/v1/expressions/missing/cancel", token, "", "")
+	sp.waitDone(token, "after")
+
+	// Экспорт и импорт
+	for _, format := range []string{"json", "ndjson", "csv"} {
+		sp.expect(http.StatusOK, http.MethodGet, "/api/v1/expressions/export?format="+format, token, "", "")
+	}
+	sp.expect(http.StatusBadRequest, http.MethodGet, "/api/v1/expressions/export?format=xml", token, "", "")
+	sp.expect(http.StatusOK, http.MethodPost, "/api/v1/expressions/import?format=ndjson", token, "",
+		"{\"id\": \"imported\", \"expression\": \"2*3\", \"status\": \"done\", \"result\": 6}\n{\"id\": \"a\", \"expression\": \"1\"}\n")
+	sp.expect(http.StatusBadRequest, http.MethodPost, "/api/v1/expressions/import", token, "application/json", `[]`)
+
+	// Метрики, после того как сценарий их заполнил
+	sp.expect(http.StatusOK, http.MethodGet, "/metrics", "", "", "")
+
+	// Каждая описанная операция должна быть проверена
+	for path, item := range sp.doc["paths"].(object) {
+		for _, method := range methods {
+			if op, ok := item.(object)[method].(object); ok && !sp.exercised[op["operationId"].(string)] {
+				t.Errorf("%s %s is not exercised by the test", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
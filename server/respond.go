@@ -0,0 +1,44 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// Коды ошибок в поле "code" JSON-ответов с ошибкой
+const (
+	codeInvalidJSON      = "invalid_json"
+	codeValidationFailed = "validation_failed"
+	codeUnauthorized     = "unauthorized"
+	codeNotFound         = "not_found"
+	codeConflict         = "conflict"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeInternal         = "internal_error"
+)
+
+// ErrorResponse тело любого JSON-ответа с ошибкой
+type ErrorResponse struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// WriteJSON записывает значение как JSON-тело с заданным кодом статуса
+func WriteJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		slog.Error("Failed to write the JSON response", "error", err)
+	}
+}
+
+// WriteError записывает JSON-ошибку с необязательными сообщениями об ошибках отдельных полей
+func WriteError(w http.ResponseWriter, status int, code, message string, fields map[string]string) {
+	WriteJSON(w, status, ErrorResponse{
+		Code:    code,
+		Message: message,
+		Fields:  fields,
+	})
+}
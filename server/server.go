@@ -3,69 +3,111 @@ package server
 import (
 	"Distributed-arithmetic-expression-evaluator-version-2.0/calculator"
 	"Distributed-arithmetic-expression-evaluator-version-2.0/client"
-	"Distributed-arithmetic-expression-evaluator-version-2.0/data"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/config"
 	"Distributed-arithmetic-expression-evaluator-version-2.0/database"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/expressions"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/logging"
 	"Distributed-arithmetic-expression-evaluator-version-2.0/rest"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/tracing"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"maps"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"slices"
 	"strings"
+	"syscall"
+	"time"
 )
 
-func ArithmeticsHandler(w http.ResponseWriter, r *http.Request) {
+// prepareContent удаляет из выражения пробелы и выбирает значения используемых в нём переменных.
+// Разовые значения важнее сохранённых переменных.
+func prepareContent(content string, variables, bindings map[string]float64) (string, map[string]float64, error) {
+	var values = maps.Clone(variables)
+	if values == nil {
+		values = map[string]float64{}
+	}
+	maps.Copy(values, bindings)
+
+	prepared, err := calculator.PreparingExpression(content, values)
+	if err != nil {
+		return "", nil, err
+	}
+
+	used, err := calculator.Bindings(prepared, values)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return prepared, used, nil
+}
+
+// ArithmeticsHandler добавляет выражение и отвечает текстовым сообщением.
+// Ошибки возвращаются в JSON: ссылки на несуществующие выражения и циклические ссылки
+// отклоняются с кодом 400, а занятый ID - с кодом 409.
+func (s *Server) ArithmeticsHandler(w http.ResponseWriter, r *http.Request) {
 	defer Close(r)
 	if r.Method != http.MethodPost {
-		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		WriteError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Only POST method is allowed", nil)
 		return
 	}
 
 	var expr ClientExpression
 	if err := json.NewDecoder(r.Body).Decode(&expr); err != nil {
-		http.Error(w, "Invalid JSON data: "+err.Error(), http.StatusBadRequest)
+		WriteError(w, http.StatusBadRequest, codeInvalidJSON, "Invalid JSON data: "+err.Error(), nil)
 		return
 	}
+	expr.Username = Username(r)
 
 	if expr.Username == "" || expr.ID == "" || expr.Content == "" {
-		http.Error(w, "Username, ID, and content must not be empty", http.StatusBadRequest)
+		WriteError(w, http.StatusBadRequest, codeValidationFailed, "Username, ID, and content must not be empty", nil)
 		return
 	}
 
-	WebClients.Mu.Lock()
-	webClient, exists := WebClients.Names[expr.Username]
-	WebClients.Mu.Unlock()
-
+	webClient, exists := s.clients.Get(expr.Username)
 	if !exists {
-		http.Error(w, "User not found", http.StatusNotFound)
+		WriteError(w, http.StatusNotFound, codeNotFound, "User not found", nil)
 		return
 	}
 
-	preparedContent, err := calculator.PreparingExpression(expr.Content)
+	variables, err := s.store.GetVariables(expr.Username)
 	if err != nil {
-		http.Error(w, "Error preparing expression: "+err.Error(), http.StatusBadRequest)
+		WriteError(w, http.StatusInternalServerError, codeInternal, "Error reading variables: "+err.Error(), nil)
 		return
 	}
 
-	var ex *rest.Expression
-	if ex, err = webClient.Expressions.AddExpression(expr.ID, preparedContent); err != nil {
-		http.Error(w, "Error adding expression: "+err.Error(), http.StatusInternalServerError)
+	preparedContent, bindings, err := prepareContent(expr.Content, variables, expr.Bindings)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, codeValidationFailed, "Error preparing expression: "+err.Error(),
+			map[string]string{"content": err.Error()})
 		return
 	}
 
-	if err = DB.AddExpression(ex, expr.ID, expr.Username); err != nil {
-		http.Error(w, "Error adding expression: "+err.Error(), http.StatusInternalServerError)
+	_, err = webClient.Expressions.AddExpression(r.Context(), expr.ID, preparedContent, bindings)
+	switch {
+	case errors.Is(err, expressions.ErrDuplicateID):
+		WriteError(w, http.StatusConflict, codeConflict, "Error adding expression: "+err.Error(), map[string]string{"id": err.Error()})
+		return
+	case errors.Is(err, expressions.ErrUnknownReference), errors.Is(err, expressions.ErrCircularReference):
+		WriteError(w, http.StatusBadRequest, codeValidationFailed, "Error adding expression: "+err.Error(), map[string]string{"content": err.Error()})
+		return
+	case err != nil:
+		WriteError(w, http.StatusInternalServerError, codeInternal, "Error adding expression: "+err.Error(), nil)
 		return
 	}
 
 	_, err = fmt.Fprint(w, "Expression added successfully")
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		s.logger.ErrorContext(r.Context(), "Failed to write the response", "error", err)
 	}
-	w.WriteHeader(http.StatusOK)
 }
 
-func ListProcessHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) ListProcessHandler(w http.ResponseWriter, r *http.Request) {
 	defer Close(r)
 	var (
 		err    error
@@ -75,15 +117,16 @@ func ListProcessHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid JSON data: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	clExpr.Username = Username(r)
 
 	if clExpr.Username == "" {
 		w.WriteHeader(400)
 		return
 	}
 
-	WebClients.Mu.Lock()
-	webClient := WebClients.Names[clExpr.Username]
-	WebClients.Mu.Unlock()
+	s.clients.Mu.Lock()
+	webClient := s.clients.Names[clExpr.Username]
+	s.clients.Mu.Unlock()
 	if webClient == nil {
 		w.WriteHeader(400)
 		return
@@ -96,7 +139,7 @@ func ListProcessHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = fmt.Fprint(w, "Format: ID - state - expression - creation date - approximate calculation time\n")
+	_, err = fmt.Fprint(w, "Format: ID - state - expression - creation date - best case calculation time - current ETA\n")
 
 	if err != nil {
 		w.WriteHeader(500)
@@ -112,8 +155,14 @@ func ListProcessHandler(w http.ResponseWriter, r *http.Request) {
 
 	var values = webClient.Expressions.GetExpressions()
 
-	for id, expr := range values {
-		formatExpression := FormatExpression(id, expr)
+	var IDs = rest.MapGetKeys(values)
+	slices.SortFunc(IDs, func(a, b string) int {
+		return values[a].Created.Compare(values[b].Created)
+	})
+
+	for _, id := range IDs {
+		eta, _ := webClient.Expressions.ETA(id)
+		formatExpression := FormatExpression(id, values[id], eta)
 
 		_, err = fmt.Fprint(w, strings.Join(formatExpression, " - ")+"\n")
 
@@ -124,160 +173,248 @@ func ListProcessHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func MathOperationsHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) ProcessesHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		var _, err = fmt.Fprintf(w, "Math operations:\n+ : %s\n- : %s\n* : %s\n/ : %s", calculator.ArithmeticExecTime[43], calculator.ArithmeticExecTime[45], calculator.ArithmeticExecTime[42], calculator.ArithmeticExecTime[47])
-
-		if err != nil {
-			w.WriteHeader(500)
-			return
-		}
-
-	} else if r.Method == http.MethodPost {
-		// Обработка POST запроса с обновленными значениями операций
-		var err = r.ParseForm()
+		var _, err = fmt.Fprint(w, "Processes:\n\n")
 
 		if err != nil {
 			w.WriteHeader(500)
 			return
 		}
 
-		addition := r.Form.Get("addition")
-		subtraction := r.Form.Get("subtraction")
-		multiplication := r.Form.Get("multiplication")
-		division := r.Form.Get("division")
+		for i, elem := range s.scheduler.Processes() {
+			_, err = fmt.Fprintf(w, "%d - %s\n", i, elem)
 
-		var operations = make([]*calculator.Operation, 0, 4)
-		var operation *calculator.Operation
-
-		if addition != "" {
-			operation, err = calculator.FormatOperation(43, addition)
 			if err != nil {
-				w.WriteHeader(400)
+				w.WriteHeader(500)
 				return
 			}
-
-			operations = append(operations, operation)
 		}
 
-		if subtraction != "" {
-			operation, err = calculator.FormatOperation(45, subtraction)
-
-			if err != nil {
-				w.WriteHeader(400)
-				return
-			}
+	} else {
+		w.WriteHeader(400)
+		return
+	}
+}
 
-			operations = append(operations, operation)
-		}
+// route маршрут сервера. Шаблоны без метода принимают любой метод.
+type route struct {
+	pattern string
+	handler http.Handler
+}
 
-		if multiplication != "" {
-			operation, err = calculator.FormatOperation(42, multiplication)
+// routes перечисляет все маршруты сервера, каждый из них описан в OpenAPI
+func (s *Server) routes() []route {
+	return []route{
+		{"/get", s.AuthorizationMiddleware(s.ResultHandler)},
+		{"/list", s.AuthorizationMiddleware(s.ListProcessHandler)},
+		{"/expression", s.AuthorizationMiddleware(s.ArithmeticsHandler)},
+		{"/math", http.HandlerFunc(s.MathOperationsHandler)},
+		{"/math/audit", s.AuthorizationMiddleware(s.MathAuditHandler)},
+		{"/variables", s.AuthorizationMiddleware(s.VariablesHandler)},
+		{"GET /expressions/{id}", s.AuthorizationMiddleware(s.ExpressionHandler)},
+		{"GET /expressions/{id}/trace", s.AuthorizationMiddleware(s.TraceHandler)},
+		{"GET /api/v1/expressions", s.AuthorizationMiddleware(s.ListExpressionsHandler)},
+		{"GET /api/v1/expressions/{id}/events", s.AuthorizationMiddleware(s.EventsHandler)},
+		{"POST /api/v1/expressions/{id}/cancel", s.AuthorizationMiddleware(s.CancelHandler)},
+		{"POST /api/v1/expressions:batch", s.AuthorizationMiddleware(s.BatchHandler)},
+		{"GET /api/v1/expressions/export", s.AuthorizationMiddleware(s.ExportHandler)},
+		{"POST /api/v1/expressions/import", s.AuthorizationMiddleware(s.ImportHandler)},
+		{"/processes", http.HandlerFunc(s.ProcessesHandler)},
+		{"/login", http.HandlerFunc(s.LoginHandler)},
+		{"/register", http.HandlerFunc(s.RegisterHandler)},
+		{"GET /openapi.json", http.HandlerFunc(s.OpenAPIHandler)},
+		{"GET /docs", http.HandlerFunc(s.DocsHandler)},
+		{"GET /metrics", http.HandlerFunc(s.MetricsHandler)},
+		{"GET /healthz", http.HandlerFunc(s.HealthHandler)},
+		{"GET /readyz", http.HandlerFunc(s.ReadyHandler)},
+		{"GET /version", http.HandlerFunc(s.VersionHandler)},
+	}
+}
 
-			if err != nil {
-				w.WriteHeader(400)
-				return
-			}
+// Handler возвращает мультиплексор, обслуживающий все маршруты сервера
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, route := range s.routes() {
+		mux.Handle(route.pattern, s.observe(route.pattern, route.handler))
+	}
 
-			operations = append(operations, operation)
-		}
+	return RequestIDMiddleware(mux)
+}
 
-		if division != "" {
-			operation, err = calculator.FormatOperation(47, division)
+// Run обслуживает HTTP по адресу, пока контекст не завершён, а затем плавно останавливается, как Serve.
+func (s *Server) Run(ctx context.Context, addr string) error {
+	var listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
 
-			if err != nil {
-				w.WriteHeader(400)
-				return
-			}
+	return s.Serve(ctx, listener)
+}
 
-			operations = append(operations, operation)
-		}
+// Serve обслуживает HTTP на listener, пока контекст не завершён, а затем плавно останавливается:
+// перестаёт начинать вычисления и проходить /readyz, продолжает обслуживать запросы в течение задержки
+// остановки, чтобы балансировщики вывели сервер из ротации, затем перестаёт принимать соединения, ждёт
+// не дольше периода завершения текущие запросы и вычисления и сохраняет статусы всех выражений.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	var (
+		httpServer = &http.Server{Handler: s.Handler(), ErrorLog: slog.NewLogLogger(s.logger.Handler(), slog.LevelError)}
+		served     = make(chan error, 1)
+	)
+	go func() {
+		served <- httpServer.Serve(listener)
+	}()
 
-		calculator.MathOperation(operations...)
-		err = data.UploadArithmetic(calculator.ArithmeticExecTime, "data/arithmetic.csv")
+	s.logger.Info("Server started", "addr", listener.Addr().String())
 
-		if err != nil {
-			w.WriteHeader(500)
-			return
-		}
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
 
-		// Вывод обновленных значений операций
-		_, err = fmt.Fprintf(w, "Operations updated:\n+ : %s\n- : %s\n* : %s\n/ : %s", calculator.ArithmeticExecTime[43], calculator.ArithmeticExecTime[45], calculator.ArithmeticExecTime[42], calculator.ArithmeticExecTime[47])
+	// Новые вычисления не начинаются и /readyz не проходит, пока соединения ещё принимаются
+	s.scheduler.Stop()
+	if s.delay > 0 {
+		s.logger.Info("Not ready, serving until the shutdown delay ends", "shutdown_delay", s.delay)
+		time.Sleep(s.delay)
+	}
 
-		if err != nil {
-			w.WriteHeader(500)
-			return
-		}
+	s.logger.Info("Shutting down", "drain_timeout", s.drain)
+	drainCtx, cancel := context.WithTimeout(context.Background(), s.drain)
+	defer cancel()
 
-		w.WriteHeader(200)
-	} else {
-		w.WriteHeader(400)
+	var err = httpServer.Shutdown(drainCtx)
+	if err != nil {
+		s.logger.Error("Failed to finish in-flight requests", "error", err)
 	}
+
+	return errors.Join(err, s.Shutdown(drainCtx))
 }
 
-func ProcessesHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		var _, err = fmt.Fprint(w, "Processes:\n\n")
+// Shutdown перестаёт начинать новые вычисления и ждёт текущие, пока контекст не завершён.
+// Не завершённые к этому времени выражения остаются незавершёнными в хранилище и вычисляются после перезапуска.
+// Статусы всех выражений сохраняются в любом случае.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.scheduler.Stop()
 
-		if err != nil {
-			w.WriteHeader(500)
-			return
-		}
+	var err = s.scheduler.Wait(ctx)
+	if err != nil {
+		s.logger.Warn("Calculations still running after the drain period are left for the next start", "error", err)
+	}
 
-		for i, elem := range calculator.ComputingPower {
-			_, err = fmt.Fprintf(w, "%d - %s\n", i, string(elem))
+	return errors.Join(err, s.Flush())
+}
 
-			if err != nil {
-				w.WriteHeader(500)
-				return
-			}
-		}
+// clientList возвращает клиентов всех пользователей
+func (s *Server) clientList() []*client.Client {
+	s.clients.Mu.Lock()
+	defer s.clients.Mu.Unlock()
 
-	} else {
-		w.WriteHeader(400)
-		return
+	var clients = make([]*client.Client, 0, len(s.clients.Names))
+	for _, webClient := range s.clients.Names {
+		clients = append(clients, webClient)
 	}
-}
 
-func MuxHandler() *http.ServeMux {
-	mux := http.NewServeMux()
+	return clients
+}
 
-	mux.Handle("/get", AuthorizationMiddleware(ResultHandler))
-	mux.Handle("/list", AuthorizationMiddleware(ListProcessHandler))
-	mux.Handle("/expression", AuthorizationMiddleware(ArithmeticsHandler))
-	mux.HandleFunc("/math", MathOperationsHandler)
-	mux.HandleFunc("/processes", ProcessesHandler)
-	mux.HandleFunc("/login", LoginHandler)
-	mux.HandleFunc("/register", RegisterHandler)
+// Flush сохраняет текущий статус каждого выражения в хранилище
+func (s *Server) Flush() error {
+	var errs []error
+	for _, webClient := range s.clientList() {
+		if err := webClient.Expressions.Flush(); err != nil {
+			errs = append(errs, fmt.Errorf("user %s: %w", webClient.Name(), err))
+		}
+	}
 
-	return mux
+	return errors.Join(errs...)
 }
 
-func StartHandler(port string) {
-	var err error
-	DB, err = database.NewDB("database/data.db")
+// StartHandler открывает базу данных из конфигурации и обслуживает запросы до SIGINT или SIGTERM.
+// Логгер конфигурации становится логгером по умолчанию. Ошибки обслуживания, закрытия базы данных
+// и экспорта последних span возвращаются вместе, чтобы неудачный запуск завершался с ошибкой.
+func StartHandler(cfg *config.Config) error {
+	logger, err := logging.New(os.Stderr, cfg.Log.Level, cfg.Log.Format)
 	if err != nil {
-		log.Fatal("Failed to initialize database: ", err)
-	}
-	if DB == nil {
-		log.Fatal("Database is nil")
+		return err
 	}
+	slog.SetDefault(logger)
 
-	_, err = database.NewExpressionsDB("database/data.db")
+	store, err := database.NewDB(cfg.Database.Path)
 	if err != nil {
-		log.Fatal("Failed to initialize database: ", err)
+		return fmt.Errorf("failed to initialize database: %w", err)
 	}
 
-	WebClients, err = client.NewClients(DB)
+	tracer, err := newTracer(cfg.Tracing)
 	if err != nil {
-		log.Fatal("Failed to create clients: ", err)
+		_ = store.Close()
+		return fmt.Errorf("failed to set up tracing: %w", err)
 	}
-	fmt.Println(WebClients)
 
-	var mux = MuxHandler()
-	log.Printf("Server start listening on http://localhost:%s/", port)
-	err = http.ListenAndServe(":"+port, mux)
+	var timings = calculator.NewTimings()
+	timings.Set(cfg.Operations()...)
+
+	s, err := New(Options{
+		Store:         store,
+		Timings:       timings,
+		Workers:       cfg.Scheduler.Workers,
+		Logger:        logger,
+		Tracer:        tracer,
+		TimingsFile:   cfg.Database.TimingsFile,
+		ShutdownDelay: time.Duration(cfg.Server.ShutdownDelay),
+		DrainTimeout:  time.Duration(cfg.Server.DrainTimeout),
+		TokenLifetime: time.Duration(cfg.Auth.TokenLifetime),
+		BatchSize:     cfg.Limits.BatchSize,
+		PageSize:      cfg.Limits.PageSize,
+	})
 	if err != nil {
-		log.Fatal(err)
+		_ = tracer.Shutdown(context.Background())
+		_ = store.Close()
+		return fmt.Errorf("failed to create clients: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var runErr = s.Run(ctx, cfg.Server.Addr)
+	if runErr != nil {
+		logger.Error("Server stopped with an error", "error", runErr)
+	}
+
+	var closeErr = store.Close()
+	if closeErr != nil {
+		logger.Error("Failed to close the database", "error", closeErr)
+	}
+
+	// Span последних вычислений ещё находятся в буфере экспортёра
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.DrainTimeout))
+	defer cancel()
+	var tracerErr = tracer.Shutdown(shutdownCtx)
+	if tracerErr != nil {
+		logger.Error("Failed to export the remaining spans", "error", tracerErr)
+	}
+
+	return errors.Join(runErr, closeErr, tracerErr)
+}
+
+// serviceName отличает сервер от других сервисов, отправляющих данные коллектору
+const serviceName = "calc"
+
+// newTracer возвращает трассировщик, экспортирующий span так, как задано в конфигурации
+func newTracer(cfg config.Tracing) (*tracing.Tracer, error) {
+	switch cfg.Exporter {
+	case tracing.ExporterStdout:
+		return tracing.NewTracer(tracing.NewWriterExporter(os.Stdout)), nil
+	case tracing.ExporterFile:
+		var exporter, err = tracing.OpenFileExporter(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		return tracing.NewTracer(exporter), nil
+	case tracing.ExporterOTLP:
+		return tracing.NewTracer(tracing.NewOTLPExporter(cfg.OTLPEndpoint, serviceName, nil)), nil
+	default:
+		return tracing.NewTracer(), nil
 	}
 }
@@ -0,0 +1,832 @@
+package server
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/calculator"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/config"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/database"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/logging"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/tracing"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// newTestServer запускает отдельный сервер с хранилищем в памяти
+func newTestServer(t *testing.T, timings *calculator.Timings) *httptest.Server {
+	s, err := New(Options{Store: database.NewMemory(), Timings: timings})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ts = httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+// do отправляет запрос и возвращает код статуса и тело ответа
+func do(t *testing.T, ts *httptest.Server, method, path, token, body string) (int, string) {
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.StatusCode, string(content)
+}
+
+// signUp регистрирует пользователя и возвращает его токен
+func signUp(t *testing.T, ts *httptest.Server, username string) string {
+	var credentials = `{"username": "` + username + `", "password": "password"}`
+	if code, body := do(t, ts, http.MethodPost, "/register", "", credentials); code != http.StatusOK {
+		t.Fatalf("register: %d %s", code, body)
+	}
+
+	code, token := do(t, ts, http.MethodGet, "/login", "", credentials)
+	if code != http.StatusOK {
+		t.Fatalf("login: %d %s", code, token)
+	}
+
+	return token
+}
+
+func TestServer_Login(t *testing.T) {
+	var ts = newTestServer(t, calculator.NewUniformTimings(0))
+	signUp(t, ts, "name")
+
+	// Токен не выдаётся без верного пароля
+	for _, credentials := range []string{
+		`{"username": "name", "password": "wrong"}`,
+		`{"username": "name", "password": "passwor"}`,
+		`{"username": "name", "password": "password1"}`,
+		`{"username": "other", "password": "password"}`,
+	} {
+		var code, body = do(t, ts, http.MethodGet, "/login", "", credentials)
+		if code != http.StatusUnauthorized || strings.Count(body, ".") == 2 {
+			t.Errorf("%s: got %d %s, want 401 without a token", credentials, code, body)
+		}
+	}
+
+	var code, token = do(t, ts, http.MethodGet, "/login", "", `{"username": "name", "password": "password"}`)
+	if code != http.StatusOK {
+		t.Fatalf("%d %s", code, token)
+	}
+	if code, body := do(t, ts, http.MethodGet, "/api/v1/expressions", token, ""); code != http.StatusOK {
+		t.Errorf("the token is not accepted: %d %s", code, body)
+	}
+}
+
+func TestServer_Expression(t *testing.T) {
+	var (
+		ts    = newTestServer(t, calculator.NewUniformTimings(0))
+		token = signUp(t, ts, "name")
+	)
+
+	if code, body := do(t, ts, http.MethodPost, "/expression", token, `{"id": "a", "content": "2 + 2 * 2"}`); code != http.StatusOK {
+		t.Fatalf("%d %s", code, body)
+	}
+	if code, body := do(t, ts, http.MethodPost, "/expression", token, `{"id": "b", "content": "$a * 10"}`); code != http.StatusOK {
+		t.Fatalf("%d %s", code, body)
+	}
+
+	var details ExpressionDetails
+	for deadline := time.Now().Add(5 * time.Second); details.Status != "done"; {
+		if time.Now().After(deadline) {
+			t.Fatalf("expression b is still %s", details.Status)
+		}
+
+		code, body := do(t, ts, http.MethodGet, "/expressions/b", token, "")
+		if code != http.StatusOK {
+			t.Fatalf("%d %s", code, body)
+		}
+		if err := json.Unmarshal([]byte(body), &details); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if details.Result == nil || *details.Result != 60 {
+		t.Errorf("got result %v, want 60", details.Result)
+	}
+	if details.BestCase != "0s" || details.ETA != "0s" || details.Timeline == nil || details.Timeline.Finished == nil {
+		t.Fatalf("got best case %q, ETA %q and timeline %+v", details.BestCase, details.ETA, details.Timeline)
+	}
+	if operations := details.Timeline.Operations; len(operations) != 1 || operations[0].Operator != "*" ||
+		operations[0].Operands[0] != 6 || operations[0].Result == nil || *operations[0].Result != 60 {
+		t.Errorf("got operations %+v", operations)
+	}
+}
+
+func TestServer_ExpressionQueued(t *testing.T) {
+	var (
+		timings      = calculator.NewUniformTimings(0)
+		operation, _ = calculator.FormatOperation("+", "1s")
+		clock        = calculator.NewFakeClock(time.Now())
+	)
+	timings.Set(operation)
+
+	// Единственный исполнитель занят выражением a, поэтому b ждёт в очереди
+	var scheduler = calculator.NewScheduler(timings, 1)
+	scheduler.SetClock(clock)
+	s, err := New(Options{Store: database.NewMemory(), Scheduler: scheduler})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ts = httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	t.Cleanup(func() {
+		for clock.Sleepers() != 0 {
+			clock.AdvanceNext()
+		}
+	})
+
+	var token = signUp(t, ts, "name")
+	if code, body := do(t, ts, http.MethodPost, "/expression", token, `{"id": "a", "content": "1 + 1"}`); code != http.StatusOK {
+		t.Fatalf("%d %s", code, body)
+	}
+	clock.BlockUntil(1)
+	if code, body := do(t, ts, http.MethodPost, "/expression", token, `{"id": "b", "content": "2 + 2"}`); code != http.StatusOK {
+		t.Fatalf("%d %s", code, body)
+	}
+
+	code, body := do(t, ts, http.MethodGet, "/expressions/b", token, "")
+	if code != http.StatusOK {
+		t.Fatalf("%d %s", code, body)
+	}
+	var details ExpressionDetails
+	if err = json.Unmarshal([]byte(body), &details); err != nil {
+		t.Fatal(err)
+	}
+
+	if details.Status != "computing" || details.BestCase != "1s" || details.ETA != "2s" {
+		t.Errorf("got status %q, best case %q and ETA %q, want computing, 1s and 2s", details.Status, details.BestCase, details.ETA)
+	}
+}
+
+func TestServer_ExpressionErrors(t *testing.T) {
+	var (
+		ts    = newTestServer(t, calculator.NewUniformTimings(0))
+		token = signUp(t, ts, "name")
+	)
+
+	if code, body := do(t, ts, http.MethodPost, "/expression", token, `{"id": "a", "content": "1/0"}`); code != http.StatusOK {
+		t.Fatalf("%d %s", code, body)
+	}
+
+	var tests = []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{`{"id": "a", "content": "2+2"}`, http.StatusConflict, codeConflict},
+		{`{"id": "b", "content": "$missing+1"}`, http.StatusBadRequest, codeValidationFailed},
+		{`{"id": "c", "content": "$c+1"}`, http.StatusBadRequest, codeValidationFailed},
+		{`{"id": "d", "content": "2+"}`, http.StatusBadRequest, codeValidationFailed},
+		{`{"id": "e"`, http.StatusBadRequest, codeInvalidJSON},
+	}
+	for _, test := range tests {
+		var code, body = do(t, ts, http.MethodPost, "/expression", token, test.body)
+
+		var response ErrorResponse
+		if err := json.Unmarshal([]byte(body), &response); err != nil || code != test.status || response.Code != test.code {
+			t.Errorf("%s: got %d %s, want %d %s", test.body, code, body, test.status, test.code)
+		}
+	}
+
+	// Ошибка выражения передаётся выражениям, которые на него ссылаются
+	if code, body := do(t, ts, http.MethodPost, "/expression", token, `{"id": "f", "content": "$a+1"}`); code != http.StatusOK {
+		t.Fatalf("%d %s", code, body)
+	}
+
+	var details ExpressionDetails
+	for deadline := time.Now().Add(5 * time.Second); details.Status != "failed"; {
+		if time.Now().After(deadline) {
+			t.Fatalf("expression f is still %s", details.Status)
+		}
+
+		code, body := do(t, ts, http.MethodGet, "/expressions/f", token, "")
+		if code != http.StatusOK {
+			t.Fatalf("%d %s", code, body)
+		}
+		if err := json.Unmarshal([]byte(body), &details); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if details.Error != "Expression $a failed: Division by zero" {
+		t.Errorf("got error %q", details.Error)
+	}
+}
+
+// failingAudit хранилище, которое не может записать изменения времени операций
+type failingAudit struct {
+	*database.Memory
+}
+
+func (failingAudit) AddTimingChanges(...*database.TimingChange) error {
+	return errors.New("disk is full")
+}
+
+func TestServer_TimingsNotRecorded(t *testing.T) {
+	s, err := New(Options{Store: failingAudit{database.NewMemory()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ts = httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	var (
+		token  = signUp(t, ts, "name")
+		before = s.timings.Get("+")
+	)
+	if code, body := do(t, ts, http.MethodPatch, "/math", "", `{"username": "name", "token": "`+token+`", "addition": "1ms"}`); code != http.StatusInternalServerError {
+		t.Fatalf("%d %s", code, body)
+	}
+
+	// Изменение, не записанное в журнал, не применяется
+	if after := s.timings.Get("+"); after != before {
+		t.Errorf("addition takes %s, want %s", after, before)
+	}
+}
+
+func TestServer_Batch(t *testing.T) {
+	s, err := New(Options{Store: database.NewMemory(), Timings: calculator.NewUniformTimings(0), BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ts = httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	var token = signUp(t, ts, "name")
+
+	var tests = []struct {
+		name     string
+		body     string
+		status   int
+		accepted int
+	}{
+		{"array", `[{"id": "a", "content": "2+2"}, {"id": "b", "content": "$a*2"}]`, http.StatusOK, 2},
+		{"ndjson", "{\"id\": \"c\", \"content\": \"$b-1\"}\n{\"id\": \"\", \"content\": \"1\"}\n", http.StatusOK, 1},
+		{"array over the limit", `[{"id": "d", "content": "1"}, {"id": "e", "content": "1"}, {"id": "f", "content": "1"}]`, http.StatusBadRequest, 0},
+		{"ndjson over the limit", "{\"id\": \"d\", \"content\": \"1\"}\n{\"id\": \"e\", \"content\": \"1\"}\n{\"id\": \"f\", \"content\": \"1\"}\n", http.StatusBadRequest, 0},
+		{"unclosed array", `[{"id": "d", "content": "1"}`, http.StatusBadRequest, 0},
+		{"too large", `[{"id": "d", "content": "` + strings.Repeat("1", 3*MaxBatchItemBytes) + `"}]`, http.StatusRequestEntityTooLarge, 0},
+	}
+	for _, test := range tests {
+		var code, body = do(t, ts, http.MethodPost, "/api/v1/expressions:batch", token, test.body)
+		if code != test.status {
+			t.Errorf("%s: got %d %.200s, want %d", test.name, code, body, test.status)
+			continue
+		}
+
+		var response BatchResponse
+		if err = json.Unmarshal([]byte(body), &response); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if response.Accepted != test.accepted {
+			t.Errorf("%s: %d accepted, want %d", test.name, response.Accepted, test.accepted)
+		}
+	}
+}
+
+func TestReadBatch_StopsAfterLimit(t *testing.T) {
+	// Тело не читается дальше элемента, превысившего размер пакета
+	var body = io.MultiReader(
+		strings.NewReader(`[{"id": "a"}, {"id": "b"}, {"id": "c"},`),
+		iotest.ErrReader(errors.New("read past the limit")),
+	)
+
+	items, err := readBatch(body, 2)
+	if err != nil || len(items) != 3 {
+		t.Errorf("got %d items and %v, want 3 items", len(items), err)
+	}
+}
+
+func TestServer_ImportLimits(t *testing.T) {
+	s, err := New(Options{Store: database.NewMemory(), Timings: calculator.NewUniformTimings(0), BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ts = httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	var token = signUp(t, ts, "name")
+
+	var tests = []struct {
+		name   string
+		file   string
+		status int
+	}{
+		{"over the limit", "id,expression\na,1\nb,2\nc,3\n", http.StatusBadRequest},
+		{"too large", "id,expression\na," + strings.Repeat("1", 3*MaxBatchItemBytes) + "\n", http.StatusRequestEntityTooLarge},
+		{"within the limit", "id,expression\na,1\nb,2\n", http.StatusOK},
+	}
+	for _, test := range tests {
+		if code, body := do(t, ts, http.MethodPost, "/api/v1/expressions/import?format=csv", token, test.file); code != test.status {
+			t.Errorf("%s: got %d %.200s, want %d", test.name, code, body, test.status)
+		}
+	}
+
+	// Отклонённые файлы не добавили ни одного выражения
+	code, body := do(t, ts, http.MethodGet, "/api/v1/expressions", token, "")
+	var page ExpressionPage
+	if err = json.Unmarshal([]byte(body), &page); err != nil || code != http.StatusOK || len(page.Items) != 2 {
+		t.Errorf("got %d %s", code, body)
+	}
+}
+
+func TestServer_Isolation(t *testing.T) {
+	var (
+		first  = newTestServer(t, nil)
+		second = newTestServer(t, nil)
+		token  = signUp(t, first, "name")
+	)
+
+	if code, _ := do(t, second, http.MethodGet, "/expressions/a", token, ""); code != http.StatusUnauthorized {
+		t.Errorf("the user of the first server is authorized by the second one: %d", code)
+	}
+
+	var change = `{"username": "name", "token": "` + token + `", "addition": "1ms"}`
+	if code, body := do(t, first, http.MethodPatch, "/math", "", change); code != http.StatusOK {
+		t.Fatalf("%d %s", code, body)
+	}
+
+	var times = func(ts *httptest.Server) map[string]string {
+		var table map[string]string
+		_, body := do(t, ts, http.MethodGet, "/math", "", "")
+		if err := json.Unmarshal([]byte(body), &table); err != nil {
+			t.Fatal(err)
+		}
+		return table
+	}
+
+	if got := times(first)["addition"]; got != "1ms" {
+		t.Errorf("got addition time %s on the first server, want 1ms", got)
+	}
+	if got := times(second)["addition"]; got != "500ms" {
+		t.Errorf("got addition time %s on the second server, want the default 500ms", got)
+	}
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	var tests = []struct {
+		drain      time.Duration
+		wantStatus string
+	}{
+		{time.Second, "done"},
+		{time.Millisecond, "computing"}, // Оставлено до следующего запуска
+	}
+
+	for _, test := range tests {
+		var timings = calculator.NewUniformTimings(0)
+		var operation, _ = calculator.FormatOperation("+", "200ms")
+		timings.Set(operation)
+
+		var store = database.NewMemory()
+		s, err := New(Options{Store: store, Timings: timings})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ts = httptest.NewServer(s.Handler())
+		var token = signUp(t, ts, "name")
+		if code, body := do(t, ts, http.MethodPost, "/expression", token, `{"id": "a", "content": "1 + 1"}`); code != http.StatusOK {
+			t.Fatalf("%d %s", code, body)
+		}
+		ts.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), test.drain)
+		err = s.Shutdown(ctx)
+		cancel()
+
+		if test.wantStatus == "done" && err != nil {
+			t.Errorf("drain %s: %v", test.drain, err)
+		} else if test.wantStatus != "done" && !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("drain %s: got %v, want the deadline to be exceeded", test.drain, err)
+		}
+
+		row, err := store.GetExpression("name", "a")
+		if err != nil {
+			t.Fatal(err)
+		} else if row.Status != test.wantStatus {
+			t.Errorf("drain %s: got status %s, want %s", test.drain, row.Status, test.wantStatus)
+		}
+	}
+}
+
+func TestServer_Metrics(t *testing.T) {
+	var (
+		ts    = newTestServer(t, calculator.NewUniformTimings(0))
+		token = signUp(t, ts, "name")
+	)
+
+	for _, content := range []string{`{"id": "a", "content": "2 + 2 * 2"}`, `{"id": "b", "content": "1 / 0"}`} {
+		if code, body := do(t, ts, http.MethodPost, "/expression", token, content); code != http.StatusOK {
+			t.Fatalf("%d %s", code, body)
+		}
+	}
+
+	var want = []string{
+		`http_requests_total{route="/expression",method="POST",status="200"} 2`,
+		`http_requests_total{route="/register",method="POST",status="200"} 1`,
+		`calc_expressions_submitted_total 2`,
+		`calc_expressions_finished_total{status="done"} 1`,
+		`calc_expressions_finished_total{status="failed"} 1`,
+		`calc_expressions{status="done"} 1`,
+		`calc_operations_total{operation="addition"} 1`,
+		`calc_operations_total{operation="multiplication"} 1`,
+		`calc_operations_total{operation="division"} 1`,
+		`calc_operation_configured_seconds{operation="addition"} 0`,
+		`calc_queue_depth 0`,
+		`calc_db_query_duration_seconds_count{method="CreateUser"} 1`,
+	}
+
+	var body string
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		var code int
+		if code, body = do(t, ts, http.MethodGet, "/metrics", "", ""); code != http.StatusOK {
+			t.Fatalf("%d %s", code, body)
+		}
+		if strings.Contains(body, `calc_expressions_finished_total{status="failed"} 1`) &&
+			strings.Contains(body, `calc_expressions_finished_total{status="done"} 1`) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, line := range want {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("no %s in\n%s", line, body)
+		}
+	}
+}
+
+// lockedBuffer собирает логи, которые одновременно пишут запросы и вычисления
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestServer_Logging(t *testing.T) {
+	var logs lockedBuffer
+	logger, err := logging.New(&logs, "debug", logging.FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(Options{Store: database.NewMemory(), Timings: calculator.NewUniformTimings(0), Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ts = httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	var token = signUp(t, ts, "name")
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/expression", strings.NewReader(`{"id": "a", "content": "1+1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(RequestIDHeader, "given-id")
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get(RequestIDHeader); got != "given-id" {
+		t.Errorf("got request ID %q, want the one sent", got)
+	}
+
+	req.Header.Set(RequestIDHeader, "forged id with spaces")
+	if resp, err = ts.Client().Do(req); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get(RequestIDHeader); len(got) != 16 {
+		t.Errorf("got request ID %q, want a generated one", got)
+	}
+
+	var computed bool
+	for deadline := time.Now().Add(5 * time.Second); !computed && time.Now().Before(deadline); {
+		computed = strings.Contains(logs.String(), `"msg":"Expression computed"`)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var served, operated bool
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]interface{}
+		if err = json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("%v: %s", err, line)
+		}
+
+		switch record["msg"] {
+		case "Request served":
+			if record["route"] == "/expression" && record[logging.RequestIDKey] == "given-id" {
+				served = true
+			}
+		case "Operation executed", "Expression computed":
+			if record["expression"] != "a" || record["user"] != "name" {
+				t.Errorf("computing record without the expression: %s", line)
+			}
+			operated = operated || record["msg"] == "Operation executed"
+		}
+	}
+
+	if !served || !operated || !computed {
+		t.Errorf("request logged %v, operation logged %v, result logged %v:\n%s", served, operated, computed, logs.String())
+	}
+	if strings.Contains(logs.String(), token) || strings.Contains(logs.String(), `"password"`) {
+		t.Errorf("secrets are logged:\n%s", logs.String())
+	}
+}
+
+// readiness возвращает код статуса и проверки /readyz
+func readiness(t *testing.T, ts *httptest.Server) (int, map[string]string) {
+	code, body := do(t, ts, http.MethodGet, "/readyz", "", "")
+
+	var health Health
+	if err := json.Unmarshal([]byte(body), &health); err != nil {
+		t.Fatalf("%v: %s", err, body)
+	}
+
+	return code, health.Checks
+}
+
+func TestServer_Readiness(t *testing.T) {
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(Options{Store: db, Timings: calculator.NewUniformTimings(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ts = httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	if code, checks := readiness(t, ts); code != http.StatusOK {
+		t.Fatalf("got %d %v for a migrated database", code, checks)
+	}
+
+	latest, err := database.LatestVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Migrate(latest - 1); err != nil {
+		t.Fatal(err)
+	}
+	if code, checks := readiness(t, ts); code != http.StatusServiceUnavailable || checks["migrations"] == "ok" {
+		t.Errorf("got %d %v with a pending migration", code, checks)
+	}
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if code, checks := readiness(t, ts); code != http.StatusServiceUnavailable || checks["database"] == "ok" {
+		t.Errorf("got %d %v with a closed database", code, checks)
+	}
+
+	if code, body := do(t, ts, http.MethodGet, "/healthz", "", ""); code != http.StatusOK {
+		t.Errorf("liveness failed with the database: %d %s", code, body)
+	}
+}
+
+func TestServer_ReadinessDrain(t *testing.T) {
+	s, err := New(Options{Store: database.NewMemory(), Timings: calculator.NewUniformTimings(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ts = httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	if code, checks := readiness(t, ts); code != http.StatusOK {
+		t.Fatalf("got %d %v before the shutdown", code, checks)
+	}
+
+	if err = s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if code, checks := readiness(t, ts); code != http.StatusServiceUnavailable || checks["scheduler"] != "shutting down" {
+		t.Errorf("got %d %v while draining", code, checks)
+	}
+}
+
+func TestServer_ShutdownDelay(t *testing.T) {
+	s, err := New(Options{Store: database.NewMemory(), Timings: calculator.NewUniformTimings(0), ShutdownDelay: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		served      = make(chan error, 1)
+		url         = "http://" + listener.Addr().String() + "/readyz"
+	)
+	go func() { served <- s.Serve(ctx, listener) }()
+
+	var ready = func() int {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("the server stopped serving during the shutdown delay: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := ready(); code != http.StatusOK {
+		t.Fatalf("got %d before the shutdown", code)
+	}
+
+	cancel()
+	for deadline := time.Now().Add(200 * time.Millisecond); ; time.Sleep(5 * time.Millisecond) {
+		if ready() == http.StatusServiceUnavailable {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("/readyz does not fail while draining")
+		}
+	}
+
+	if err = <-served; err != nil {
+		t.Fatal(err)
+	}
+	if _, err = http.Get(url); err == nil {
+		t.Error("the server serves after the shutdown")
+	}
+}
+
+func TestServer_Trace(t *testing.T) {
+	var exported lockedBuffer
+	s, err := New(Options{Store: database.NewMemory(), Timings: calculator.NewUniformTimings(0), Tracer: tracing.NewTracer(tracing.NewWriterExporter(&exported))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ts = httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	var token = signUp(t, ts, "name")
+	if code, body := do(t, ts, http.MethodPost, "/expression", token, `{"id": "a", "content": "2+3*4"}`); code != http.StatusOK {
+		t.Fatalf("%d %s", code, body)
+	}
+
+	// Корневой span завершается после сохранения результата
+	var trace Trace
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		var code, body = do(t, ts, http.MethodGet, "/expressions/a/trace", token, "")
+		if code != http.StatusOK {
+			t.Fatalf("%d %s", code, body)
+		}
+		if err = json.Unmarshal([]byte(body), &trace); err != nil {
+			t.Fatal(err)
+		}
+		if len(trace.Spans) != 0 && trace.Spans[0].Name == "expression" || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var (
+		names = map[string]int{}
+		root  = trace.Spans[0]
+	)
+	for _, span := range trace.Spans {
+		names[span.Name]++
+		if span.TraceID != trace.TraceID {
+			t.Errorf("span %s is in trace %s, want %s", span.Name, span.TraceID, trace.TraceID)
+		}
+		if span.Name == "operation" && (span.Attributes["operator"] == nil || len(span.Attributes["operands"].([]interface{})) != 2) {
+			t.Errorf("got operation attributes %v", span.Attributes)
+		}
+	}
+	for name, want := range map[string]int{"expression": 1, "queue": 1, "parse": 1, "compute": 1, "operation": 2, "persist": 2} {
+		if names[name] != want {
+			t.Errorf("got %d %s spans, want %d in %v", names[name], name, want, names)
+		}
+	}
+	if root.Attributes["status"] != "done" || len(root.Links) != 1 {
+		t.Fatalf("got root %+v", root)
+	}
+
+	// Запрос, добавивший выражение, экспортируется в своей трассе
+	if !strings.Contains(exported.String(), `"span_id":"`+root.Links[0].SpanID+`","name":"http.request"`) {
+		t.Errorf("the linked request span is not exported:\n%s", exported.String())
+	}
+
+	if code, body := do(t, ts, http.MethodGet, "/expressions/missing/trace", token, ""); code != http.StatusNotFound {
+		t.Errorf("%d %s", code, body)
+	}
+}
+
+func TestServer_Import(t *testing.T) {
+	var (
+		ts    = newTestServer(t, calculator.NewUniformTimings(0))
+		token = signUp(t, ts, "name")
+	)
+
+	var file = `[{"id": "a", "expression": "0 - 1", "status": "done", "result": -1},
+		{"id": "b", "expression": " 2 +  2 ", "status": "waiting"},
+		{"id": "c", "expression": "2 +", "status": "waiting"}]`
+	code, body := do(t, ts, http.MethodPost, "/api/v1/expressions/import", token, file)
+	if code != http.StatusOK {
+		t.Fatalf("%d %s", code, body)
+	}
+
+	var response BatchResponse
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Accepted != 2 || response.Results[0].Status != "done" || response.Results[2].Status != statusRejected {
+		t.Fatalf("got %+v", response)
+	}
+
+	// Импортированные выражения хранятся без пробелов, как и добавленные
+	for query, ID := range map[string]string{"0-1": "a", "2%2B2": "b"} {
+		code, body = do(t, ts, http.MethodGet, "/api/v1/expressions?q="+query, token, "")
+		if code != http.StatusOK {
+			t.Fatalf("%d %s", code, body)
+		}
+
+		var page ExpressionPage
+		if err := json.Unmarshal([]byte(body), &page); err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Items) != 1 || page.Items[0].ID != ID {
+			t.Errorf("q=%s: got %+v, want %s", query, page.Items, ID)
+		}
+	}
+
+	// Результат -1 сохраняется и не вычисляется заново
+	var details ExpressionDetails
+	code, body = do(t, ts, http.MethodGet, "/expressions/a", token, "")
+	if err := json.Unmarshal([]byte(body), &details); err != nil || code != http.StatusOK {
+		t.Fatalf("%d %s", code, body)
+	}
+	if details.Status != "done" || details.Result == nil || *details.Result != -1 || details.Timeline != nil {
+		t.Errorf("got %s with %v and timeline %+v", details.Status, details.Result, details.Timeline)
+	}
+}
+
+func TestStartHandler_ListenError(t *testing.T) {
+	var busy = httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(busy.Close)
+
+	var cfg = config.Default()
+	cfg.Server.Addr = busy.Listener.Addr().String()
+	cfg.Database.Path = filepath.Join(t.TempDir(), "data.db")
+	cfg.Log.Level = "error"
+
+	var previous = slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	if err := StartHandler(cfg); err == nil || !strings.Contains(err.Error(), "address already in use") {
+		t.Errorf("got %v, want the listen error", err)
+	}
+}
@@ -1,49 +1,181 @@
 package server
 
 import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/calculator"
 	"Distributed-arithmetic-expression-evaluator-version-2.0/client"
 	"Distributed-arithmetic-expression-evaluator-version-2.0/database"
 	"Distributed-arithmetic-expression-evaluator-version-2.0/rest"
-	"log"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/tracing"
+	"errors"
+	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 const (
 	decodeErr = "Decode JSON data error"
 )
 
-var (
-	DB         *database.DB
-	WebClients *client.Clients
-)
+// Options настройки Server. Обязательно только Store.
+type Options struct {
+	Store database.Store
+	// Timings время выполнения операций, calculator.NewTimings(), если nil
+	Timings *calculator.Timings
+	// Scheduler вычисляет выражения; если nil, создаётся по Timings и Workers. Иначе Timings берутся из него.
+	Scheduler *calculator.Scheduler
+	// Workers ограничивает число одновременно вычисляемых выражений, без ограничения, если 0
+	Workers int
+	// Logger slog.Default(), если nil. Вычислитель и хранилище тоже пишут в него.
+	Logger *slog.Logger
+	// Tracer записывает запросы и вычисления. Если nil, трассы хранятся только в памяти
+	// для GET /expressions/{id}/trace.
+	Tracer *tracing.Tracer
+	// TimingsFile CSV-файл, в который время выполнения операций сохраняется после каждого изменения.
+	// Его читает config.Load при следующем запуске. Если пусто, время не сохраняется.
+	TimingsFile string
+	// ShutdownDelay сколько Run продолжает обслуживать запросы с непроходящим /readyz, прежде чем закрыть
+	// listener, чтобы балансировщики сначала перестали присылать запросы. Без задержки, если 0.
+	ShutdownDelay time.Duration
+	// DrainTimeout ограничивает, сколько Run при остановке ждёт текущие запросы и вычисления,
+	// DefaultDrainTimeout, если 0
+	DrainTimeout time.Duration
+	// TokenLifetime срок действия выдаваемых токенов, бессрочно, если 0
+	TokenLifetime time.Duration
+	// BatchSize наибольшее число выражений в пакете, MaxBatchSize, если 0
+	BatchSize int
+	// PageSize наибольший размер страницы списка выражений, MaxPageSize, если 0
+	PageSize int
+}
+
+// DefaultDrainTimeout период завершения, если он не задан в Options
+const DefaultDrainTimeout = 30 * time.Second
+
+// Server обслуживает HTTP API. Серверы ничего не разделяют, поэтому в одном процессе их может быть несколько.
+type Server struct {
+	store       database.Store
+	timings     *calculator.Timings
+	scheduler   *calculator.Scheduler
+	clients     *client.Clients
+	logger      *slog.Logger
+	tracer      *tracing.Tracer
+	timingsFile string
+	timingsMu   sync.Mutex // Упорядочивает изменения времени операций
+	delay       time.Duration
+	drain       time.Duration
+	tokenLife   time.Duration
+	batchSize   int
+	pageSize    int
+	metrics     *serverMetrics
+}
+
+// New создаёт сервер и возобновляет вычисление незавершённых выражений хранилища
+func New(options Options) (*Server, error) {
+	if options.Store == nil {
+		return nil, errors.New("store is required")
+	}
+
+	var s = &Server{
+		store:       options.Store,
+		timings:     options.Timings,
+		scheduler:   options.Scheduler,
+		logger:      options.Logger,
+		tracer:      options.Tracer,
+		timingsFile: options.TimingsFile,
+		delay:       options.ShutdownDelay,
+		drain:       options.DrainTimeout,
+		tokenLife:   options.TokenLifetime,
+		batchSize:   options.BatchSize,
+		pageSize:    options.PageSize,
+	}
+
+	if s.drain <= 0 {
+		s.drain = DefaultDrainTimeout
+	}
+	if s.batchSize <= 0 {
+		s.batchSize = MaxBatchSize
+	}
+	if s.pageSize <= 0 {
+		s.pageSize = MaxPageSize
+	}
+
+	if s.scheduler != nil {
+		s.timings = s.scheduler.Timings()
+	} else {
+		if s.timings == nil {
+			s.timings = calculator.NewTimings()
+		}
+		s.scheduler = calculator.NewScheduler(s.timings, options.Workers)
+	}
+
+	if s.logger == nil {
+		s.logger = slog.Default()
+	}
+	if s.tracer == nil {
+		s.tracer = tracing.NewTracer()
+	}
+
+	// Метрики учитывают и загрузку клиентов
+	s.metrics = newMetrics(s)
+	s.store = database.Observed(s.store, s.observeQuery)
+	s.scheduler.Observe(s.metrics.observer())
+	s.scheduler.SetLogger(s.logger)
+	s.scheduler.SetTracer(s.tracer)
+
+	var err error
+	if s.clients, err = client.NewClients(s.store, s.scheduler); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
 
 type ClientExpression struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Token    string `json:"token"`
-	ID       string `json:"id"`
-	Content  string `json:"content"`
+	Username string             `json:"username"`
+	Password string             `json:"password"`
+	Token    string             `json:"token"`
+	ID       string             `json:"id"`
+	Content  string             `json:"content"`
+	Bindings map[string]float64 `json:"bindings"`
 }
 
-func FormatExpression(id string, expr *rest.Expression) []string {
-	var ok, err = expr.GetValue()
+// FormatExpression возвращает поля строки /list. eta - текущая оценка оставшегося времени.
+func FormatExpression(id string, expr *rest.Expression, eta time.Duration) []string {
+	var state, _, err = expr.State()
 	var status string
 
-	switch {
-	case err != nil:
+	switch state {
+	case rest.StatusFailed:
 		status = err.Error()
-	case ok == -1:
-		status = "Считается"
-	default:
+	case rest.StatusWaiting:
+		status = "Ожидает"
+	case rest.StatusDone:
 		status = "Высчитан"
+	default:
+		status = "Считается"
+	}
+
+	return []string{id, status, expr.Express, expr.Created.Format("02 Jan at 15:04:05"),
+		strconv.FormatInt(expr.Expiration.Milliseconds(), 10) + "ms", strconv.FormatInt(eta.Milliseconds(), 10) + "ms"}
+}
+
+// FormatBindings записывает используемые выражением переменные как "a=1, b=2" в порядке имён
+func FormatBindings(bindings map[string]float64) string {
+	var names = rest.MapGetKeys(bindings)
+	slices.Sort(names)
+	var formatted = make([]string, len(names))
+	for i, name := range names {
+		formatted[i] = name + "=" + rest.FormatValue(bindings[name])
 	}
 
-	return []string{id, status, expr.Express, expr.Created.Format("02 Jan at 15:04:05"), strconv.FormatInt(expr.Expiration.Milliseconds(), 10) + "ms"}
+	return strings.Join(formatted, ", ")
 }
 
 func Close(r *http.Request) {
 	if err := r.Body.Close(); err != nil {
-		log.Fatal(err)
+		slog.Error("Failed to close the request body", "error", err)
 	}
 }
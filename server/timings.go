@@ -0,0 +1,235 @@
+package server
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/calculator"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/data"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/database"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// TimingChange запись журнала изменений, которую возвращает /math/audit
+type TimingChange struct {
+	User      string    `json:"user"`
+	Operation string    `json:"operation"`
+	Previous  string    `json:"previous"`
+	Current   string    `json:"current"`
+	Date      time.Time `json:"date"`
+}
+
+// TimingsTable возвращает время выполнения каждой операции по её имени
+func (s *Server) TimingsTable() map[string]string {
+	var (
+		times = s.timings.All()
+		table = make(map[string]string, len(calculator.OperationNames))
+	)
+	for name, operator := range calculator.OperationNames {
+		table[name] = times[operator].String()
+	}
+
+	return table
+}
+
+// operationName возвращает имя, под которым операция доступна в /math
+func operationName(operator string) string {
+	for name, val := range calculator.OperationNames {
+		if val == operator {
+			return name
+		}
+	}
+
+	return operator
+}
+
+// timingsRequest разобранный запрос на изменение времени выполнения операций
+type timingsRequest struct {
+	username string
+	token    string
+	values   map[string]string
+	fields   map[string]string // Ошибки отдельных полей
+}
+
+// parseJSONTimings читает JSON-объект, связывающий имена операций с длительностями в формате Go
+func parseJSONTimings(r *http.Request, full bool) (*timingsRequest, error) {
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	var req = &timingsRequest{values: map[string]string{}, fields: map[string]string{}}
+	for key, raw := range body {
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			req.fields[key] = "must be a string"
+			continue
+		}
+
+		switch _, ok := calculator.OperationNames[key]; {
+		case key == "username":
+			req.username = value
+		case key == "token":
+			req.token = value
+		case ok:
+			req.values[key] = value
+		default:
+			req.fields[key] = "unknown operation"
+		}
+	}
+
+	if full {
+		for name := range calculator.OperationNames {
+			if _, ok := body[name]; !ok {
+				req.fields[name] = "is required"
+			}
+		}
+	}
+
+	return req, nil
+}
+
+// parseFormTimings читает поля формы прежнего формата с числом миллисекунд
+func parseFormTimings(r *http.Request) (*timingsRequest, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	var req = &timingsRequest{
+		username: r.Form.Get("username"),
+		token:    r.Form.Get("token"),
+		values:   map[string]string{},
+		fields:   map[string]string{},
+	}
+	for name := range calculator.OperationNames {
+		if value := r.Form.Get(name); value != "" {
+			req.values[name] = value
+		}
+	}
+
+	return req, nil
+}
+
+// MathOperationsHandler показывает время выполнения операций на GET.
+// POST заменяет всю таблицу, а PATCH изменяет только переданные операции.
+func (s *Server) MathOperationsHandler(w http.ResponseWriter, r *http.Request) {
+	defer Close(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		WriteJSON(w, http.StatusOK, s.TimingsTable())
+		return
+	case http.MethodPost, http.MethodPatch:
+	default:
+		WriteError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Only GET, POST and PATCH methods are allowed", nil)
+		return
+	}
+
+	var (
+		req *timingsRequest
+		err error
+	)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		req, err = parseJSONTimings(r, r.Method == http.MethodPost)
+	} else {
+		req, err = parseFormTimings(r)
+	}
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, codeInvalidJSON, "Invalid request body: "+err.Error(), nil)
+		return
+	}
+
+	if req.username == "" || req.token == "" {
+		WriteError(w, http.StatusUnauthorized, codeUnauthorized, "Username and token cannot be empty", nil)
+		return
+	}
+
+	if err = s.Authorize(req.username, req.token); err != nil {
+		WriteError(w, http.StatusUnauthorized, codeUnauthorized, "Unauthorized - "+err.Error(), nil)
+		return
+	}
+
+	var operations = make([]*calculator.Operation, 0, len(req.values))
+	for name, value := range req.values {
+		operation, err := calculator.FormatOperation(calculator.OperationNames[name], value)
+		if err != nil {
+			req.fields[name] = err.Error()
+			continue
+		}
+
+		operations = append(operations, operation)
+	}
+
+	if len(req.fields) != 0 {
+		WriteError(w, http.StatusBadRequest, codeValidationFailed, "Invalid operation execution times", req.fields)
+		return
+	}
+
+	// Изменения применяются только после записи в журнал и файл, поэтому они выполняются по одному
+	s.timingsMu.Lock()
+	defer s.timingsMu.Unlock()
+
+	var (
+		current = s.timings.All()
+		changes = make([]*database.TimingChange, 0, len(operations))
+		now     = time.Now()
+	)
+	for _, operation := range operations {
+		var previous = current[operation.Operator()]
+		current[operation.Operator()] = operation.Duration()
+		if previous == operation.Duration() {
+			continue
+		}
+
+		changes = append(changes, &database.TimingChange{
+			User:      req.username,
+			Operation: operationName(operation.Operator()),
+			Previous:  previous,
+			Current:   operation.Duration(),
+			Date:      now,
+		})
+	}
+
+	if err = s.store.AddTimingChanges(changes...); err != nil {
+		WriteError(w, http.StatusInternalServerError, codeInternal, "Error recording the change: "+err.Error(), nil)
+		return
+	}
+
+	if s.timingsFile != "" {
+		if err = data.UploadArithmetic(current, s.timingsFile); err != nil {
+			WriteError(w, http.StatusInternalServerError, codeInternal, "Error saving operation times: "+err.Error(), nil)
+			return
+		}
+	}
+
+	s.timings.Set(operations...)
+
+	WriteJSON(w, http.StatusOK, s.TimingsTable())
+}
+
+// MathAuditHandler возвращает, кто и когда изменял время выполнения операций
+func (s *Server) MathAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Only GET method is allowed", nil)
+		return
+	}
+
+	changes, err := s.store.GetTimingChanges()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, codeInternal, "Error reading the audit trail: "+err.Error(), nil)
+		return
+	}
+
+	var audit = make([]TimingChange, len(changes))
+	for i, change := range changes {
+		audit[i] = TimingChange{
+			User:      change.User,
+			Operation: change.Operation,
+			Previous:  change.Previous.String(),
+			Current:   change.Current.String(),
+			Date:      change.Date,
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, audit)
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/tracing"
+	"net/http"
+	"slices"
+)
+
+// Trace ход последнего вычисления выражения. Незавершённые span не включаются.
+type Trace struct {
+	TraceID string             `json:"trace_id"`
+	Spans   []tracing.SpanData `json:"spans"`
+}
+
+// TraceHandler возвращает span последнего вычисления выражения пользователя в порядке их начала.
+// Хранятся только недавние трассы работающего сервера, поэтому более старые вычисления не находятся.
+func (s *Server) TraceHandler(w http.ResponseWriter, r *http.Request) {
+	var ID = r.PathValue("id")
+
+	var webClient, ok = s.clients.Get(Username(r))
+	if !ok {
+		WriteError(w, http.StatusNotFound, codeNotFound, "User not found", nil)
+		return
+	}
+
+	var ex, err = webClient.Expressions.GetExpression(ID)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, codeNotFound, "There is no such expression: "+ID, nil)
+		return
+	}
+
+	var traceID = ex.Trace()
+	spans, ok := s.tracer.Trace(traceID)
+	if traceID == "" || !ok {
+		WriteError(w, http.StatusNotFound, codeNotFound, "No trace is kept for the expression: "+ID, nil)
+		return
+	}
+
+	slices.SortStableFunc(spans, func(a, b tracing.SpanData) int {
+		return a.Start.Compare(b.Start)
+	})
+	if spans == nil {
+		spans = []tracing.SpanData{}
+	}
+
+	WriteJSON(w, http.StatusOK, Trace{TraceID: traceID, Spans: spans})
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/expressions"
+	"mime"
+	"net/http"
+)
+
+// exportContentTypes связывает форматы экспорта с их типами содержимого
+var exportContentTypes = map[string]string{
+	expressions.FormatCSV:    "text/csv",
+	expressions.FormatNDJSON: "application/x-ndjson",
+	expressions.FormatJSON:   "application/json",
+}
+
+// importFormat возвращает формат импортируемого файла, заданный параметром "format"
+// или типом содержимого, или "", чтобы определить его по содержимому
+func importFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+
+	var mediaType, _, _ = mime.ParseMediaType(r.Header.Get("Content-Type"))
+	for format, contentType := range exportContentTypes {
+		if mediaType == contentType {
+			return format
+		}
+	}
+
+	return ""
+}
+
+// ExportHandler передаёт выражения пользователя с их статусом, результатом и временем
+// в виде CSV, NDJSON или JSON-массива
+func (s *Server) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	var webClient, ok = s.clients.Get(Username(r))
+	if !ok {
+		WriteError(w, http.StatusNotFound, codeNotFound, "User not found", nil)
+		return
+	}
+
+	var format = r.URL.Query().Get("format")
+	if format == "" {
+		format = expressions.FormatJSON
+	}
+
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		WriteError(w, http.StatusBadRequest, codeValidationFailed, "Unknown export format",
+			map[string]string{"format": "must be csv, ndjson or json"})
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="expressions.`+format+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	if err := expressions.WriteRecords(w, format, webClient.Expressions.Records()); err != nil {
+		// Статус уже отправлен, поэтому ошибку можно только записать в лог
+		s.logger.ErrorContext(r.Context(), "Failed to export expressions", "error", err)
+	}
+}
+
+// ImportHandler добавляет выражения из экспортированного файла. Вычисленные и завершившиеся ошибкой
+// выражения сохраняют результат, остальные вычисляются заново. Записи проверяются так же, как элементы пакета,
+// и для файла действуют те же ограничения размера.
+func (s *Server) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	defer Close(r)
+
+	var webClient, ok = s.clients.Get(Username(r))
+	if !ok {
+		WriteError(w, http.StatusNotFound, codeNotFound, "User not found", nil)
+		return
+	}
+
+	records, err := expressions.ReadRecords(s.batchBody(w, r), importFormat(r))
+	if writeTooLarge(w, err) {
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusBadRequest, codeInvalidJSON, "Invalid file: "+err.Error(), nil)
+		return
+	}
+
+	if len(records) == 0 {
+		WriteError(w, http.StatusBadRequest, codeValidationFailed, "The file has no expressions", nil)
+		return
+	} else if len(records) > s.batchSize {
+		s.writeBatchSize(w) // Файл добавляется одной транзакцией, как пакет
+		return
+	}
+
+	var (
+		b    = newBatch(len(records))
+		seen = make(map[string]bool, len(records))
+	)
+	for i, record := range records {
+		var fields = map[string]string{}
+		switch {
+		case record.ID == "":
+			fields["id"] = "is required"
+		case seen[record.ID]:
+			fields["id"] = "is repeated in the file"
+		}
+		if record.Expression == "" {
+			fields["expression"] = "is required"
+		}
+		if len(fields) != 0 {
+			b.reject(i, record.ID, invalid("Invalid expression", fields))
+			continue
+		}
+		seen[record.ID] = true
+
+		expr, err := record.Build(s.timings, webClient.Expressions.Now())
+		if err != nil {
+			b.reject(i, record.ID, invalid("Error preparing expression: "+err.Error(), nil))
+			continue
+		}
+
+		b.add(i, record.ID, expr)
+	}
+
+	if err = b.commit(r.Context(), webClient.Expressions); err != nil {
+		WriteError(w, http.StatusInternalServerError, codeInternal, "Error saving expressions: "+err.Error(), nil)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, b.response)
+}
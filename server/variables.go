@@ -0,0 +1,110 @@
+package server
+
+import (
+	"Distributed-arithmetic-expression-evaluator-version-2.0/calculator"
+	"Distributed-arithmetic-expression-evaluator-version-2.0/database"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// Variable именованная константа пользователя, которую можно использовать в выражениях
+type Variable struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+type variableRequest struct {
+	Username string   `json:"username"`
+	Name     string   `json:"name"`
+	Value    *float64 `json:"value"`
+}
+
+// VariablesHandler возвращает переменные пользователя на GET, создаёт переменную на POST,
+// изменяет значение существующей на PUT и удаляет её на DELETE.
+func (s *Server) VariablesHandler(w http.ResponseWriter, r *http.Request) {
+	defer Close(r)
+
+	var req variableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !(r.Method == http.MethodGet && errors.Is(err, io.EOF)) {
+		WriteError(w, http.StatusBadRequest, codeInvalidJSON, "Invalid JSON data: "+err.Error(), nil)
+		return
+	}
+	req.Username = Username(r) // Пользователь, авторизованный токеном, а не указанный в теле
+
+	if r.Method == http.MethodGet {
+		variables, err := s.store.GetVariables(req.Username)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, codeInternal, "Error reading variables: "+err.Error(), nil)
+			return
+		}
+
+		WriteJSON(w, http.StatusOK, variables)
+		return
+	}
+
+	var fields = map[string]string{}
+	if err := calculator.CheckVariableName(req.Name); err != nil {
+		fields["name"] = err.Error()
+	}
+	if req.Value == nil && r.Method != http.MethodDelete {
+		fields["value"] = "is required"
+	}
+
+	if len(fields) != 0 {
+		WriteError(w, http.StatusBadRequest, codeValidationFailed, "Invalid variable", fields)
+		return
+	}
+
+	_, err := s.store.GetVariable(req.Username, req.Name)
+	var exists = err == nil
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		WriteError(w, http.StatusInternalServerError, codeInternal, "Error reading variables: "+err.Error(), nil)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		if exists {
+			WriteError(w, http.StatusConflict, codeConflict, "Variable "+req.Name+" already exists", nil)
+			return
+		}
+
+		if err = s.store.SetVariable(req.Username, req.Name, *req.Value); err != nil {
+			WriteError(w, http.StatusInternalServerError, codeInternal, "Error saving variable: "+err.Error(), nil)
+			return
+		}
+
+		WriteJSON(w, http.StatusCreated, Variable{Name: req.Name, Value: *req.Value})
+
+	case http.MethodPut:
+		if !exists {
+			WriteError(w, http.StatusNotFound, codeNotFound, "Variable "+req.Name+" not found", nil)
+			return
+		}
+
+		if err = s.store.SetVariable(req.Username, req.Name, *req.Value); err != nil {
+			WriteError(w, http.StatusInternalServerError, codeInternal, "Error saving variable: "+err.Error(), nil)
+			return
+		}
+
+		WriteJSON(w, http.StatusOK, Variable{Name: req.Name, Value: *req.Value})
+
+	case http.MethodDelete:
+		if !exists {
+			WriteError(w, http.StatusNotFound, codeNotFound, "Variable "+req.Name+" not found", nil)
+			return
+		}
+
+		if err = s.store.DeleteVariable(req.Username, req.Name); err != nil {
+			WriteError(w, http.StatusInternalServerError, codeInternal, "Error deleting variable: "+err.Error(), nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		WriteError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Only GET, POST, PUT and DELETE methods are allowed", nil)
+	}
+}
@@ -0,0 +1,328 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of exporters the server can be configured with
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterOTLP   = "otlp"
+)
+
+// WriterExporter writes every span as a line of JSON, for example to stdout or to a file
+type WriterExporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer // The file opened by OpenFileExporter, nil otherwise
+}
+
+// NewWriterExporter returns an exporter writing to w
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// OpenFileExporter returns an exporter appending to the file, which is created if needed
+func OpenFileExporter(path string) (*WriterExporter, error) {
+	var file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WriterExporter{w: file, closer: file}, nil
+}
+
+func (exporter *WriterExporter) Export(_ context.Context, spans []SpanData) error {
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+
+	var encoder = json.NewEncoder(exporter.w)
+	for _, span := range spans {
+		if err := encoder.Encode(span); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Shutdown closes the file of OpenFileExporter
+func (exporter *WriterExporter) Shutdown(context.Context) error {
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+
+	if exporter.closer == nil {
+		return nil
+	}
+
+	var err = exporter.closer.Close()
+	exporter.closer = nil
+
+	return err
+}
+
+// Defaults of OTLPExporter
+const (
+	DefaultBatchSize     = 512
+	DefaultFlushInterval = 5 * time.Second
+	DefaultQueueSize     = 4096
+)
+
+// OTLPExporter sends spans to an OpenTelemetry collector with OTLP over HTTP, encoded as JSON.
+// Spans are sent in batches from a background goroutine. When the queue is full new spans are
+// dropped rather than slowing the calculations down.
+type OTLPExporter struct {
+	URL         string            // The traces endpoint, for example http://localhost:4318/v1/traces
+	Headers     map[string]string // Sent with every request, for example an API key
+	ServiceName string
+	Client      *http.Client
+
+	queue   chan SpanData
+	flush   chan chan error
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewOTLPExporter starts an exporter sending to the collector at endpoint. An endpoint without
+// a path, such as http://localhost:4318, gets the standard /v1/traces path.
+func NewOTLPExporter(endpoint, serviceName string, headers map[string]string) *OTLPExporter {
+	var url = strings.TrimRight(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+
+	var exporter = &OTLPExporter{
+		URL:         url,
+		Headers:     headers,
+		ServiceName: serviceName,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan SpanData, DefaultQueueSize),
+		flush:       make(chan chan error),
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	go exporter.run()
+
+	return exporter
+}
+
+// Export queues the spans, dropping the ones that do not fit
+func (exporter *OTLPExporter) Export(_ context.Context, spans []SpanData) error {
+	var dropped int
+	for _, span := range spans {
+		select {
+		case exporter.queue <- span:
+		default:
+			dropped++
+		}
+	}
+
+	if dropped != 0 {
+		return fmt.Errorf("otlp queue is full, %d spans dropped", dropped)
+	}
+
+	return nil
+}
+
+// Flush sends the queued spans
+func (exporter *OTLPExporter) Flush(ctx context.Context) error {
+	var done = make(chan error, 1)
+	select {
+	case exporter.flush <- done:
+	case <-exporter.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown sends the queued spans and stops the exporter
+func (exporter *OTLPExporter) Shutdown(ctx context.Context) error {
+	var err = exporter.Flush(ctx)
+	exporter.once.Do(func() { close(exporter.stop) })
+
+	select {
+	case <-exporter.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return err
+}
+
+func (exporter *OTLPExporter) run() {
+	defer close(exporter.stopped)
+
+	var (
+		ticker = time.NewTicker(DefaultFlushInterval)
+		batch  []SpanData
+	)
+	defer ticker.Stop()
+
+	var send = func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		var err = exporter.send(batch)
+		if err != nil {
+			slog.Warn("Failed to export spans", "spans", len(batch), "url", exporter.URL, "error", err)
+		}
+		batch = nil
+		return err
+	}
+
+	// drain moves the queued spans to the batch
+	var drain = func() {
+		for {
+			select {
+			case span := <-exporter.queue:
+				batch = append(batch, span)
+			default:
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case span := <-exporter.queue:
+			if batch = append(batch, span); len(batch) >= DefaultBatchSize {
+				_ = send()
+			}
+		case <-ticker.C:
+			_ = send()
+		case done := <-exporter.flush:
+			drain()
+			done <- send()
+		case <-exporter.stop:
+			drain()
+			_ = send()
+			return
+		}
+	}
+}
+
+// send posts the batch to the collector
+func (exporter *OTLPExporter) send(spans []SpanData) error {
+	var body, err = json.Marshal(otlpRequest(exporter.ServiceName, spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, exporter.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range exporter.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := exporter.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp collector returned %s", resp.Status)
+	}
+
+	return nil
+}
+
+// otlpRequest builds an ExportTraceServiceRequest in the JSON encoding of OTLP
+func otlpRequest(serviceName string, spans []SpanData) map[string]interface{} {
+	var encoded = make([]map[string]interface{}, len(spans))
+	for i, span := range spans {
+		var item = map[string]interface{}{
+			"traceId":           span.TraceID,
+			"spanId":            span.SpanID,
+			"name":              span.Name,
+			"kind":              1, // SPAN_KIND_INTERNAL
+			"startTimeUnixNano": strconv.FormatInt(span.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.End.UnixNano(), 10),
+			"attributes":        otlpAttributes(span.Attributes),
+		}
+		if span.ParentID != "" {
+			item["parentSpanId"] = span.ParentID
+		}
+		if len(span.Links) != 0 {
+			var links = make([]map[string]string, len(span.Links))
+			for j, link := range span.Links {
+				links[j] = map[string]string{"traceId": link.TraceID, "spanId": link.SpanID}
+			}
+			item["links"] = links
+		}
+		switch span.Status {
+		case StatusOK:
+			item["status"] = map[string]interface{}{"code": 1}
+		case StatusError:
+			item["status"] = map[string]interface{}{"code": 2, "message": span.Error}
+		}
+		encoded[i] = item
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{"service.name": serviceName}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "Distributed-arithmetic-expression-evaluator-version-2.0/tracing"},
+				"spans": encoded,
+			}},
+		}},
+	}
+}
+
+// otlpAttributes encodes the attributes as OTLP key-value pairs
+func otlpAttributes(attributes map[string]interface{}) []map[string]interface{} {
+	var encoded = make([]map[string]interface{}, 0, len(attributes))
+	for key, value := range attributes {
+		encoded = append(encoded, map[string]interface{}{"key": key, "value": otlpValue(value)})
+	}
+
+	return encoded
+}
+
+func otlpValue(value interface{}) map[string]interface{} {
+	switch value := value.(type) {
+	case bool:
+		return map[string]interface{}{"boolValue": value}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(value, 10)}
+	case float64:
+		return map[string]interface{}{"doubleValue": value}
+	case []interface{}:
+		var values = make([]map[string]interface{}, len(value))
+		for i, v := range value {
+			values[i] = otlpValue(v)
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	default:
+		return map[string]interface{}{"stringValue": fmt.Sprint(value)}
+	}
+}
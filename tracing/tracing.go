@@ -0,0 +1,307 @@
+// Package tracing records spans of work, keeps the recent traces in memory and exports
+// finished spans as JSON lines or to an OpenTelemetry collector over OTLP/HTTP.
+//
+// A nil *Tracer and a nil *Span are valid and record nothing.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limits of the traces kept in memory
+const (
+	MaxTraces = 1000  // The oldest trace is forgotten when a new one starts
+	MaxSpans  = 10000 // Spans of a trace beyond this are exported but not kept
+)
+
+// Span statuses
+const (
+	StatusUnset = ""
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// SpanContext identifies a span
+type SpanContext struct {
+	TraceID string `json:"trace_id"`
+	SpanID  string `json:"span_id"`
+}
+
+// SpanData is a finished span
+type SpanData struct {
+	SpanContext
+	ParentID   string                 `json:"parent_id,omitempty"`
+	Name       string                 `json:"name"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Links      []SpanContext          `json:"links,omitempty"`
+	Status     string                 `json:"status,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// Duration returns how long the span lasted
+func (data SpanData) Duration() time.Duration {
+	return data.End.Sub(data.Start)
+}
+
+// Exporter receives finished spans. Export is called for every span as it ends, so an
+// exporter that sends spans over the network must batch them itself.
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+	// Shutdown exports the spans still buffered and releases the exporter
+	Shutdown(ctx context.Context) error
+}
+
+// Tracer starts spans, keeps the recent traces and passes finished spans to the exporters
+type Tracer struct {
+	exporters []Exporter
+
+	mu     sync.Mutex
+	traces map[string][]SpanData
+	order  []string // Trace IDs, oldest first
+}
+
+// NewTracer returns a tracer exporting to the exporters. Without exporters spans are only kept in memory.
+func NewTracer(exporters ...Exporter) *Tracer {
+	return &Tracer{exporters: exporters, traces: map[string][]SpanData{}}
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of the context in which the span is the current one
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the current span of the context or nil
+func SpanFromContext(ctx context.Context) *Span {
+	var span, _ = ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Start begins a span that is a child of the current span of the context, or the root
+// of a new trace if there is none. Args are alternating keys and values of attributes.
+// The returned context has the new span as the current one.
+func (tracer *Tracer) Start(ctx context.Context, name string, args ...interface{}) (context.Context, *Span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+
+	var span = tracer.newSpan(name, args)
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.data.TraceID = parent.data.TraceID
+		span.data.ParentID = parent.data.SpanID
+	} else {
+		span.data.TraceID = newID(16)
+		tracer.begin(span.data.TraceID)
+	}
+
+	return ContextWithSpan(ctx, span), span
+}
+
+// StartTrace begins the root span of a new trace. The current span of the context,
+// if there is one, is linked to it rather than being its parent.
+func (tracer *Tracer) StartTrace(ctx context.Context, name string, args ...interface{}) (context.Context, *Span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+
+	var span = tracer.newSpan(name, args)
+	span.data.TraceID = newID(16)
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.data.Links = []SpanContext{parent.Context()}
+	}
+	tracer.begin(span.data.TraceID)
+
+	return ContextWithSpan(ctx, span), span
+}
+
+func (tracer *Tracer) newSpan(name string, args []interface{}) *Span {
+	var span = &Span{tracer: tracer, data: SpanData{Name: name, Start: time.Now()}}
+	span.data.SpanID = newID(8)
+	span.SetAttributes(args...)
+
+	return span
+}
+
+// begin makes room for a new trace
+func (tracer *Tracer) begin(traceID string) {
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+
+	if len(tracer.order) >= MaxTraces {
+		delete(tracer.traces, tracer.order[0])
+		tracer.order = tracer.order[1:]
+	}
+	tracer.order = append(tracer.order, traceID)
+	tracer.traces[traceID] = nil
+}
+
+// finish keeps and exports an ended span
+func (tracer *Tracer) finish(data SpanData) {
+	tracer.mu.Lock()
+	if spans, ok := tracer.traces[data.TraceID]; ok && len(spans) < MaxSpans {
+		tracer.traces[data.TraceID] = append(spans, data)
+	}
+	tracer.mu.Unlock()
+
+	for _, exporter := range tracer.exporters {
+		if err := exporter.Export(context.Background(), []SpanData{data}); err != nil {
+			slog.Warn("Failed to export a span", "span", data.Name, "error", err)
+		}
+	}
+}
+
+// Trace returns the ended spans of the trace in the order they ended and whether the trace is known
+func (tracer *Tracer) Trace(traceID string) ([]SpanData, bool) {
+	if tracer == nil {
+		return nil, false
+	}
+
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+
+	var spans, ok = tracer.traces[traceID]
+	return append([]SpanData(nil), spans...), ok
+}
+
+// Shutdown shuts the exporters down
+func (tracer *Tracer) Shutdown(ctx context.Context) error {
+	if tracer == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, exporter := range tracer.exporters {
+		if err := exporter.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("tracing: %v", errs)
+	}
+
+	return nil
+}
+
+// Span is a unit of work being recorded. It is safe for concurrent use.
+type Span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+// Context returns the IDs of the span
+func (span *Span) Context() SpanContext {
+	if span == nil {
+		return SpanContext{}
+	}
+
+	return span.data.SpanContext
+}
+
+// SetAttributes sets attributes from alternating keys and values
+func (span *Span) SetAttributes(args ...interface{}) {
+	if span == nil || len(args) == 0 {
+		return
+	}
+
+	span.mu.Lock()
+	defer span.mu.Unlock()
+
+	if span.data.Attributes == nil {
+		span.data.Attributes = make(map[string]interface{}, len(args)/2)
+	}
+	for i := 0; i+1 < len(args); i += 2 {
+		span.data.Attributes[fmt.Sprint(args[i])] = attributeValue(args[i+1])
+	}
+}
+
+// attributeValue converts the value to a string, an integer, a float or a boolean
+func attributeValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case string, bool, int64:
+		return value
+	case float64:
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return strconv.FormatFloat(value, 'g', -1, 64) // JSON has no such numbers
+		}
+		return value
+	case int:
+		return int64(value)
+	case float32:
+		return float64(value)
+	case time.Duration:
+		return value.String()
+	case []float64:
+		var values = make([]interface{}, len(value))
+		for i, v := range value {
+			values[i] = attributeValue(v)
+		}
+		return values
+	case fmt.Stringer:
+		return value.String()
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// SetError marks the span failed
+func (span *Span) SetError(err error) {
+	if span == nil || err == nil {
+		return
+	}
+
+	span.mu.Lock()
+	defer span.mu.Unlock()
+
+	span.data.Status = StatusError
+	span.data.Error = err.Error()
+}
+
+// End finishes the span. Only the first call has an effect.
+func (span *Span) End() {
+	if span == nil {
+		return
+	}
+
+	span.mu.Lock()
+	if span.ended {
+		span.mu.Unlock()
+		return
+	}
+	span.ended = true
+	span.data.End = time.Now()
+	if span.data.Status == StatusUnset {
+		span.data.Status = StatusOK
+	}
+	var data = span.data
+	data.Attributes = maps.Clone(data.Attributes) // Attributes set after End must not change the exported span
+	span.mu.Unlock()
+
+	span.tracer.finish(data)
+}
+
+// newID returns size random bytes in hexadecimal
+func newID(size int) string {
+	var buf = make([]byte, size)
+	_, _ = rand.Read(buf)
+
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,173 @@
+package tracing
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTracer_Trace(t *testing.T) {
+	var (
+		tracer       = NewTracer()
+		ctx, request = tracer.Start(context.Background(), "http.request")
+		exprCtx, ex  = tracer.StartTrace(ctx, "expression", "expression.id", "a")
+		_, op        = tracer.Start(exprCtx, "operation", "operator", "+", "operands", []float64{1, math.Inf(1)})
+	)
+	op.SetAttributes("result", math.Inf(1))
+	op.SetError(errors.New("overflow"))
+	op.End()
+	op.SetAttributes("late", true) // Ignored after End
+	ex.End()
+	ex.End()
+	request.End()
+
+	if ex.Context().TraceID == request.Context().TraceID {
+		t.Fatal("the expression shares the trace of the request")
+	}
+
+	var spans, ok = tracer.Trace(ex.Context().TraceID)
+	if !ok || len(spans) != 2 {
+		t.Fatalf("got %d spans, want the operation and the expression", len(spans))
+	}
+
+	var operation, expression = spans[0], spans[1]
+	if operation.ParentID != expression.SpanID || expression.ParentID != "" {
+		t.Errorf("got parents %q and %q", operation.ParentID, expression.ParentID)
+	}
+	if len(expression.Links) != 1 || expression.Links[0] != request.Context() {
+		t.Errorf("got links %v, want the request span", expression.Links)
+	}
+	if operation.Status != StatusError || operation.Error != "overflow" || expression.Status != StatusOK {
+		t.Errorf("got statuses %q (%q) and %q", operation.Status, operation.Error, expression.Status)
+	}
+	if operation.Attributes["result"] != "+Inf" || operation.Attributes["late"] != nil {
+		t.Errorf("got attributes %v", operation.Attributes)
+	}
+	if _, err := json.Marshal(spans); err != nil {
+		t.Errorf("spans are not JSON: %v", err)
+	}
+
+	if _, ok = tracer.Trace("unknown"); ok {
+		t.Error("an unknown trace is found")
+	}
+}
+
+func TestTracer_Nil(t *testing.T) {
+	var tracer *Tracer
+	var ctx, span = tracer.Start(context.Background(), "noop", "key", "value")
+	span.SetAttributes("key", "value")
+	span.SetError(errors.New("ignored"))
+	span.End()
+
+	if SpanFromContext(ctx) != nil || span.Context() != (SpanContext{}) {
+		t.Error("a nil tracer records spans")
+	}
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTracer_MaxTraces(t *testing.T) {
+	var (
+		tracer   = NewTracer()
+		_, first = tracer.Start(context.Background(), "first")
+	)
+	for i := 0; i < MaxTraces; i++ {
+		var _, span = tracer.Start(context.Background(), "next")
+		span.End()
+	}
+	first.End()
+
+	if _, ok := tracer.Trace(first.Context().TraceID); ok {
+		t.Error("the oldest trace is kept")
+	}
+}
+
+func TestWriterExporter(t *testing.T) {
+	var (
+		out       bytes.Buffer
+		tracer    = NewTracer(NewWriterExporter(&out))
+		ctx, root = tracer.Start(context.Background(), "root")
+		_, child  = tracer.Start(ctx, "child", "count", 2)
+	)
+	child.End()
+	root.End()
+
+	var (
+		scanner = bufio.NewScanner(&out)
+		names   []string
+	)
+	for scanner.Scan() {
+		var span SpanData
+		if err := json.Unmarshal(scanner.Bytes(), &span); err != nil {
+			t.Fatalf("invalid line %s: %v", scanner.Text(), err)
+		}
+		names = append(names, span.Name)
+	}
+	if len(names) != 2 || names[0] != "child" || names[1] != "root" {
+		t.Errorf("got spans %v, want child and root", names)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var requests = make(chan map[string]interface{}, 1)
+	var collector = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Api-Key") != "key" {
+			t.Errorf("got %s with %v", r.URL.Path, r.Header)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		requests <- body
+	}))
+	defer collector.Close()
+
+	var (
+		exporter  = NewOTLPExporter(collector.URL, "calc", map[string]string{"Api-Key": "key"})
+		tracer    = NewTracer(exporter)
+		ctx, root = tracer.Start(context.Background(), "root")
+		_, child  = tracer.Start(ctx, "child", "operands", []float64{1, 2}, "workers", 3)
+	)
+	child.SetError(errors.New("failed"))
+	child.End()
+	root.End()
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var body = <-requests
+	var spans = body["resourceSpans"].([]interface{})[0].(map[string]interface{})["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+
+	var encoded = spans[0].(map[string]interface{})
+	if encoded["traceId"] != root.Context().TraceID || encoded["parentSpanId"] != root.Context().SpanID {
+		t.Errorf("got IDs %v and %v", encoded["traceId"], encoded["parentSpanId"])
+	}
+	if status := encoded["status"].(map[string]interface{}); status["code"] != 2.0 || status["message"] != "failed" {
+		t.Errorf("got status %v", status)
+	}
+	for _, attribute := range encoded["attributes"].([]interface{}) {
+		var attribute = attribute.(map[string]interface{})
+		var value = attribute["value"].(map[string]interface{})
+		switch attribute["key"] {
+		case "workers":
+			if value["intValue"] != "3" {
+				t.Errorf("got workers %v", value)
+			}
+		case "operands":
+			if values := value["arrayValue"].(map[string]interface{})["values"].([]interface{}); len(values) != 2 {
+				t.Errorf("got operands %v", value)
+			}
+		}
+	}
+}